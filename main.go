@@ -4,12 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"github.com/scottferg/Fergulator/nes"
-	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"strings"
+	"time"
 )
 
 var (
@@ -19,6 +20,21 @@ var (
 	audioOut *Audio
 
 	cpuprofile = flag.String("cprof", "", "write cpu profile to file")
+	headless   = flag.Bool("headless", false, "run without video or audio output")
+	frames     = flag.Int("frames", 0, "number of frames to run in headless mode (0: run forever)")
+	wavfile    = flag.String("wav", "", "record audio to a WAV (or .pcm) file")
+	stems      = flag.Bool("stems", false, "also record each audio channel to its own file")
+	vgmfile    = flag.String("vgm", "", "log audio register writes to a VGM file")
+	videofile  = flag.String("video", "", "record video to a .y4m, .gif or numbered .png sequence")
+	videowav   = flag.Bool("videowav", false, "record a WAV file alongside the video")
+	screenshot = flag.Int("screenshot", -1, "take a screenshot when this frame is reached")
+	scale      = flag.Int("scale", 1, "scale screenshots up by this factor")
+	overscan   = flag.Bool("overscan", true, "crop the overscan area from screenshots")
+	nodb       = flag.Bool("nodb", false, "don't correct ROM headers from the built in database")
+	gamedb     = flag.String("gamedb", "nes20db.xml", "NES 2.0 XML game database to correct ROM headers from")
+	patches    = flag.String("patch", "", "comma separated IPS, UPS or BPS patches to apply, in order")
+	fdsbios    = flag.String("fdsbios", "disksys.rom", "FDS BIOS file, needed to play .fds disk images")
+	entry      = flag.String("entry", "", "file to load from a .zip archive (default: the first ROM)")
 	debugfile  string
 	jsHandler  *nes.JsEventHandler
 )
@@ -28,26 +44,39 @@ func init() {
 }
 
 func main() {
-	if len(os.Args) < 2 {
+	flag.Parse()
+
+	if flag.NArg() < 1 {
 		fmt.Println("Please specify a ROM file")
 		return
 	}
 
-	flag.Parse()
-
 	// TODO: Why don't flags work? Don't want to hardcode this.
 	debugfile = "debug.js"
 
-	contents, err := ioutil.ReadFile(os.Args[1])
+	contents, filename, err := nes.ReadRomFile(flag.Arg(0), *entry)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
 
-	path := strings.Split(os.Args[1], "/")
-	nes.GameName = strings.Split(path[len(path)-1], ".")[0]
+	nes.GameName = nes.RomName(filename)
 	nes.SaveStateFile = fmt.Sprintf(".%s.state", nes.GameName)
 	nes.BatteryRamFile = fmt.Sprintf(".%s.battery", nes.GameName)
+	nes.DiskDiffFile = fmt.Sprintf(".%s.fds.ips", nes.GameName)
+	nes.FdsBiosFile = *fdsbios
+
+	// Patches named after the game are picked up automatically
+	// unless others are given
+	patchFiles := nes.FindPatches(filepath.Dir(flag.Arg(0)), nes.GameName)
+	if *patches != "" {
+		patchFiles = strings.Split(*patches, ",")
+	}
+
+	if contents, err = nes.PatchRom(contents, patchFiles); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
 
 	if debugfile != "" {
 		jsHandler = nes.NewJsEventHandler(debugfile)
@@ -58,14 +87,68 @@ func main() {
 
 	log.Println(nes.GameName, nes.SaveStateFile)
 
-	audioOut = NewAudio()
-	defer audioOut.Close()
+	nes.RomDatabaseEnabled = !*nodb
 
-	videoTick, err := nes.Init(contents, audioOut.AppendSample, GetKey)
+	// The database is optional, the built in entries are
+	// used without it
+	if nes.RomDatabaseEnabled {
+		if err := nes.LoadRomDatabaseFile(*gamedb); err != nil && !os.IsNotExist(err) {
+			fmt.Println(err.Error())
+			return
+		}
+	}
+	nes.ScreenshotFrame = *screenshot
+	nes.ScreenshotScale = *scale
+
+	// Headless mode has nowhere to send the audio, but
+	// it can still be recorded
+	audioBuf := func(int16) {}
+	if !*headless {
+		audioOut = NewAudio()
+		defer audioOut.Close()
+
+		audioBuf = audioOut.AppendSample
+	}
+
+	videoTick, err := nes.Init(contents, audioBuf, GetKey)
 	if err != nil {
 		fmt.Println(err)
 	}
 
+	if !*overscan {
+		nes.ToggleOverscan()
+	}
+
+	if *wavfile != "" {
+		if err := nes.StartAudioRecording(*wavfile, *stems); err != nil {
+			fmt.Println(err)
+		}
+
+		defer nes.StopAudioRecording()
+	}
+
+	if *vgmfile != "" {
+		if err := nes.StartVgmLogging(*vgmfile); err != nil {
+			fmt.Println(err)
+		}
+
+		defer nes.StopVgmLogging()
+	}
+
+	if *videofile != "" {
+		if err := nes.StartVideoRecording(*videofile, *videowav); err != nil {
+			fmt.Println(err)
+		}
+
+		defer nes.StopVideoRecording()
+	}
+
+	if *headless {
+		go nes.RunSystem()
+		runHeadless(videoTick, *frames)
+		return
+	}
+
 	videoOut.Init(videoTick, nes.GameName)
 
 	// Only increase the number of processors we can use after initialization,
@@ -95,3 +178,57 @@ func main() {
 
 	return
 }
+
+// Consumes frames as fast as the emulator can produce them
+func runHeadless(videoTick <-chan []uint32, frames int) {
+	for i := 0; frames == 0 || i < frames; i++ {
+		<-videoTick
+	}
+}
+
+// Bound to a key in the SDL frontend. Each recording
+// gets a new timestamped file.
+func toggleAudioRecording() {
+	if nes.AudioRecording() {
+		if err := nes.StopAudioRecording(); err != nil {
+			fmt.Println(err)
+		}
+
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%d.wav", nes.GameName, time.Now().Unix())
+	if err := nes.StartAudioRecording(filename, *stems); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func toggleVgmLogging() {
+	if nes.VgmLogging() {
+		if err := nes.StopVgmLogging(); err != nil {
+			fmt.Println(err)
+		}
+
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%d.vgm", nes.GameName, time.Now().Unix())
+	if err := nes.StartVgmLogging(filename); err != nil {
+		fmt.Println(err)
+	}
+}
+
+func toggleVideoRecording() {
+	if nes.VideoRecording() {
+		if err := nes.StopVideoRecording(); err != nil {
+			fmt.Println(err)
+		}
+
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%d.y4m", nes.GameName, time.Now().Unix())
+	if err := nes.StartVideoRecording(filename, *videowav); err != nil {
+		fmt.Println(err)
+	}
+}
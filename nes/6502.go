@@ -24,6 +24,10 @@ type Cpu struct {
 	InterruptRequested int
 	CyclesToWait       int
 	Timestamp          int
+
+	// Whether an instruction is running, as opposed to memory
+	// being accessed from outside the CPU
+	Executing bool
 }
 
 func (c *Cpu) getCarry() bool {
@@ -901,6 +905,10 @@ func (c *Cpu) PerformIrq() {
 
 	c.pushToStack(c.P)
 
+	// The line is level triggered, so the handler has to run
+	// with IRQs masked until it acknowledges the source
+	c.setIrqDisable()
+
 	h, _ := Ram.Read(0xFFFF)
 	l, _ := Ram.Read(0xFFFE)
 
@@ -970,12 +978,7 @@ func (c *Cpu) Step() int {
 	// Check if an interrupt was requested
 	switch c.InterruptRequested {
 	case InterruptIrq:
-		if v, ok := rom.(*Mmc5); ok {
-			if !c.getIrqDisable() && v.IrqStatus&0x80 == 0x80 {
-				c.PerformIrq()
-				c.InterruptRequested = InterruptNone
-			}
-		} else if !c.getIrqDisable() {
+		if !c.getIrqDisable() {
 			c.PerformIrq()
 			c.InterruptRequested = InterruptNone
 		}
@@ -985,6 +988,12 @@ func (c *Cpu) Step() int {
 	case InterruptReset:
 		c.PerformReset()
 		c.InterruptRequested = InterruptNone
+	default:
+		// Mappers hold the IRQ line low until the
+		// game acknowledges it
+		if mapperIrq() && !c.getIrqDisable() {
+			c.PerformIrq()
+		}
 	}
 
 	opcode, _ := Ram.Read(c.ProgramCounter)
@@ -997,7 +1006,10 @@ func (c *Cpu) Step() int {
 		Disassemble(opcode, c, c.ProgramCounter)
 	}
 
+	c.Executing = true
 	c.InstrOpcodes[opcode]()
+	c.Executing = false
+
 	c.Timestamp = (c.CycleCount * 15)
 
 	return c.CycleCount
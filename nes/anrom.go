@@ -8,12 +8,19 @@ type Anrom struct {
 	ChrRomCount  int
 	Battery      bool
 	Data         []byte
+	Chr          *ChrMemory
+
+	BusConflicts bool
 
 	PrgUpperBank int
 	PrgLowerBank int
 }
 
 func (m *Anrom) Write(v Word, a int) {
+	if m.BusConflicts {
+		v = busConflict(m, v, a)
+	}
+
 	if v&0x10 == 0x10 {
 		ppu.Nametables.SetMirroring(MirroringSingleUpper)
 	} else {
@@ -40,11 +47,11 @@ func (m *Anrom) BatteryBacked() bool {
 
 func (m *Anrom) WriteVram(v Word, a int) {
 	if a >= 0x1000 {
-		m.VromBanks[len(m.VromBanks)-1][a&0xFFF] = v
+		m.Chr.WriteBank(v, len(m.VromBanks)-1, 0x1000, a&0xFFF)
 		return
 	}
 
-	m.VromBanks[0][a&0xFFF] = v
+	m.Chr.WriteBank(v, 0, 0x1000, a&0xFFF)
 }
 
 func (m *Anrom) ReadVram(a int) Word {
@@ -64,3 +71,10 @@ func (m *Anrom) ReadTile(a int) []Word {
 	a &= 0xFFF
 	return m.VromBanks[0][a : a+16]
 }
+
+func (m *Anrom) SerializeState(s *State) {
+	s.Int(&m.PrgUpperBank)
+	s.Int(&m.PrgLowerBank)
+
+	m.Chr.SerializeState(s)
+}
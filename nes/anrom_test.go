@@ -0,0 +1,32 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestAnromBusConflicts(test *testing.T) {
+	loadMapperRom(test, 7, SubmapperBusConflicts, 8, 0)
+
+	// Both the bank and the nametable select lose to
+	// the 0 in the ROM
+	Ram.Write(0x8000, 0x12)
+	verifyPrgBank(0x8000, 0, test)
+
+	if ppu.Nametables.Mirroring != MirroringSingleLower {
+		test.Error("Nametable select wasn't cleared by the ROM")
+	}
+
+	Ram.Write(0x8001, 0x12)
+	verifyPrgBank(0x8000, 4, test)
+
+	if ppu.Nametables.Mirroring != MirroringSingleUpper {
+		test.Error("Nametable select wasn't set")
+	}
+}
+
+func TestAnromWithoutBusConflicts(test *testing.T) {
+	loadMapperRom(test, 7, SubmapperNoBusConflicts, 8, 0)
+
+	Ram.Write(0x8000, 0x12)
+	verifyPrgBank(0x8000, 4, test)
+}
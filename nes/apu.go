@@ -41,6 +41,12 @@ var (
 	}
 )
 
+// Cartridges with their own sound hardware mix their
+// output in alongside the internal channels
+type ExpansionAudio interface {
+	Output() float64
+}
+
 type Envelope struct {
 	Volume       Word
 	Counter      Word
@@ -136,8 +142,12 @@ type Apu struct {
 	PulseOut []float64
 	TndOut   [203]float64
 
-	Sample int16
-	Buffer func(int16)
+	Expansion       []ExpansionAudio
+	ExpansionSample float64
+
+	Sample   int16
+	Buffer   func(int16)
+	Recorder *AudioRecorder
 }
 
 func (s *Square) WriteControl(v Word) {
@@ -393,6 +403,7 @@ func (d *Dmc) FillSample() {
 func (a *Apu) Init(buffer func(int16)) {
 	a.Noise.Shift = 1
 	a.Buffer = buffer
+	a.Expansion = nil
 
 	a.PulseOut = make([]float64, 31)
 	for i := 0; i < len(a.PulseOut); i++ {
@@ -434,14 +445,19 @@ func (a *Apu) Step() {
 	}
 }
 
+// Runs s through a high-pass filter with the given state
+// and strength
+func hipass(state *int64, s int16, strength int64) int16 {
+	*state += (((int64(s) << 16) - (*state >> 16)) * strength) >> 16
+	return int16(int64(s) - (*state >> 32))
+}
+
 func (a *Apu) RunHipassStrong(s int16) int16 {
-	a.HipassStrong += (((int64(s) << 16) - (a.HipassStrong >> 16)) * HiPassStrong) >> 16
-	return int16(int64(s) - (a.HipassStrong >> 32))
+	return hipass(&a.HipassStrong, s, HiPassStrong)
 }
 
 func (a *Apu) RunHipassWeak(s int16) int16 {
-	a.HipassWeak += (((int64(s) << 16) - (a.HipassWeak >> 16)) * HiPassWeak) >> 16
-	return int16(int64(s) - (a.HipassWeak >> 32))
+	return hipass(&a.HipassWeak, s, HiPassWeak)
 }
 
 func (a *Apu) ComputeSample() int16 {
@@ -452,7 +468,36 @@ func (a *Apu) ComputeSample() int16 {
 	// tnd := a.TndOut[(3*a.Triangle.Sample)+(2*a.Noise.Sample)+a.Dmc.Sample]
 	tnd := a.TndOut[(3*a.Triangle.Sample)+(2*a.Noise.Sample)]
 
-	return int16((pulse + tnd) * 40000)
+	a.ExpansionSample = 0
+	for _, e := range a.Expansion {
+		a.ExpansionSample += e.Output()
+	}
+
+	return int16((pulse + tnd + a.ExpansionSample) * 40000)
+}
+
+// Each channel's part of the mix ComputeSample makes, in the
+// order of AudioStems. The pulse and triangle/noise outputs
+// aren't linear, so each is shared out by the channels' levels.
+func (a *Apu) ChannelOutputs() [5]float64 {
+	pulse := a.Square1.Sample + a.Square2.Sample
+	tnd := (3 * a.Triangle.Sample) + (2 * a.Noise.Sample)
+
+	share := func(out float64, level, total int16) float64 {
+		if total == 0 {
+			return 0
+		}
+
+		return out * float64(level) / float64(total)
+	}
+
+	return [5]float64{
+		share(a.PulseOut[pulse], a.Square1.Sample, pulse),
+		share(a.PulseOut[pulse], a.Square2.Sample, pulse),
+		share(a.TndOut[tnd], 3*a.Triangle.Sample, tnd),
+		share(a.TndOut[tnd], 2*a.Noise.Sample, tnd),
+		a.ExpansionSample,
+	}
 }
 
 func (a *Apu) PushSample() {
@@ -460,7 +505,12 @@ func (a *Apu) PushSample() {
 	a.Sample = a.RunHipassStrong(a.Sample)
 	a.Sample = a.RunHipassWeak(a.Sample)
 
-	a.Buffer(a.Sample)
+	recordSample(a)
+
+	// Recording carries on while audio output is muted
+	if AudioEnabled {
+		a.Buffer(a.Sample)
+	}
 }
 
 func (a *Apu) FrameSequencerStep() {
@@ -507,6 +557,8 @@ func (a *Apu) RegRead(addr int) (Word, error) {
 }
 
 func (a *Apu) RegWrite(v Word, addr int) {
+	logApuWrite(addr, v)
+
 	switch addr & 0xFF {
 	case 0x0:
 		a.WriteSquare1Control(v)
@@ -0,0 +1,111 @@
+package nes
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Files that can be loaded from inside an archive
+var RomExtensions = []string{".nes", ".nsf", ".nsfe", ".fds", ".unf", ".unif"}
+
+func isRomFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+
+	for _, e := range RomExtensions {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The game's name as used for save files, screenshots and
+// recordings: the file name without its directory or extension
+func RomName(filename string) string {
+	base := filepath.Base(filename)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Reads a ROM either directly or out of a .zip or .gz archive,
+// returning its contents and the name of the file that was read.
+// From a zip the named entry is used, or the first ROM file if
+// entry is empty.
+func ReadRomFile(filename, entry string) ([]byte, string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".zip":
+		return readZipRom(data, entry)
+	case ".gz":
+		return readGzipRom(data, strings.TrimSuffix(filename, filepath.Ext(filename)))
+	}
+
+	return data, filename, nil
+}
+
+func readZipRom(data []byte, entry string) ([]byte, string, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, f := range r.File {
+		if entry != "" {
+			if f.Name != entry && filepath.Base(f.Name) != entry {
+				continue
+			}
+		} else if !isRomFile(f.Name) {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		defer rc.Close()
+
+		rom, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return rom, f.Name, nil
+	}
+
+	if entry != "" {
+		return nil, "", errors.New(fmt.Sprintf("No file named %s in the archive", entry))
+	}
+
+	return nil, "", errors.New("No ROM file found in the archive")
+}
+
+// Gzip only holds the one file, named in the header if the
+// tool that made it bothered
+func readGzipRom(data []byte, filename string) ([]byte, string, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+
+	rom, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if r.Name != "" {
+		filename = r.Name
+	}
+
+	return rom, filename, nil
+}
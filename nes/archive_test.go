@@ -0,0 +1,87 @@
+package nes
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadZipRom(test *testing.T) {
+	dir, err := ioutil.TempDir("", "fergulator")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rom := testRom(1, 1, 0)
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"readme.txt", []byte("Not a ROM")},
+		{"roms/Game (U).nes", rom},
+		{"Other.nes", testRom(2, 0, 0)},
+	} {
+		fw, _ := w.Create(f.name)
+		fw.Write(f.data)
+	}
+	w.Close()
+
+	filename := filepath.Join(dir, "games.zip")
+	ioutil.WriteFile(filename, buf.Bytes(), 0644)
+
+	data, name, err := ReadRomFile(filename, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if name != "roms/Game (U).nes" || !bytes.Equal(data, rom) {
+		test.Errorf("Read %s, expected the first ROM in the archive", name)
+	}
+
+	if n := RomName(name); n != "Game (U)" {
+		test.Errorf("Game name was %q, expected \"Game (U)\"", n)
+	}
+
+	if _, name, _ = ReadRomFile(filename, "Other.nes"); name != "Other.nes" {
+		test.Errorf("Read %s, expected Other.nes", name)
+	}
+
+	if _, _, err = ReadRomFile(filename, "Missing.nes"); err == nil {
+		test.Error("Expected an error for a missing entry")
+	}
+}
+
+func TestReadGzipRom(test *testing.T) {
+	dir, err := ioutil.TempDir("", "fergulator")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rom := testRom(1, 1, 0)
+
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	w.Write(rom)
+	w.Close()
+
+	filename := filepath.Join(dir, "Game.nes.gz")
+	ioutil.WriteFile(filename, buf.Bytes(), 0644)
+
+	data, name, err := ReadRomFile(filename, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if RomName(name) != "Game" || !bytes.Equal(data, rom) {
+		test.Errorf("Read %s, expected Game.nes", name)
+	}
+}
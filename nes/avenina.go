@@ -0,0 +1,79 @@
+package nes
+
+// AVE NINA-03 and NINA-06, mapper 79. The register is
+// anywhere in $4100-$5FFF with A8 set.
+type AveNina struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	// 32k PRG bank and 8k CHR bank
+	PrgBank int
+	ChrBank int
+}
+
+func NewAveNina(r *Nrom) *AveNina {
+	return &AveNina{
+		RomBanks:     r.RomBanks,
+		VromBanks:    r.VromBanks,
+		PrgBankCount: r.PrgBankCount,
+		ChrRomCount:  r.ChrRomCount,
+		Battery:      r.Battery,
+		Data:         r.Data,
+		Chr:          r.Chr,
+	}
+}
+
+func (m *AveNina) Write(v Word, a int) {
+	if a >= 0x8000 {
+		return
+	}
+
+	m.PrgBank = int(v>>3) & 0x1
+	m.ChrBank = int(v & 0x7)
+}
+
+func (m *AveNina) Read(a int) Word {
+	if a < 0x8000 {
+		return 0
+	}
+
+	bank := m.PrgBank*2 + ((a - 0x8000) >> 14)
+	return m.RomBanks[bank%len(m.RomBanks)][a&0x3FFF]
+}
+
+func (m *AveNina) MapsCpuAddress(a int) bool {
+	return a >= 0x4100 && a < 0x6000 && a&0x100 == 0x100
+}
+
+func (m *AveNina) WriteVram(v Word, a int) {
+	bank := m.ChrBank*2 + (a >> 12)
+	m.Chr.WriteBank(v, bank%len(m.VromBanks), 0x1000, a&0xFFF)
+}
+
+func (m *AveNina) ReadVram(a int) Word {
+	bank := m.ChrBank*2 + (a >> 12)
+	return m.VromBanks[bank%len(m.VromBanks)][a&0xFFF]
+}
+
+func (m *AveNina) ReadTile(a int) []Word {
+	bank := m.ChrBank*2 + (a >> 12)
+	a &= 0xFFF
+	return m.VromBanks[bank%len(m.VromBanks)][a : a+16]
+}
+
+func (m *AveNina) BatteryBacked() bool {
+	return m.Battery
+}
+
+func (m *AveNina) SerializeState(s *State) {
+	s.Int(&m.PrgBank)
+	s.Int(&m.ChrBank)
+
+	m.Chr.SerializeState(s)
+}
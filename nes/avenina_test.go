@@ -0,0 +1,24 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestAveNinaBanking(test *testing.T) {
+	loadMapperRom(test, 79, 0, 4, 8)
+
+	// 32k PRG bank 1 and 8k CHR bank 5
+	Ram.Write(0x4100, 0x0D)
+
+	verifyPrgBank(0x8000, 2, test)
+	verifyPrgBank(0xC000, 3, test)
+	verifyChrBank(0x0000, 10, test)
+	verifyChrBank(0x1000, 11, test)
+
+	// The register needs A8 set
+	Ram.Write(0x5000, 0x00)
+	verifyPrgBank(0x8000, 2, test)
+
+	Ram.Write(0x5F00, 0x00)
+	verifyPrgBank(0x8000, 0, test)
+}
@@ -0,0 +1,252 @@
+package nes
+
+import (
+	"fmt"
+)
+
+// Mapper 16 submappers
+const (
+	// FCG-1/2, with registers at $6000-$7FFF
+	BandaiSubmapperFcg = 4
+	// LZ93D50, with registers at $8000-$FFFF and a 24C02
+	BandaiSubmapperLz93d50 = 5
+)
+
+// Bandai FCG-1/2 and LZ93D50, mappers 16, 153, 157 and 159. The
+// LZ93D50 boards either save to a serial EEPROM, read back
+// through $6000-$7FFF, or on mapper 153 to battery backed RAM.
+type Bandai struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	// FCG boards take register writes at $6000-$7FFF
+	// and LZ93D50 boards at $8000-$FFFF. Without a
+	// submapper both are decoded.
+	FcgRegisters     bool
+	Lz93d50Registers bool
+
+	// Mapper 153's work RAM, which is always enabled, and its
+	// 256k outer PRG bank selected by bit 0 of the first four
+	// CHR registers
+	PrgRam       bool
+	PrgOuterBank int
+
+	// 16k bank at $8000, $C000 has the last bank
+	PrgBank  int
+	ChrBanks [8]int
+
+	// The LZ93D50 copies its latch into the counter when
+	// the IRQ is enabled, the FCG writes the counter directly
+	IrqEnabled bool
+	IrqLatch   uint16
+	IrqCounter uint16
+	IrqPending bool
+
+	Eeprom *Eeprom
+}
+
+func NewBandai(r *Nrom) *Bandai {
+	m := &Bandai{
+		RomBanks:     r.RomBanks,
+		PrgBankCount: r.PrgBankCount,
+		ChrRomCount:  r.ChrRomCount,
+		Battery:      r.Battery,
+		Data:         r.Data,
+		Chr:          r.Chr,
+	}
+
+	switch r.Header.Mapper {
+	case 16:
+		switch r.Header.Submapper {
+		case BandaiSubmapperFcg:
+			m.FcgRegisters = true
+		case BandaiSubmapperLz93d50:
+			m.Lz93d50Registers = true
+			m.Eeprom = NewEeprom24c02()
+		default:
+			m.FcgRegisters = true
+			m.Lz93d50Registers = true
+			m.Eeprom = NewEeprom24c02()
+		}
+	case 153:
+		m.Lz93d50Registers = true
+		m.PrgRam = true
+	case 157:
+		// Datach Joint ROM System
+		m.Lz93d50Registers = true
+		m.Eeprom = NewEeprom24c02()
+	case 159:
+		m.Lz93d50Registers = true
+		m.Eeprom = NewEeprom24c01()
+	}
+
+	// CHR is switched in 1k banks
+	m.VromBanks = m.Chr.Banks(0x400)
+
+	fmt.Printf("  CHR banks: %d\n", len(m.VromBanks))
+
+	return m
+}
+
+func (m *Bandai) BatteryBacked() bool {
+	return m.Battery || m.Eeprom != nil
+}
+
+// EEPROM contents are saved after the work RAM
+func (m *Bandai) BatteryData() []Word {
+	if m.Eeprom == nil {
+		return nil
+	}
+
+	return m.Eeprom.Data
+}
+
+func (m *Bandai) MapsCpuAddress(a int) bool {
+	return a >= 0x6000 && !m.PrgRam
+}
+
+func (m *Bandai) Write(v Word, a int) {
+	switch {
+	case a < 0x8000 && !m.FcgRegisters:
+		return
+	case a >= 0x8000 && !m.Lz93d50Registers:
+		return
+	}
+
+	switch reg := a & 0xF; {
+	case reg < 0x8:
+		m.ChrBanks[reg] = int(v)
+
+		if m.PrgRam && reg < 0x4 {
+			m.PrgOuterBank = int(v & 0x1)
+		}
+	case reg == 0x8:
+		m.PrgBank = int(v & 0xF)
+	case reg == 0x9:
+		m.WriteMirroring(v & 0x3)
+	case reg == 0xA:
+		m.IrqEnabled = v&0x1 == 0x1
+		m.IrqPending = false
+
+		if a >= 0x8000 {
+			m.IrqCounter = m.IrqLatch
+		}
+	case reg == 0xB:
+		m.writeIrqCounter(a, m.IrqLatch&0xFF00|uint16(v))
+	case reg == 0xC:
+		m.writeIrqCounter(a, m.IrqLatch&0xFF|uint16(v)<<8)
+	case reg == 0xD:
+		// RSC- ----
+		// |||
+		// ||+- I2C SCL, or work RAM enable on mapper 153
+		// |+-- I2C SDA
+		// +--- I2C read enable
+		if m.Eeprom != nil {
+			m.Eeprom.Write(v&0x20 == 0x20, v&0x40 == 0x40)
+		}
+	}
+}
+
+// The FCG writes the counter itself, and the LZ93D50 the
+// latch it reloads from
+func (m *Bandai) writeIrqCounter(a int, v uint16) {
+	m.IrqLatch = v
+
+	if a < 0x8000 {
+		m.IrqCounter = v
+	}
+}
+
+// $x009
+func (m *Bandai) WriteMirroring(v Word) {
+	switch v {
+	case 0x0:
+		ppu.Nametables.SetMirroring(MirroringVertical)
+	case 0x1:
+		ppu.Nametables.SetMirroring(MirroringHorizontal)
+	case 0x2:
+		ppu.Nametables.SetMirroring(MirroringSingleUpper)
+	case 0x3:
+		ppu.Nametables.SetMirroring(MirroringSingleLower)
+	}
+}
+
+func (m *Bandai) Read(a int) Word {
+	switch {
+	case a < 0x8000:
+		// The EEPROM's data line is on bit 4, the
+		// rest is open bus
+		v := Word(a>>8) & 0xEF
+		if m.Eeprom != nil && m.Eeprom.Read() {
+			v |= 0x10
+		}
+		return v
+	case a >= 0xC000:
+		return m.RomBanks[(m.PrgOuterBank<<4|0xF)%len(m.RomBanks)][a&0x3FFF]
+	}
+
+	return m.RomBanks[(m.PrgOuterBank<<4|m.PrgBank)%len(m.RomBanks)][a&0x3FFF]
+}
+
+func (m *Bandai) chrBank(a int) int {
+	// Boards with CHR-RAM leave it unbanked
+	if m.ChrRomCount == 0 {
+		return a >> 10
+	}
+
+	return m.ChrBanks[a>>10] % len(m.VromBanks)
+}
+
+func (m *Bandai) WriteVram(v Word, a int) {
+	m.Chr.WriteBank(v, m.chrBank(a), 0x400, a&0x3FF)
+}
+
+func (m *Bandai) ReadVram(a int) Word {
+	return m.VromBanks[m.chrBank(a)][a&0x3FF]
+}
+
+func (m *Bandai) ReadTile(a int) []Word {
+	return m.VromBanks[m.chrBank(a)][a&0x3FF : a&0x3FF+16]
+}
+
+func (m *Bandai) Clock(cycles int) {
+	for i := 0; i < cycles; i++ {
+		if !m.IrqEnabled {
+			return
+		}
+
+		// The counter is checked before it's decremented
+		if m.IrqCounter == 0 {
+			m.IrqPending = true
+		}
+
+		m.IrqCounter--
+	}
+}
+
+func (m *Bandai) IrqAsserted() bool {
+	return m.IrqPending
+}
+
+func (m *Bandai) SerializeState(s *State) {
+	s.Int(&m.PrgOuterBank)
+	s.Int(&m.PrgBank)
+	s.Ints(m.ChrBanks[:])
+
+	s.Bool(&m.IrqEnabled)
+	s.Uint16(&m.IrqLatch)
+	s.Uint16(&m.IrqCounter)
+	s.Bool(&m.IrqPending)
+
+	if m.Eeprom != nil {
+		m.Eeprom.SerializeState(s)
+	}
+
+	m.Chr.SerializeState(s)
+}
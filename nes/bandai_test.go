@@ -0,0 +1,210 @@
+package nes
+
+import (
+	"testing"
+)
+
+// Drives the EEPROM lines through $800D
+func i2cLines(scl, sda bool) {
+	var v Word
+	if scl {
+		v |= 0x20
+	}
+
+	if sda {
+		v |= 0x40
+	}
+
+	Ram.Write(0x800D, v)
+}
+
+func i2cStart() {
+	i2cLines(false, true)
+	i2cLines(true, true)
+	i2cLines(true, false)
+	i2cLines(false, false)
+}
+
+func i2cStop() {
+	i2cLines(false, false)
+	i2cLines(true, false)
+	i2cLines(true, true)
+}
+
+// Clocks a bit out, returning SDA as read while SCL is high
+func i2cBit(sda bool) bool {
+	i2cLines(false, sda)
+	i2cLines(true, sda)
+	v, _ := Ram.Read(0x6000)
+	i2cLines(false, sda)
+
+	return v&0x10 == 0x10
+}
+
+// Sends a byte and returns whether it was acknowledged
+func i2cWrite(v Word, lsbFirst bool) bool {
+	for i := uint(0); i < 8; i++ {
+		if lsbFirst {
+			i2cBit(v>>i&0x1 == 0x1)
+		} else {
+			i2cBit(v>>(7-i)&0x1 == 0x1)
+		}
+	}
+
+	return !i2cBit(true)
+}
+
+func i2cRead(lsbFirst bool, ack bool) (v Word) {
+	for i := uint(0); i < 8; i++ {
+		if !i2cBit(true) {
+			continue
+		}
+
+		if lsbFirst {
+			v |= 1 << i
+		} else {
+			v |= 1 << (7 - i)
+		}
+	}
+
+	i2cBit(!ack)
+
+	return
+}
+
+func TestBandaiFcgBanking(test *testing.T) {
+	loadMapperRom(test, 16, BandaiSubmapperFcg, 8, 8)
+
+	Ram.Write(0x6008, 3)
+	verifyPrgBank(0x8000, 3, test)
+	verifyPrgBank(0xC000, 7, test)
+
+	// 1k bank 8 is the start of 4k bank 2
+	Ram.Write(0x6000, 8)
+	Ram.Write(0x6004, 12)
+	verifyChrBank(0x0000, 2, test)
+	verifyChrBank(0x1000, 3, test)
+
+	Ram.Write(0x6009, 0x01)
+	if ppu.Nametables.Mirroring != MirroringHorizontal {
+		test.Error("Mirroring wasn't horizontal")
+	}
+
+	// The LZ93D50's registers aren't decoded
+	Ram.Write(0x8008, 5)
+	verifyPrgBank(0x8000, 3, test)
+}
+
+func TestBandaiIrq(test *testing.T) {
+	m := loadMapperRom(test, 16, BandaiSubmapperLz93d50, 8, 8).(*Bandai)
+
+	// The latch only reaches the counter when enabling
+	Ram.Write(0x800B, 0x02)
+	Ram.Write(0x800C, 0x00)
+	m.Clock(4)
+	if m.IrqAsserted() {
+		test.Error("IRQ fired while disabled")
+	}
+
+	Ram.Write(0x800A, 0x01)
+
+	m.Clock(2)
+	if m.IrqAsserted() {
+		test.Error("IRQ fired early")
+	}
+
+	m.Clock(1)
+	if !m.IrqAsserted() {
+		test.Fatal("IRQ didn't fire when the counter reached 0")
+	}
+
+	Ram.Write(0x800A, 0x00)
+	if m.IrqAsserted() {
+		test.Error("Writing $800A didn't acknowledge the IRQ")
+	}
+}
+
+func TestBandai24c02(test *testing.T) {
+	m := loadMapperRom(test, 16, BandaiSubmapperLz93d50, 8, 8).(*Bandai)
+
+	if !m.BatteryBacked() {
+		test.Error("EEPROM wasn't saved with the battery")
+	}
+
+	// Write two bytes from address $40
+	i2cStart()
+	if !i2cWrite(0xA0, false) {
+		test.Fatal("Device select wasn't acknowledged")
+	}
+	i2cWrite(0x40, false)
+	i2cWrite(0x12, false)
+	i2cWrite(0x34, false)
+	i2cStop()
+
+	if m.Eeprom.Data[0x40] != 0x12 || m.Eeprom.Data[0x41] != 0x34 {
+		test.Fatalf("EEPROM has 0x%X 0x%X, expected 0x12 0x34",
+			m.Eeprom.Data[0x40], m.Eeprom.Data[0x41])
+	}
+
+	// Random read: set the address, then restart for reading
+	i2cStart()
+	i2cWrite(0xA0, false)
+	i2cWrite(0x40, false)
+	i2cStart()
+	i2cWrite(0xA1, false)
+
+	first := i2cRead(false, true)
+	second := i2cRead(false, false)
+	i2cStop()
+
+	if first != 0x12 || second != 0x34 {
+		test.Errorf("Read 0x%X 0x%X, expected 0x12 0x34", first, second)
+	}
+
+	// Another device's select is ignored
+	i2cStart()
+	if i2cWrite(0x50, false) {
+		test.Error("Wrong device select was acknowledged")
+	}
+	i2cStop()
+}
+
+func TestBandai24c01(test *testing.T) {
+	m := loadMapperRom(test, 159, 0, 8, 8).(*Bandai)
+
+	// Address and R/W bit in one byte, LSB first
+	i2cStart()
+	if !i2cWrite(0x05, true) {
+		test.Fatal("Address wasn't acknowledged")
+	}
+	i2cWrite(0xC3, true)
+	i2cStop()
+
+	if m.Eeprom.Data[0x05] != 0xC3 {
+		test.Fatalf("EEPROM has 0x%X, expected 0xC3", m.Eeprom.Data[0x05])
+	}
+
+	i2cStart()
+	i2cWrite(0x85, true)
+	v := i2cRead(true, false)
+	i2cStop()
+
+	if v != 0xC3 {
+		test.Errorf("Read 0x%X, expected 0xC3", v)
+	}
+}
+
+func TestBandaiPrgRam(test *testing.T) {
+	// Mapper 153 has 512k of PRG, switched in two halves
+	loadMapperRom(test, 153, 0, 32, 0)
+
+	Ram.Write(0x8000, 0x01)
+	Ram.Write(0x8008, 0x02)
+	verifyPrgBank(0x8000, 18, test)
+	verifyPrgBank(0xC000, 31, test)
+
+	Ram.Write(0x6000, 0x42)
+	if v, _ := Ram.Read(0x6000); v != 0x42 {
+		test.Error("Work RAM wasn't writable")
+	}
+}
@@ -0,0 +1,111 @@
+package nes
+
+const (
+	BnromSubmapperNina  = 1
+	BnromSubmapperBnrom = 2
+)
+
+// Mapper 34, which is two unrelated boards. BNROM switches
+// 32k of PRG through a latch at $8000-$FFFF. NINA-001 has
+// registers at the top of work RAM that switch PRG and two
+// 4k CHR banks.
+type Bnrom struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	Nina bool
+
+	// 32k PRG bank and 4k CHR banks
+	PrgBank  int
+	ChrBanks [2]int
+}
+
+func NewBnrom(r *Nrom) *Bnrom {
+	m := &Bnrom{
+		RomBanks:     r.RomBanks,
+		VromBanks:    r.VromBanks,
+		PrgBankCount: r.PrgBankCount,
+		ChrRomCount:  r.ChrRomCount,
+		Battery:      r.Battery,
+		Data:         r.Data,
+		Chr:          r.Chr,
+		ChrBanks:     [2]int{0, 1},
+	}
+
+	switch r.Header.Submapper {
+	case BnromSubmapperNina:
+		m.Nina = true
+	case BnromSubmapperBnrom:
+		m.Nina = false
+	default:
+		// BNROM boards only have CHR-RAM
+		m.Nina = r.ChrRomCount > 1
+	}
+
+	return m
+}
+
+func (m *Bnrom) Write(v Word, a int) {
+	if !m.Nina {
+		m.PrgBank = int(busConflict(m, v, a))
+		return
+	}
+
+	// The registers are written through to RAM
+	Ram[a] = v
+
+	switch a {
+	case 0x7FFD:
+		m.PrgBank = int(v & 0x1)
+	case 0x7FFE:
+		m.ChrBanks[0] = int(v & 0xF)
+	case 0x7FFF:
+		m.ChrBanks[1] = int(v & 0xF)
+	}
+}
+
+func (m *Bnrom) Read(a int) Word {
+	if a < 0x8000 {
+		return Ram[a]
+	}
+
+	bank := m.PrgBank*2 + ((a - 0x8000) >> 14)
+	return m.RomBanks[bank%len(m.RomBanks)][a&0x3FFF]
+}
+
+func (m *Bnrom) MapsCpuAddress(a int) bool {
+	return m.Nina && a >= 0x7FFD
+}
+
+func (m *Bnrom) WriteVram(v Word, a int) {
+	bank := m.ChrBanks[a>>12]
+	m.Chr.WriteBank(v, bank%len(m.VromBanks), 0x1000, a&0xFFF)
+}
+
+func (m *Bnrom) ReadVram(a int) Word {
+	bank := m.ChrBanks[a>>12]
+	return m.VromBanks[bank%len(m.VromBanks)][a&0xFFF]
+}
+
+func (m *Bnrom) ReadTile(a int) []Word {
+	bank := m.ChrBanks[a>>12]
+	a &= 0xFFF
+	return m.VromBanks[bank%len(m.VromBanks)][a : a+16]
+}
+
+func (m *Bnrom) BatteryBacked() bool {
+	return m.Battery
+}
+
+func (m *Bnrom) SerializeState(s *State) {
+	s.Int(&m.PrgBank)
+	s.Ints(m.ChrBanks[:])
+
+	m.Chr.SerializeState(s)
+}
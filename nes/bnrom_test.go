@@ -0,0 +1,46 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestBnromBanking(test *testing.T) {
+	loadMapperRom(test, 34, BnromSubmapperBnrom, 8, 0)
+
+	Ram.Write(0x8001, 0x03)
+
+	verifyPrgBank(0x8000, 6, test)
+	verifyPrgBank(0xC000, 7, test)
+
+	// $8000 holds 6, so bank 3 conflicts down to 2
+	Ram.Write(0x8000, 0x03)
+
+	verifyPrgBank(0x8000, 4, test)
+	verifyPrgBank(0xC000, 5, test)
+}
+
+func TestNina001Banking(test *testing.T) {
+	// Without a submapper, CHR-ROM means NINA-001
+	m := loadMapperRom(test, 34, 0, 4, 4)
+
+	if !m.(*Bnrom).Nina {
+		test.Fatal("CHR-ROM didn't select NINA-001")
+	}
+
+	Ram.Write(0x7FFD, 0x01)
+	Ram.Write(0x7FFE, 0x05)
+	Ram.Write(0x7FFF, 0x06)
+
+	verifyPrgBank(0x8000, 2, test)
+	verifyPrgBank(0xC000, 3, test)
+	verifyChrBank(0x0000, 5, test)
+	verifyChrBank(0x1000, 6, test)
+
+	if v, _ := Ram.Read(0x7FFE); v != 0x05 {
+		test.Errorf("Register wasn't written through to RAM, read 0x%X", v)
+	}
+
+	// ROM writes do nothing on NINA-001
+	Ram.Write(0x8001, 0x00)
+	verifyPrgBank(0x8000, 2, test)
+}
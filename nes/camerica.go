@@ -0,0 +1,81 @@
+package nes
+
+const (
+	CamericaSubmapperFireHawk = 1
+)
+
+// Camerica/Codemasters BF909x, mapper 71. UNROM with the
+// register at $C000, and on Fire Hawk's board a single
+// screen mirroring select at $8000-$9FFF.
+type Camerica struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	MirroringSelect bool
+
+	ActiveBank int
+}
+
+func NewCamerica(r *Nrom) *Camerica {
+	return &Camerica{
+		RomBanks:        r.RomBanks,
+		VromBanks:       r.VromBanks,
+		PrgBankCount:    r.PrgBankCount,
+		ChrRomCount:     r.ChrRomCount,
+		Battery:         r.Battery,
+		Data:            r.Data,
+		Chr:             r.Chr,
+		MirroringSelect: r.Header.Submapper == CamericaSubmapperFireHawk,
+	}
+}
+
+func (m *Camerica) Write(v Word, a int) {
+	switch {
+	case a >= 0xC000:
+		m.ActiveBank = int(v&0xF) % len(m.RomBanks)
+	case a < 0xA000 && m.MirroringSelect:
+		if v&0x10 == 0x10 {
+			ppu.Nametables.SetMirroring(MirroringSingleUpper)
+		} else {
+			ppu.Nametables.SetMirroring(MirroringSingleLower)
+		}
+	}
+}
+
+func (m *Camerica) Read(a int) Word {
+	if a >= 0xC000 {
+		return m.RomBanks[len(m.RomBanks)-1][a&0x3FFF]
+	}
+
+	return m.RomBanks[m.ActiveBank][a&0x3FFF]
+}
+
+func (m *Camerica) WriteVram(v Word, a int) {
+	m.Chr.WriteBank(v, (a>>12)%len(m.VromBanks), 0x1000, a&0xFFF)
+}
+
+func (m *Camerica) ReadVram(a int) Word {
+	return m.VromBanks[(a>>12)%len(m.VromBanks)][a&0xFFF]
+}
+
+func (m *Camerica) ReadTile(a int) []Word {
+	bank := (a >> 12) % len(m.VromBanks)
+	a &= 0xFFF
+	return m.VromBanks[bank][a : a+16]
+}
+
+func (m *Camerica) BatteryBacked() bool {
+	return m.Battery
+}
+
+func (m *Camerica) SerializeState(s *State) {
+	s.Int(&m.ActiveBank)
+
+	m.Chr.SerializeState(s)
+}
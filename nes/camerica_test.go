@@ -0,0 +1,39 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestCamericaBanking(test *testing.T) {
+	loadMapperRom(test, 71, 0, 8, 0)
+
+	Ram.Write(0xC001, 0x03)
+
+	verifyPrgBank(0x8000, 3, test)
+	verifyPrgBank(0xC000, 7, test)
+
+	// Only Fire Hawk's board switches mirroring
+	ppu.Nametables.SetMirroring(MirroringVertical)
+	Ram.Write(0x9000, 0x10)
+
+	if ppu.Nametables.Mirroring != MirroringVertical {
+		test.Error("Mirroring changed without the Fire Hawk submapper")
+	}
+}
+
+func TestCamericaFireHawkMirroring(test *testing.T) {
+	loadMapperRom(test, 71, CamericaSubmapperFireHawk, 8, 0)
+
+	Ram.Write(0x9000, 0x10)
+	if ppu.Nametables.Mirroring != MirroringSingleUpper {
+		test.Error("Mirroring wasn't single screen upper")
+	}
+
+	Ram.Write(0x9000, 0x00)
+	if ppu.Nametables.Mirroring != MirroringSingleLower {
+		test.Error("Mirroring wasn't single screen lower")
+	}
+
+	// The bank register is unaffected
+	verifyPrgBank(0x8000, 0, test)
+}
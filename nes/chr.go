@@ -0,0 +1,61 @@
+package nes
+
+// Pattern table memory on the cartridge. Any CHR-ROM comes first,
+// followed by the board's CHR-RAM, and mappers switch both in banks
+// of whatever size they use. Writes to the ROM are ignored.
+type ChrMemory struct {
+	Data    []Word
+	RomSize int
+}
+
+// The total is rounded up to 8k, so that every bank size
+// a mapper uses fits evenly
+func NewChrMemory(rom []byte, ramSize int) *ChrMemory {
+	size := (len(rom) + ramSize + 0x1FFF) &^ 0x1FFF
+	if size == 0 {
+		size = 0x2000
+	}
+
+	c := &ChrMemory{
+		Data:    make([]Word, size),
+		RomSize: len(rom),
+	}
+
+	for i, v := range rom {
+		c.Data[i] = Word(v)
+	}
+
+	return c
+}
+
+// Splits the memory into banks of the given size, which
+// share the memory rather than copying it
+func (c *ChrMemory) Banks(size int) [][]Word {
+	banks := make([][]Word, len(c.Data)/size)
+	for i := range banks {
+		banks[i] = c.Data[i*size : (i+1)*size]
+	}
+
+	return banks
+}
+
+func (c *ChrMemory) Ram() []Word {
+	return c.Data[c.RomSize:]
+}
+
+// Writes to an address within the memory, if it's RAM
+func (c *ChrMemory) Write(v Word, a int) {
+	if a >= c.RomSize && a < len(c.Data) {
+		c.Data[a] = v
+	}
+}
+
+// Writes to an offset within the bank of the given size
+func (c *ChrMemory) WriteBank(v Word, bank int, size int, a int) {
+	c.Write(v, bank*size+a)
+}
+
+// CHR-RAM goes in save states, the ROM doesn't need to
+func (c *ChrMemory) SerializeState(s *State) {
+	s.Words(c.Ram())
+}
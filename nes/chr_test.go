@@ -0,0 +1,69 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestChrRomIgnoresWrites(test *testing.T) {
+	loadMapperRom(test, 0, 0, 1, 1)
+
+	rom.WriteVram(0x55, 0x1000)
+	verifyChrBank(0x1000, 1, test)
+}
+
+func TestChrRam(test *testing.T) {
+	m := loadMapperRom(test, 2, 0, 2, 0).(*Unrom)
+
+	if len(m.Chr.Data) != 0x2000 {
+		test.Errorf("CHR-RAM was %d bytes, expected the default 8k", len(m.Chr.Data))
+	}
+
+	m.WriteVram(0x55, 0x1FFF)
+	if v := m.ReadVram(0x1FFF); v != 0x55 {
+		test.Errorf("CHR-RAM was 0x%X, expected 0x55", v)
+	}
+
+	// And the contents go in save states
+	s := NewSaveState()
+	m.SerializeState(s)
+
+	m.WriteVram(0x00, 0x1FFF)
+
+	m.SerializeState(NewLoadState(s.Data))
+	if v := m.ReadVram(0x1FFF); v != 0x55 {
+		test.Errorf("Restored CHR-RAM was 0x%X, expected 0x55", v)
+	}
+}
+
+func TestChrRamSize(test *testing.T) {
+	initRomTest()
+
+	// 32k of CHR-RAM, as on UNROM-512
+	data := testMapperRom(2, 0, 2, 0)
+	data[11] = 0x09
+
+	m, err := LoadRom(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if c := m.(*Unrom).Chr; len(c.Data) != 0x8000 || len(c.Ram()) != 0x8000 {
+		test.Errorf("CHR-RAM was %d bytes, expected 32k", len(c.Ram()))
+	}
+}
+
+func TestChrRomAndRam(test *testing.T) {
+	c := NewChrMemory(make([]byte, 0x2000), 0x2000)
+
+	c.WriteBank(0x11, 1, 0x1000, 0)
+	c.WriteBank(0x22, 2, 0x1000, 0)
+
+	banks := c.Banks(0x1000)
+	if banks[1][0] != 0x00 {
+		test.Error("CHR-ROM was written")
+	}
+
+	if banks[2][0] != 0x22 {
+		test.Error("CHR-RAM after the ROM wasn't written")
+	}
+}
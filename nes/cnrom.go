@@ -8,11 +8,18 @@ type Cnrom struct {
 	ChrRomCount  int
 	Battery      bool
 	Data         []byte
+	Chr          *ChrMemory
+
+	BusConflicts bool
 
 	ActiveBank int
 }
 
 func (m *Cnrom) Write(v Word, a int) {
+	if m.BusConflicts {
+		v = busConflict(m, v, a)
+	}
+
 	m.ActiveBank = int(v&0x3) * 2
 }
 
@@ -26,11 +33,11 @@ func (m *Cnrom) Read(a int) Word {
 
 func (m *Cnrom) WriteVram(v Word, a int) {
 	if a >= 0x1000 {
-		m.VromBanks[m.ActiveBank+1][a&0xFFF] = v
+		m.Chr.WriteBank(v, m.ActiveBank+1, 0x1000, a&0xFFF)
 		return
 	}
 
-	m.VromBanks[m.ActiveBank][a&0xFFF] = v
+	m.Chr.WriteBank(v, m.ActiveBank, 0x1000, a&0xFFF)
 }
 
 func (m *Cnrom) ReadVram(a int) Word {
@@ -52,3 +59,9 @@ func (m *Cnrom) ReadTile(a int) []Word {
 func (m *Cnrom) BatteryBacked() bool {
 	return m.Battery
 }
+
+func (m *Cnrom) SerializeState(s *State) {
+	s.Int(&m.ActiveBank)
+
+	m.Chr.SerializeState(s)
+}
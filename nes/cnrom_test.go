@@ -0,0 +1,25 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestCnromBusConflicts(test *testing.T) {
+	loadMapperRom(test, 3, SubmapperBusConflicts, 2, 4)
+
+	// $8000 has 0, so bank 1 can't be selected through it
+	Ram.Write(0x8000, 0x01)
+	verifyChrBank(0x0000, 0, test)
+
+	// $C000 starts bank 1
+	Ram.Write(0xC000, 0x03)
+	verifyChrBank(0x0000, 2, test)
+	verifyChrBank(0x1000, 3, test)
+}
+
+func TestCnromWithoutBusConflicts(test *testing.T) {
+	loadMapperRom(test, 3, SubmapperNoBusConflicts, 2, 4)
+
+	Ram.Write(0x8000, 0x01)
+	verifyChrBank(0x0000, 2, test)
+}
@@ -0,0 +1,23 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestColorDreamsBanking(test *testing.T) {
+	loadMapperRom(test, 11, 0, 8, 8)
+
+	// 32k PRG bank 1 and 8k CHR bank 3
+	Ram.Write(0x8001, 0x31)
+
+	verifyPrgBank(0x8000, 2, test)
+	verifyPrgBank(0xC000, 3, test)
+	verifyChrBank(0x0000, 6, test)
+	verifyChrBank(0x1000, 7, test)
+
+	// $8000 holds 2, so only PRG bank 2 survives the conflict
+	Ram.Write(0x8000, 0x33)
+
+	verifyPrgBank(0x8000, 4, test)
+	verifyChrBank(0x0000, 0, test)
+}
@@ -0,0 +1,208 @@
+package nes
+
+// What the EEPROM expects on its next clocks
+const (
+	EepromIdle = iota
+	// The 24C02's device select byte
+	EepromDevice
+	EepromAddress
+	EepromWrite
+	EepromRead
+)
+
+// Serial EEPROM on an I2C bus, driven a bit at a time by the
+// mapper setting the clock and data lines. The 24C02 follows the
+// I2C protocol, with a device select byte before the word address.
+// The 24C01 has no device select, takes a 7 bit address and the
+// read/write bit as its first byte, and shifts bits LSB first.
+type Eeprom struct {
+	Data     []Word
+	X24c01   bool
+	PageSize int
+
+	// Lines as last driven by the mapper
+	Scl bool
+	Sda bool
+
+	State   int
+	Bit     int
+	Shift   Word
+	Address int
+
+	// Whether the byte being clocked is the EEPROM's. The
+	// state can change to reading before the last received
+	// byte is acknowledged.
+	Sending bool
+
+	// The EEPROM's own drive of SDA. It only ever pulls the
+	// line low, for acknowledgements and 0 bits
+	Output bool
+}
+
+func NewEeprom24c01() *Eeprom {
+	return &Eeprom{
+		Data:     make([]Word, 0x80),
+		X24c01:   true,
+		PageSize: 4,
+		Output:   true,
+	}
+}
+
+func NewEeprom24c02() *Eeprom {
+	return &Eeprom{
+		Data:     make([]Word, 0x100),
+		PageSize: 8,
+		Output:   true,
+	}
+}
+
+func (e *Eeprom) Write(scl, sda bool) {
+	switch {
+	case e.Scl && scl && e.Sda && !sda:
+		e.start()
+	case e.Scl && scl && !e.Sda && sda:
+		e.stop()
+	case !e.Scl && scl:
+		e.rise(sda)
+	case e.Scl && !scl:
+		e.fall()
+	}
+
+	e.Scl = scl
+	e.Sda = sda
+}
+
+// SDA as seen on the bus
+func (e *Eeprom) Read() bool {
+	return e.Output
+}
+
+// SDA falling while SCL is high
+func (e *Eeprom) start() {
+	e.State = EepromDevice
+	if e.X24c01 {
+		e.State = EepromAddress
+	}
+
+	e.Bit = 0
+	e.Shift = 0
+	e.Sending = false
+	e.Output = true
+}
+
+// SDA rising while SCL is high
+func (e *Eeprom) stop() {
+	e.State = EepromIdle
+	e.Output = true
+}
+
+// The master's bits, and its acknowledgement of the bytes
+// the EEPROM sends, are sampled as SCL rises
+func (e *Eeprom) rise(sda bool) {
+	if e.State == EepromIdle {
+		return
+	}
+
+	switch {
+	case e.Bit == 8 && e.Sending && sda:
+		// No acknowledgement, so the master is done reading
+		e.State = EepromIdle
+	case e.Bit < 8 && !e.Sending:
+		var bit Word
+		if sda {
+			bit = 1
+		}
+
+		if e.X24c01 {
+			e.Shift |= bit << uint(e.Bit)
+		} else {
+			e.Shift = e.Shift<<1 | bit
+		}
+	}
+
+	e.Bit++
+}
+
+// The EEPROM changes what it drives on SDA while SCL is low
+func (e *Eeprom) fall() {
+	if e.State == EepromIdle {
+		e.Output = true
+		return
+	}
+
+	switch {
+	case e.Bit == 8 && e.Sending:
+		// Let go of the line for the master's acknowledgement
+		e.Output = true
+	case e.Bit == 8:
+		e.receive(e.Shift)
+
+		// Acknowledge, unless the byte wasn't for us
+		e.Output = e.State == EepromIdle
+	case e.Bit == 9:
+		e.Bit = 0
+		e.Shift = 0
+		e.Sending = e.State == EepromRead
+		e.Output = true
+
+		if e.Sending {
+			e.Shift = e.Data[e.Address]
+			e.Address = (e.Address + 1) % len(e.Data)
+			e.Output = e.bit(0)
+		}
+	case e.Sending:
+		e.Output = e.bit(e.Bit)
+	}
+}
+
+func (e *Eeprom) bit(n int) bool {
+	if !e.X24c01 {
+		n = 7 - n
+	}
+
+	return e.Shift>>uint(n)&0x1 == 0x1
+}
+
+func (e *Eeprom) receive(v Word) {
+	switch e.State {
+	case EepromDevice:
+		switch {
+		case v&0xF0 != 0xA0:
+			e.State = EepromIdle
+		case v&0x1 == 0x1:
+			e.State = EepromRead
+		default:
+			e.State = EepromAddress
+		}
+	case EepromAddress:
+		if e.X24c01 {
+			e.Address = int(v & 0x7F)
+			if v&0x80 == 0x80 {
+				e.State = EepromRead
+				return
+			}
+		} else {
+			e.Address = int(v)
+		}
+
+		e.State = EepromWrite
+	case EepromWrite:
+		e.Data[e.Address] = v
+
+		// Writes wrap around within the page
+		page := e.Address &^ (e.PageSize - 1)
+		e.Address = page | (e.Address+1)&(e.PageSize-1)
+	}
+}
+
+func (e *Eeprom) SerializeState(s *State) {
+	s.Words(e.Data)
+	s.Bool(&e.Scl)
+	s.Bool(&e.Sda)
+	s.Int(&e.State)
+	s.Int(&e.Bit)
+	s.Word(&e.Shift)
+	s.Int(&e.Address)
+	s.Bool(&e.Sending)
+	s.Bool(&e.Output)
+}
@@ -85,6 +85,28 @@ func (handler *JsEventHandler) Handle(event string) {
 
 			return otto.Value{}
 		},
+		"screenshot": func(call otto.FunctionCall) otto.Value {
+			TakeScreenshot()
+			return otto.Value{}
+		},
+		"diskSide": func(call otto.FunctionCall) otto.Value {
+			side, _ := handler.vm.ToValue(DiskSide())
+			return side
+		},
+		"insertDisk": func(call otto.FunctionCall) otto.Value {
+			side, _ := call.Argument(0).ToInteger()
+
+			InsertDisk(int(side))
+			return otto.Value{}
+		},
+		"ejectDisk": func(call otto.FunctionCall) otto.Value {
+			EjectDisk()
+			return otto.Value{}
+		},
+		"switchDiskSide": func(call otto.FunctionCall) otto.Value {
+			SwitchDiskSide()
+			return otto.Value{}
+		},
 	}
 
 	ottoState, _ := handler.vm.ToValue(state)
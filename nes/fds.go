@@ -0,0 +1,728 @@
+package nes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+const (
+	FdsSideSize   = 65500
+	FdsHeaderSize = 16
+	FdsBiosSize   = 0x2000
+
+	FdsNoDisk = -1
+
+	// Gaps, in bytes, before the first block on a side and
+	// after each block
+	FdsLeadingGap = 28300 / 8
+	FdsBlockGap   = 976 / 8
+
+	// CPU cycles for each byte passing under the head, and for
+	// the head to return to the start of the disk
+	FdsByteCycles   = 150
+	FdsRewindCycles = 50000
+
+	// How long a disk stays out of the drive when switching sides
+	FdsSwapCycles = 1789773
+)
+
+var (
+	// The RAM adapter's BIOS, which isn't included with disk images
+	FdsBiosFile = "disksys.rom"
+
+	// Writes to the disk are kept here as an IPS patch
+	// against the original image
+	DiskDiffFile string
+)
+
+type Fds struct {
+	Bios   []Word
+	PrgRam []Word
+	ChrRam []Word
+
+	// Each side with the gaps and block markers a real drive
+	// sees, and as they were when loaded
+	Sides    [][]byte
+	Original [][]byte
+	Dirty    bool
+
+	Disk         int
+	LastDisk     int
+	PendingDisk  int
+	InsertCycles int
+
+	DiskRegEnabled  bool
+	SoundRegEnabled bool
+
+	IrqReload  int
+	IrqCounter int
+	IrqRepeat  bool
+	IrqEnabled bool
+	TimerIrq   bool
+	DiskIrq    bool
+
+	MotorOn          bool
+	ResetTransfer    bool
+	ReadMode         bool
+	CrcControl       bool
+	DiskReady        bool
+	DiskIrqEnabled   bool
+	ScanningDisk     bool
+	EndOfHead        bool
+	GapEnded         bool
+	TransferComplete bool
+	PreviousCrc      bool
+
+	Position int
+	Delay    int
+	Crc      int
+
+	ReadData  Word
+	WriteData Word
+	ExtPort   Word
+
+	Audio *FdsAudio
+}
+
+func IsFds(data []byte) bool {
+	if len(data) >= 4 && string(data[0:4]) == "FDS\x1a" {
+		return true
+	}
+
+	return len(data) >= 15 && data[0] == 0x01 && string(data[1:15]) == "*NINTENDO-HVC*"
+}
+
+// Loads a disk image, with or without the fwNES header, along
+// with the BIOS and any writes saved from last time
+func LoadFds(data []byte) (*Fds, error) {
+	bios, err := ioutil.ReadFile(FdsBiosFile)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("The FDS BIOS is needed to play disk images: %s", err.Error()))
+	}
+
+	if len(bios) < FdsBiosSize {
+		return nil, errors.New(fmt.Sprintf("FDS BIOS is %d bytes, expected 8192", len(bios)))
+	}
+
+	if bytes.HasPrefix(data, []byte("FDS\x1a")) {
+		if len(data) < FdsHeaderSize {
+			return nil, errors.New("Invalid FDS file")
+		}
+
+		data = data[FdsHeaderSize:]
+	}
+
+	sides := len(data) / FdsSideSize
+	if sides == 0 {
+		return nil, errors.New(fmt.Sprintf("FDS image is truncated: %d bytes is less than one disk side", len(data)))
+	}
+
+	m := &Fds{
+		Bios:        make([]Word, FdsBiosSize),
+		PrgRam:      make([]Word, 0x8000),
+		ChrRam:      make([]Word, 0x2000),
+		Disk:        0,
+		PendingDisk: FdsNoDisk,
+		EndOfHead:   true,
+		Audio:       NewFdsAudio(),
+	}
+
+	for i, v := range bios[:FdsBiosSize] {
+		m.Bios[i] = Word(v)
+	}
+
+	for i := 0; i < sides; i++ {
+		side := fdsAddGaps(data[i*FdsSideSize : (i+1)*FdsSideSize])
+
+		m.Sides = append(m.Sides, side)
+		m.Original = append(m.Original, append([]byte(nil), side...))
+	}
+
+	fmt.Printf("-----------------\nFDS:\n  Sides: %d\n-----------------\n", sides)
+
+	m.loadDiff()
+
+	ppu.Nametables.SetMirroring(MirroringHorizontal)
+	apu.Expansion = append(apu.Expansion, m.Audio)
+
+	return m, nil
+}
+
+// Disk images only hold the blocks themselves, so the gaps and the
+// marker that starts each block are put back. The CRCs aren't
+// checked so any value will do.
+func fdsAddGaps(raw []byte) []byte {
+	side := make([]byte, FdsLeadingGap)
+
+	i := 0
+	for i < len(raw) {
+		size := 0
+
+		switch raw[i] {
+		case 1:
+			// Disk info
+			size = 56
+		case 2:
+			// File count
+			size = 2
+		case 3:
+			// File header
+			size = 16
+		case 4:
+			// File data, sized by the header before it
+			if i >= 3 {
+				size = 1 + int(raw[i-3]) + int(raw[i-2])<<8
+			}
+		}
+
+		if size == 0 || i+size > len(raw) {
+			break
+		}
+
+		side = append(side, 0x80)
+		side = append(side, raw[i:i+size]...)
+		side = append(side, 0x00, 0x00)
+		side = append(side, make([]byte, FdsBlockGap)...)
+
+		i += size
+	}
+
+	// Keep the unused space so there's room to save
+	return append(side, make([]byte, len(raw)-i)...)
+}
+
+func (m *Fds) image(sides [][]byte) []byte {
+	return bytes.Join(sides, nil)
+}
+
+func (m *Fds) loadDiff() {
+	if DiskDiffFile == "" {
+		return
+	}
+
+	patch, err := ioutil.ReadFile(DiskDiffFile)
+	if err != nil {
+		return
+	}
+
+	original := m.image(m.Original)
+
+	image, err := ApplyIps(original, patch)
+	if err != nil {
+		fmt.Println("Couldn't load saved disk writes:", err.Error())
+		return
+	}
+
+	// A patch can truncate the image, which would leave
+	// the later sides with nothing to load
+	if len(image) < len(original) {
+		fmt.Printf("Couldn't load saved disk writes: the image was truncated to %d bytes\n", len(image))
+		return
+	}
+
+	for _, side := range m.Sides {
+		copy(side, image)
+		image = image[len(side):]
+	}
+
+	fmt.Println("Loaded saved disk writes from", DiskDiffFile)
+}
+
+func (m *Fds) saveDiff() {
+	m.Dirty = false
+
+	if DiskDiffFile == "" {
+		return
+	}
+
+	patch := MakeIps(m.image(m.Original), m.image(m.Sides))
+
+	if err := ioutil.WriteFile(DiskDiffFile, patch, 0644); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	fmt.Println("Disk writes saved to", DiskDiffFile)
+}
+
+func (m *Fds) BatteryBacked() bool {
+	return false
+}
+
+// Disk and audio registers, and PRG-RAM
+func (m *Fds) MapsCpuAddress(a int) bool {
+	return true
+}
+
+func (m *Fds) Write(v Word, a int) {
+	switch {
+	case a == 0x4020:
+		m.IrqReload = (m.IrqReload & 0xFF00) | int(v)
+	case a == 0x4021:
+		m.IrqReload = (m.IrqReload & 0xFF) | int(v)<<8
+	case a == 0x4022:
+		m.IrqRepeat = v&0x1 == 0x1
+		m.IrqEnabled = v&0x2 == 0x2 && m.DiskRegEnabled
+
+		if m.IrqEnabled {
+			m.IrqCounter = m.IrqReload
+		} else {
+			m.TimerIrq = false
+		}
+	case a == 0x4023:
+		m.DiskRegEnabled = v&0x1 == 0x1
+		m.SoundRegEnabled = v&0x2 == 0x2
+
+		if !m.DiskRegEnabled {
+			m.IrqEnabled = false
+			m.TimerIrq = false
+			m.DiskIrq = false
+		}
+	case a == 0x4024 && m.DiskRegEnabled:
+		m.WriteData = v
+		m.TransferComplete = false
+		m.DiskIrq = false
+	case a == 0x4025 && m.DiskRegEnabled:
+		m.writeControl(v)
+	case a == 0x4026 && m.DiskRegEnabled:
+		m.ExtPort = v
+	case a >= 0x4040 && a <= 0x408A:
+		if m.SoundRegEnabled {
+			m.Audio.Write(v, a)
+		}
+	case a >= 0x6000 && a < 0xE000:
+		m.PrgRam[a-0x6000] = v
+	}
+}
+
+func (m *Fds) writeControl(v Word) {
+	// IRSC BEWT
+	// |||| |||+- Motor on
+	// |||| ||+-- Reset transfer
+	// |||| |+--- Read mode (0: write)
+	// |||| +---- Mirroring (1: horizontal)
+	// |||+------ CRC control
+	// ||+------- Always 1
+	// |+-------- Disk ready
+	// +--------- Disk IRQ enabled
+	readMode := v&0x4 == 0x4
+
+	// The end of a write is a good time to save
+	if readMode && !m.ReadMode && m.Dirty {
+		m.saveDiff()
+	}
+
+	m.MotorOn = v&0x1 == 0x1
+	m.ResetTransfer = v&0x2 == 0x2
+	m.ReadMode = readMode
+	m.CrcControl = v&0x10 == 0x10
+	m.DiskReady = v&0x40 == 0x40
+	m.DiskIrqEnabled = v&0x80 == 0x80
+
+	if v&0x8 == 0x8 {
+		ppu.Nametables.SetMirroring(MirroringHorizontal)
+	} else {
+		ppu.Nametables.SetMirroring(MirroringVertical)
+	}
+
+	m.DiskIrq = false
+}
+
+func (m *Fds) Read(a int) Word {
+	switch {
+	case a == 0x4030:
+		// Timer IRQ, transfer complete and end of head
+		var v Word
+		if m.TimerIrq {
+			v |= 0x1
+		}
+
+		if m.TransferComplete {
+			v |= 0x2
+		}
+
+		if m.EndOfHead {
+			v |= 0x40
+		}
+
+		m.TransferComplete = false
+		m.TimerIrq = false
+		m.DiskIrq = false
+
+		return v
+	case a == 0x4031:
+		m.TransferComplete = false
+		m.DiskIrq = false
+
+		return m.ReadData
+	case a == 0x4032:
+		// Disk missing, not ready and write protected
+		v := Word(0x40)
+		if m.Disk == FdsNoDisk {
+			v |= 0x5
+		}
+
+		if m.Disk == FdsNoDisk || !m.ScanningDisk {
+			v |= 0x2
+		}
+
+		return v
+	case a == 0x4033:
+		// Battery is good
+		return 0x80 | (m.ExtPort & 0x7F)
+	case a >= 0x4040 && a <= 0x4092:
+		return m.Audio.Read(a)
+	case a >= 0x6000 && a < 0xE000:
+		return m.PrgRam[a-0x6000]
+	case a >= 0xE000:
+		return m.Bios[a-0xE000]
+	}
+
+	return 0
+}
+
+func (m *Fds) WriteVram(v Word, a int) {
+	m.ChrRam[a&0x1FFF] = v
+}
+
+func (m *Fds) ReadVram(a int) Word {
+	return m.ChrRam[a&0x1FFF]
+}
+
+func (m *Fds) ReadTile(a int) []Word {
+	return m.ChrRam[a : a+16]
+}
+
+// Both IRQ sources hold the line until they're acknowledged
+func (m *Fds) IrqAsserted() bool {
+	return m.TimerIrq || m.DiskIrq
+}
+
+func (m *Fds) Clock(cycles int) {
+	for i := 0; i < cycles; i++ {
+		m.clockTimer()
+		m.clockDisk()
+		m.Audio.Clock()
+	}
+}
+
+func (m *Fds) clockTimer() {
+	if !m.IrqEnabled {
+		return
+	}
+
+	if m.IrqCounter == 0 {
+		m.TimerIrq = true
+		m.IrqCounter = m.IrqReload
+
+		if !m.IrqRepeat {
+			m.IrqEnabled = false
+		}
+	} else {
+		m.IrqCounter--
+	}
+}
+
+// A new byte passes under the head every 150 cycles
+func (m *Fds) clockDisk() {
+	if m.InsertCycles > 0 {
+		m.InsertCycles--
+		if m.InsertCycles == 0 {
+			m.Insert(m.PendingDisk)
+		}
+	}
+
+	if m.Disk == FdsNoDisk || !m.MotorOn {
+		m.EndOfHead = true
+		m.ScanningDisk = false
+		return
+	}
+
+	if m.ResetTransfer && !m.ScanningDisk {
+		return
+	}
+
+	if m.EndOfHead {
+		m.Delay = FdsRewindCycles
+		m.EndOfHead = false
+		m.Position = 0
+		m.GapEnded = false
+		return
+	}
+
+	if m.Delay > 0 {
+		m.Delay--
+		return
+	}
+
+	m.ScanningDisk = true
+
+	side := m.Sides[m.Disk]
+	irq := m.DiskIrqEnabled
+
+	if m.ReadMode {
+		v := side[m.Position]
+
+		if !m.PreviousCrc {
+			m.updateCrc(v)
+		}
+
+		if !m.DiskReady {
+			m.GapEnded = false
+			m.Crc = 0
+		} else if v != 0 && !m.GapEnded {
+			// The block marker ends the gap, but isn't read
+			m.GapEnded = true
+			irq = false
+		}
+
+		if m.GapEnded {
+			m.TransferComplete = true
+			m.ReadData = Word(v)
+
+			if irq {
+				m.DiskIrq = true
+			}
+		}
+	} else {
+		var v byte
+
+		if !m.CrcControl {
+			m.TransferComplete = true
+			v = byte(m.WriteData)
+
+			if irq {
+				m.DiskIrq = true
+			}
+		}
+
+		if !m.DiskReady {
+			v = 0
+		}
+
+		if !m.CrcControl {
+			m.updateCrc(v)
+		} else {
+			if !m.PreviousCrc {
+				m.updateCrc(0)
+				m.updateCrc(0)
+			}
+
+			v = byte(m.Crc)
+			m.Crc >>= 8
+		}
+
+		// The write head trails the read head
+		if m.Position >= 2 {
+			side[m.Position-2] = v
+			m.Dirty = true
+		}
+
+		m.GapEnded = false
+	}
+
+	m.PreviousCrc = m.CrcControl
+
+	m.Position++
+	if m.Position >= len(side) {
+		m.MotorOn = false
+		m.EndOfHead = true
+	} else {
+		// Including this cycle
+		m.Delay = FdsByteCycles - 1
+	}
+}
+
+func (m *Fds) updateCrc(v byte) {
+	for n := uint(0); n < 8; n++ {
+		carry := m.Crc & 0x1
+		m.Crc >>= 1
+
+		if carry == 0x1 {
+			m.Crc ^= 0x8408
+		}
+
+		if v&(1<<n) != 0 {
+			m.Crc ^= 0x8000
+		}
+	}
+}
+
+func (m *Fds) Eject() {
+	if m.Dirty {
+		m.saveDiff()
+	}
+
+	if m.Disk != FdsNoDisk {
+		m.LastDisk = m.Disk
+	}
+
+	m.Disk = FdsNoDisk
+	m.PendingDisk = FdsNoDisk
+	m.InsertCycles = 0
+
+	fmt.Println("Disk ejected")
+}
+
+func (m *Fds) Insert(side int) {
+	if side < 0 || side >= len(m.Sides) {
+		return
+	}
+
+	m.Disk = side
+	m.PendingDisk = FdsNoDisk
+	m.InsertCycles = 0
+
+	fmt.Printf("Disk %d side %c inserted\n", (side/2)+1, 'A'+(side%2))
+}
+
+// Takes the disk out, then puts the next side in once the
+// BIOS has had a chance to notice it's gone
+func (m *Fds) SwitchSide() {
+	current := m.Disk
+	if current == FdsNoDisk {
+		current = m.LastDisk
+	}
+
+	if m.PendingDisk != FdsNoDisk {
+		current = m.PendingDisk
+	}
+
+	next := (current + 1) % len(m.Sides)
+
+	m.Eject()
+
+	m.PendingDisk = next
+	m.InsertCycles = FdsSwapCycles
+
+	fmt.Printf("Inserting disk %d side %c\n", (next/2)+1, 'A'+(next%2))
+}
+
+// The BIOS restarts the drive after a reset, so
+// it's stopped and any pending IRQs dropped
+func (m *Fds) Reset() {
+	m.IrqEnabled = false
+	m.TimerIrq = false
+	m.DiskIrq = false
+	m.DiskIrqEnabled = false
+
+	m.MotorOn = false
+	m.ScanningDisk = false
+	m.TransferComplete = false
+}
+
+// The disk is saved along with which side is in the drive
+// and where the head is, since games write to it
+func (m *Fds) SerializeState(s *State) {
+	s.Words(m.PrgRam)
+	s.Words(m.ChrRam)
+
+	for _, side := range m.Sides {
+		s.Bytes(side)
+	}
+
+	// What was loaded may not match the saved disk writes
+	if s.Loading {
+		m.Dirty = true
+	}
+
+	s.Int(&m.Disk)
+	s.Int(&m.LastDisk)
+	s.Int(&m.PendingDisk)
+	s.Int(&m.InsertCycles)
+
+	s.Bool(&m.DiskRegEnabled)
+	s.Bool(&m.SoundRegEnabled)
+
+	s.Int(&m.IrqReload)
+	s.Int(&m.IrqCounter)
+	s.Bool(&m.IrqRepeat)
+	s.Bool(&m.IrqEnabled)
+	s.Bool(&m.TimerIrq)
+	s.Bool(&m.DiskIrq)
+
+	s.Bool(&m.MotorOn)
+	s.Bool(&m.ResetTransfer)
+	s.Bool(&m.ReadMode)
+	s.Bool(&m.CrcControl)
+	s.Bool(&m.DiskReady)
+	s.Bool(&m.DiskIrqEnabled)
+	s.Bool(&m.ScanningDisk)
+	s.Bool(&m.EndOfHead)
+	s.Bool(&m.GapEnded)
+	s.Bool(&m.TransferComplete)
+	s.Bool(&m.PreviousCrc)
+
+	s.Int(&m.Position)
+	s.Int(&m.Delay)
+	s.Int(&m.Crc)
+
+	s.Word(&m.ReadData)
+	s.Word(&m.WriteData)
+	s.Word(&m.ExtPort)
+
+	if m.Disk >= len(m.Sides) || m.Disk < FdsNoDisk {
+		m.Disk = FdsNoDisk
+	}
+
+	if m.LastDisk >= len(m.Sides) || m.LastDisk < 0 {
+		m.LastDisk = 0
+	}
+
+	if m.PendingDisk >= len(m.Sides) || m.PendingDisk < FdsNoDisk {
+		m.PendingDisk = FdsNoDisk
+	}
+
+	if m.Disk != FdsNoDisk && (m.Position < 0 || m.Position >= len(m.Sides[m.Disk])) {
+		m.Position = 0
+	}
+}
+
+func (m *Fds) InsertedSide() int {
+	return m.Disk
+}
+
+func (m *Fds) EjectedSide() int {
+	return m.LastDisk
+}
+
+func EjectDisk() {
+	if m, ok := rom.(DiskDrive); ok {
+		m.Eject()
+	}
+}
+
+func InsertDisk(side int) {
+	if m, ok := rom.(DiskDrive); ok {
+		m.Insert(side)
+	}
+}
+
+func SwitchDiskSide() {
+	if m, ok := rom.(DiskDrive); ok {
+		m.SwitchSide()
+	}
+}
+
+// Ejects the disk if there is one, otherwise puts the last
+// disk back in
+func ToggleDisk() {
+	if m, ok := rom.(DiskDrive); ok {
+		if m.InsertedSide() == FdsNoDisk {
+			m.Insert(m.EjectedSide())
+		} else {
+			m.Eject()
+		}
+	}
+}
+
+// The side in the drive, or FdsNoDisk
+func DiskSide() int {
+	if m, ok := rom.(DiskDrive); ok {
+		return m.InsertedSide()
+	}
+
+	return FdsNoDisk
+}
@@ -0,0 +1,288 @@
+package nes
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// One side with a disk info block, a file count, and
+// a file header followed by four bytes of data
+func testFdsSide(data []byte) []byte {
+	side := make([]byte, FdsSideSize)
+
+	side[0] = 0x01
+	copy(side[1:], "*NINTENDO-HVC*")
+	side[56] = 0x02
+	side[57] = 0x01
+	side[58] = 0x03
+	side[58+13] = byte(len(data))
+	side[74] = 0x04
+	copy(side[75:], data)
+
+	return side
+}
+
+func initFdsTest(test *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "fergulator")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bios := make([]byte, FdsBiosSize)
+	bios[0x1FFC] = 0x34
+	bios[0x1FFD] = 0x12
+
+	FdsBiosFile = filepath.Join(dir, "disksys.rom")
+	ioutil.WriteFile(FdsBiosFile, bios, 0644)
+
+	DiskDiffFile = filepath.Join(dir, "game.fds.ips")
+
+	initRomTest()
+	cpu.Init()
+
+	return dir, func() {
+		os.RemoveAll(dir)
+		FdsBiosFile = "disksys.rom"
+		DiskDiffFile = ""
+	}
+}
+
+// Runs the drive until the next byte is transferred, which
+// can mean rewinding and passing over the leading gap
+func nextFdsByte(test *testing.T, m *Fds) {
+	for i := 0; i < FdsRewindCycles+FdsByteCycles*(FdsLeadingGap+2); i++ {
+		m.Clock(1)
+
+		if m.DiskIrq {
+			return
+		}
+	}
+
+	test.Fatal("Timed out waiting for a disk transfer")
+}
+
+func TestFdsLoad(test *testing.T) {
+	_, done := initFdsTest(test)
+	defer done()
+
+	raw := append(testFdsSide([]byte{1, 2, 3, 4}), testFdsSide(nil)...)
+	if !IsFds(raw) {
+		test.Fatal("Headerless image wasn't recognized")
+	}
+
+	header := make([]byte, FdsHeaderSize)
+	copy(header, "FDS\x1a")
+	header[4] = 2
+
+	m, err := LoadFds(append(header, raw...))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(m.Sides) != 2 {
+		test.Fatalf("Loaded %d sides, expected 2", len(m.Sides))
+	}
+
+	// Each block starts with a gap and a marker
+	side := m.Sides[0]
+	if side[FdsLeadingGap] != 0x80 || side[FdsLeadingGap+1] != 0x01 {
+		test.Errorf("Disk info block wasn't found after the leading gap")
+	}
+
+	file := FdsLeadingGap + (57 + 2 + FdsBlockGap) + (3 + 2 + FdsBlockGap) + (17 + 2 + FdsBlockGap)
+	if !bytes.Equal(side[file:file+6], []byte{0x80, 0x04, 1, 2, 3, 4}) {
+		test.Errorf("File data block was % X", side[file:file+6])
+	}
+
+	rom = m
+	if v, _ := Ram.Read(0xFFFD); v != 0x12 {
+		test.Errorf("0xFFFD was 0x%X, expected the BIOS's 0x12", v)
+	}
+
+	Ram.Write(0xD000, 0xAB)
+	if v, _ := Ram.Read(0xD000); v != 0xAB {
+		test.Errorf("0xD000 was 0x%X, expected PRG-RAM", v)
+	}
+
+	if _, err := LoadFds(raw[:FdsSideSize-1]); err == nil {
+		test.Errorf("Truncated image should fail")
+	}
+}
+
+func TestFdsDisk(test *testing.T) {
+	_, done := initFdsTest(test)
+	defer done()
+
+	m, err := LoadFds(testFdsSide([]byte{1, 2, 3, 4}))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rom = m
+
+	// Enable disk I/O, then start the motor in read mode
+	// with the disk IRQ enabled
+	Ram.Write(0x4023, 0x01)
+	Ram.Write(0x4025, 0xE5)
+
+	for i, expected := range []byte("\x01*NINTENDO-HVC*") {
+		nextFdsByte(test, m)
+
+		if !m.IrqAsserted() {
+			test.Fatal("Disk transfer didn't assert the IRQ line")
+		}
+
+		if v, _ := Ram.Read(0x4031); v != Word(expected) {
+			test.Errorf("Byte %d was 0x%X, expected 0x%X", i, v, expected)
+		}
+
+		if m.DiskIrq {
+			test.Error("Reading $4031 didn't acknowledge the IRQ")
+		}
+	}
+
+	// Switch to write mode and write three bytes, which land
+	// two bytes behind the read head
+	Ram.Write(0x4025, 0xE1)
+	for _, v := range []Word{0x55, 0x66, 0x77} {
+		Ram.Write(0x4024, v)
+		nextFdsByte(test, m)
+	}
+
+	written := m.Position - 5
+	Ram.Write(0x4025, 0xE5)
+
+	if m.Sides[0][written] != 0x55 || m.Sides[0][written+1] != 0x66 {
+		test.Errorf("Disk wasn't written: % X", m.Sides[0][written:written+2])
+	}
+
+	// Writes are saved, and applied when the disk is loaded again
+	m, err = LoadFds(testFdsSide([]byte{1, 2, 3, 4}))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if m.Sides[0][written] != 0x55 || m.Sides[0][written+1] != 0x66 {
+		test.Errorf("Saved writes weren't loaded: % X", m.Sides[0][written:written+2])
+	}
+
+	if m.Original[0][written] == 0x55 {
+		test.Error("The original image was modified")
+	}
+}
+
+func TestFdsTimerIrq(test *testing.T) {
+	_, done := initFdsTest(test)
+	defer done()
+
+	m, err := LoadFds(testFdsSide(nil))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rom = m
+
+	Ram.Write(0x4023, 0x01)
+	Ram.Write(0x4020, 0x10)
+	Ram.Write(0x4021, 0x00)
+	Ram.Write(0x4022, 0x02)
+
+	m.Clock(0x10)
+	if m.TimerIrq {
+		test.Error("Timer IRQ fired early")
+	}
+
+	m.Clock(1)
+	if !m.TimerIrq || !m.IrqAsserted() {
+		test.Fatal("Timer IRQ didn't fire")
+	}
+
+	if v, _ := Ram.Read(0x4030); v&0x1 != 0x1 {
+		test.Error("$4030 didn't report the timer IRQ")
+	}
+
+	if m.TimerIrq || m.IrqAsserted() {
+		test.Error("Reading $4030 didn't acknowledge the IRQ")
+	}
+
+	// Without repeat the timer stops after firing
+	m.Clock(0x100)
+	if m.TimerIrq {
+		test.Error("Timer IRQ repeated")
+	}
+}
+
+func TestFdsSwitchSide(test *testing.T) {
+	_, done := initFdsTest(test)
+	defer done()
+
+	m, err := LoadFds(append(testFdsSide(nil), testFdsSide(nil)...))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rom = m
+
+	SwitchDiskSide()
+	if DiskSide() != FdsNoDisk {
+		test.Error("Disk wasn't ejected while switching sides")
+	}
+
+	m.Clock(FdsSwapCycles)
+	if DiskSide() != 1 {
+		test.Errorf("Side %d was inserted, expected 1", DiskSide())
+	}
+
+	ToggleDisk()
+	ToggleDisk()
+	if DiskSide() != 1 {
+		test.Errorf("Side %d was reinserted, expected 1", DiskSide())
+	}
+}
+
+func TestFdsTruncatedDiff(test *testing.T) {
+	_, done := initFdsTest(test)
+	defer done()
+
+	// EOF followed by a size that cuts the image short
+	patch := append([]byte("PATCHEOF"), 0x00, 0x01, 0x00)
+	ioutil.WriteFile(DiskDiffFile, patch, 0644)
+
+	m, err := LoadFds(testFdsSide([]byte{1, 2, 3, 4}))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !bytes.Equal(m.Sides[0], m.Original[0]) {
+		test.Error("A diff that truncates the disk was loaded")
+	}
+}
+
+func TestFdsState(test *testing.T) {
+	_, done := initFdsTest(test)
+	defer done()
+
+	m, err := LoadFds(testFdsSide(nil))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	m.Sides[0][100] = 0x55
+
+	s := NewSaveState()
+	m.SerializeState(s)
+
+	m.Sides[0][100] = 0x00
+
+	m.SerializeState(NewLoadState(s.Data))
+	if m.Sides[0][100] != 0x55 {
+		test.Error("Disk writes weren't restored from the state")
+	}
+
+	if !m.Dirty {
+		test.Error("Restored disk wasn't marked to be saved")
+	}
+}
@@ -0,0 +1,266 @@
+package nes
+
+const (
+	FdsVolume = 0.00012
+)
+
+var (
+	// Modulation table entries are 3-bit indexes
+	// into this list of counter adjustments
+	FdsModulationSteps = []int{0, 1, 2, 4, 0, -4, -2, -1}
+
+	// Master volume is 2/2, 2/3, 2/4 or 2/5
+	FdsMasterVolume = []int{30, 20, 15, 12}
+)
+
+type FdsEnvelope struct {
+	Disabled bool
+	Increase bool
+	Speed    int
+	Gain     int
+	Counter  int
+}
+
+// The RAM adapter's single wavetable channel with
+// a frequency modulation unit
+type FdsAudio struct {
+	Wave          [64]Word
+	WaveWrite     bool
+	WaveHalt      bool
+	WaveFrequency int
+	WavePhase     int
+
+	ModTable     [64]int
+	ModHalt      bool
+	ModFrequency int
+	ModPhase     int
+	ModPosition  int
+	ModCounter   int
+
+	EnvelopesHalted bool
+	EnvelopeSpeed   int
+	EnvelopeCycles  int
+
+	Volume     FdsEnvelope
+	Modulation FdsEnvelope
+
+	MasterVolume int
+
+	// Accumulated output since the last sample was pulled
+	OutputSum    int
+	OutputCycles int
+}
+
+func NewFdsAudio() *FdsAudio {
+	return &FdsAudio{
+		EnvelopeSpeed: 0xE8,
+	}
+}
+
+func (f *FdsAudio) Write(v Word, a int) {
+	logApuWrite(a, v)
+
+	switch {
+	case a >= 0x4040 && a <= 0x407F:
+		if f.WaveWrite {
+			f.Wave[a-0x4040] = v & 0x3F
+		}
+	case a == 0x4080:
+		f.Volume.Write(v)
+	case a == 0x4082:
+		f.WaveFrequency = (f.WaveFrequency & 0xF00) | int(v)
+	case a == 0x4083:
+		f.WaveFrequency = (f.WaveFrequency & 0xFF) | (int(v&0xF) << 8)
+		f.EnvelopesHalted = v&0x40 == 0x40
+		f.WaveHalt = v&0x80 == 0x80
+
+		if f.WaveHalt {
+			f.WavePhase = 0
+		}
+	case a == 0x4084:
+		f.Modulation.Write(v)
+	case a == 0x4085:
+		// 7-bit signed
+		f.ModCounter = int(v & 0x7F)
+		if f.ModCounter >= 0x40 {
+			f.ModCounter -= 0x80
+		}
+	case a == 0x4086:
+		f.ModFrequency = (f.ModFrequency & 0xF00) | int(v)
+	case a == 0x4087:
+		f.ModFrequency = (f.ModFrequency & 0xFF) | (int(v&0xF) << 8)
+		f.ModHalt = v&0x80 == 0x80
+	case a == 0x4088:
+		// The table can only be written while the modulator
+		// is halted. Each write fills two entries.
+		if f.ModHalt {
+			f.ModTable[f.ModPosition&0x3E] = int(v & 0x7)
+			f.ModTable[(f.ModPosition&0x3E)+1] = int(v & 0x7)
+			f.ModPosition = (f.ModPosition + 2) & 0x3F
+		}
+	case a == 0x4089:
+		f.WaveWrite = v&0x80 == 0x80
+		f.MasterVolume = int(v & 0x3)
+	case a == 0x408A:
+		f.EnvelopeSpeed = int(v)
+	}
+}
+
+func (f *FdsAudio) Read(a int) Word {
+	switch {
+	case a >= 0x4040 && a <= 0x407F:
+		return f.Wave[a-0x4040] | 0x40
+	case a == 0x4090:
+		return Word(f.Volume.Gain) | 0x40
+	case a == 0x4092:
+		return Word(f.Modulation.Gain) | 0x40
+	}
+
+	return 0
+}
+
+func (e *FdsEnvelope) Write(v Word) {
+	// MDGG GGGG
+	// ||++-++++- Speed, or the gain when disabled
+	// |+-------- Direction (1: increase)
+	// +--------- Envelope disable
+	e.Disabled = v&0x80 == 0x80
+	e.Increase = v&0x40 == 0x40
+	e.Speed = int(v & 0x3F)
+	e.Counter = 0
+
+	if e.Disabled {
+		e.Gain = int(v & 0x3F)
+	}
+}
+
+func (e *FdsEnvelope) Clock() {
+	if e.Disabled {
+		return
+	}
+
+	e.Counter++
+	if e.Counter <= e.Speed {
+		return
+	}
+
+	e.Counter = 0
+
+	if e.Increase && e.Gain < 32 {
+		e.Gain++
+	} else if !e.Increase && e.Gain > 0 {
+		e.Gain--
+	}
+}
+
+// Called once per CPU cycle
+func (f *FdsAudio) Clock() {
+	if !f.EnvelopesHalted && !f.WaveHalt && f.EnvelopeSpeed > 0 {
+		f.EnvelopeCycles++
+
+		if f.EnvelopeCycles >= 8*(f.EnvelopeSpeed+1) {
+			f.EnvelopeCycles = 0
+
+			f.Volume.Clock()
+			f.Modulation.Clock()
+		}
+	}
+
+	if !f.ModHalt {
+		f.ModPhase += f.ModFrequency
+
+		if f.ModPhase >= 0x10000 {
+			f.ModPhase &= 0xFFFF
+			f.stepModulator()
+		}
+	}
+
+	if !f.WaveHalt {
+		f.WavePhase = (f.WavePhase + f.pitch()) & 0x3FFFFF
+	}
+
+	f.OutputSum += f.output()
+	f.OutputCycles++
+}
+
+func (f *FdsAudio) stepModulator() {
+	step := f.ModTable[f.ModPosition]
+	f.ModPosition = (f.ModPosition + 1) & 0x3F
+
+	if step == 4 {
+		f.ModCounter = 0
+	} else {
+		f.ModCounter += FdsModulationSteps[step]
+	}
+
+	// Wrap the 7-bit signed counter
+	if f.ModCounter >= 0x40 {
+		f.ModCounter -= 0x80
+	} else if f.ModCounter < -0x40 {
+		f.ModCounter += 0x80
+	}
+}
+
+// Wave frequency after modulation
+func (f *FdsAudio) pitch() int {
+	if f.ModHalt {
+		return f.WaveFrequency
+	}
+
+	temp := f.ModCounter * f.Modulation.Gain
+	remainder := temp & 0xF
+	temp >>= 4
+
+	if remainder > 0 && temp&0x80 == 0 {
+		if f.ModCounter < 0 {
+			temp--
+		} else {
+			temp += 2
+		}
+	}
+
+	if temp >= 192 {
+		temp -= 256
+	} else if temp < -64 {
+		temp += 256
+	}
+
+	temp *= f.WaveFrequency
+	remainder = temp & 0x3F
+	temp >>= 6
+
+	if remainder >= 32 {
+		temp++
+	}
+
+	pitch := f.WaveFrequency + temp
+	if pitch < 0 {
+		return 0
+	}
+
+	return pitch
+}
+
+func (f *FdsAudio) output() int {
+	gain := f.Volume.Gain
+	if gain > 32 {
+		gain = 32
+	}
+
+	sample := int(f.Wave[(f.WavePhase>>16)&0x3F])
+
+	return (sample * gain * FdsMasterVolume[f.MasterVolume]) / 30
+}
+
+func (f *FdsAudio) Output() float64 {
+	if f.OutputCycles == 0 {
+		return 0
+	}
+
+	out := float64(f.OutputSum) / float64(f.OutputCycles)
+
+	f.OutputSum = 0
+	f.OutputCycles = 0
+
+	return out * FdsVolume
+}
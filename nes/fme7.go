@@ -0,0 +1,213 @@
+package nes
+
+import (
+	"fmt"
+)
+
+type Fme7 struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	Command Word
+
+	// 8k banks for $8000, $A000 and $C000. $E000 is
+	// fixed to the last bank
+	PrgBanks [3]int
+	ChrBanks [8]int
+
+	// $6000-$7FFF can be mapped to either PRG-ROM or RAM
+	PrgRamBank    int
+	PrgRamSelect  bool
+	PrgRamEnabled bool
+
+	IrqEnabled        bool
+	IrqCounterEnabled bool
+	IrqCounter        uint16
+	IrqPending        bool
+
+	Audio *Sunsoft5b
+}
+
+func NewFme7(r *Nrom) *Fme7 {
+	m := &Fme7{
+		PrgBankCount: r.PrgBankCount,
+		ChrRomCount:  r.ChrRomCount,
+		Battery:      r.Battery,
+		Data:         r.Data,
+		Chr:          r.Chr,
+		Audio:        NewSunsoft5b(),
+	}
+
+	m.Load()
+
+	apu.Expansion = append(apu.Expansion, m.Audio)
+
+	return m
+}
+
+func (m *Fme7) Load() {
+	// 2x the banks since we're storing 8k per bank
+	// instead of 16k
+	fmt.Printf("  Emulated PRG banks: %d\n", 2*m.PrgBankCount)
+	m.RomBanks = make([][]Word, 2*m.PrgBankCount)
+	for i := 0; i < 2*m.PrgBankCount; i++ {
+		// Move 8kb chunk to 8kb bank
+		bank := make([]Word, 0x2000)
+		for x := 0; x < 0x2000; x++ {
+			bank[x] = Word(m.Data[(0x2000*i)+x])
+		}
+
+		m.RomBanks[i] = bank
+	}
+
+	// CHR is stored in 1k banks
+	m.VromBanks = m.Chr.Banks(0x400)
+
+	for i := range m.ChrBanks {
+		m.ChrBanks[i] = i % len(m.VromBanks)
+	}
+
+	m.PrgBanks[0] = 0
+	m.PrgBanks[1] = 1 % len(m.RomBanks)
+	m.PrgBanks[2] = (len(m.RomBanks) - 2) % len(m.RomBanks)
+}
+
+func (m *Fme7) BatteryBacked() bool {
+	return m.Battery
+}
+
+// PRG-ROM or RAM can be mapped at $6000
+func (m *Fme7) MapsCpuAddress(a int) bool {
+	return a >= 0x6000
+}
+
+func (m *Fme7) Write(v Word, a int) {
+	switch {
+	case a >= 0x6000 && a <= 0x7FFF:
+		if m.PrgRamSelect && m.PrgRamEnabled {
+			Ram[a] = v
+		}
+	case a >= 0x8000 && a <= 0x9FFF:
+		m.Command = v & 0xF
+	case a >= 0xA000 && a <= 0xBFFF:
+		m.WriteParameter(v)
+	case a >= 0xC000 && a <= 0xDFFF:
+		m.Audio.SelectRegister(v)
+	case a >= 0xE000:
+		m.Audio.WriteRegister(v)
+	}
+}
+
+func (m *Fme7) WriteParameter(v Word) {
+	switch m.Command {
+	case 0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7:
+		// 1k CHR banks
+		m.ChrBanks[m.Command] = int(v) % len(m.VromBanks)
+	case 0x8:
+		// 76543210
+		// ||||||||
+		// ||++++++- PRG bank at $6000
+		// |+------- RAM/ROM select (0: ROM; 1: RAM)
+		// +-------- RAM enable
+		m.PrgRamBank = int(v&0x3F) % len(m.RomBanks)
+		m.PrgRamSelect = v&0x40 == 0x40
+		m.PrgRamEnabled = v&0x80 == 0x80
+	case 0x9, 0xA, 0xB:
+		m.PrgBanks[m.Command-0x9] = int(v&0x3F) % len(m.RomBanks)
+	case 0xC:
+		switch v & 0x3 {
+		case 0x0:
+			ppu.Nametables.SetMirroring(MirroringVertical)
+		case 0x1:
+			ppu.Nametables.SetMirroring(MirroringHorizontal)
+		case 0x2:
+			ppu.Nametables.SetMirroring(MirroringSingleUpper)
+		case 0x3:
+			ppu.Nametables.SetMirroring(MirroringSingleLower)
+		}
+	case 0xD:
+		// Any write acknowledges a pending IRQ
+		m.IrqEnabled = v&0x1 == 0x1
+		m.IrqCounterEnabled = v&0x80 == 0x80
+		m.IrqPending = false
+	case 0xE:
+		m.IrqCounter = (m.IrqCounter & 0xFF00) | uint16(v)
+	case 0xF:
+		m.IrqCounter = (m.IrqCounter & 0xFF) | (uint16(v) << 8)
+	}
+}
+
+func (m *Fme7) Read(a int) Word {
+	switch {
+	case a >= 0xE000:
+		return m.RomBanks[len(m.RomBanks)-1][a&0x1FFF]
+	case a >= 0x8000:
+		return m.RomBanks[m.PrgBanks[(a-0x8000)>>13]][a&0x1FFF]
+	case a >= 0x6000:
+		if !m.PrgRamSelect {
+			return m.RomBanks[m.PrgRamBank][a&0x1FFF]
+		}
+
+		if m.PrgRamEnabled {
+			return Ram[a]
+		}
+	}
+
+	// Open bus
+	return Word(a >> 8)
+}
+
+func (m *Fme7) WriteVram(v Word, a int) {
+	m.Chr.WriteBank(v, m.ChrBanks[a>>10], 0x400, a&0x3FF)
+}
+
+func (m *Fme7) ReadVram(a int) Word {
+	return m.VromBanks[m.ChrBanks[a>>10]][a&0x3FF]
+}
+
+func (m *Fme7) ReadTile(a int) []Word {
+	return m.VromBanks[m.ChrBanks[a>>10]][a&0x3FF : a&0x3FF+16]
+}
+
+// Called once per CPU instruction with the number of
+// cycles it took
+func (m *Fme7) Clock(cycles int) {
+	for i := 0; i < cycles; i++ {
+		if m.IrqCounterEnabled {
+			m.IrqCounter--
+
+			if m.IrqCounter == 0xFFFF && m.IrqEnabled {
+				m.IrqPending = true
+			}
+		}
+
+		m.Audio.Clock()
+	}
+}
+
+func (m *Fme7) IrqAsserted() bool {
+	return m.IrqPending
+}
+
+func (m *Fme7) SerializeState(s *State) {
+	s.Word(&m.Command)
+	s.Ints(m.PrgBanks[:])
+	s.Ints(m.ChrBanks[:])
+
+	s.Int(&m.PrgRamBank)
+	s.Bool(&m.PrgRamSelect)
+	s.Bool(&m.PrgRamEnabled)
+
+	s.Bool(&m.IrqEnabled)
+	s.Bool(&m.IrqCounterEnabled)
+	s.Uint16(&m.IrqCounter)
+	s.Bool(&m.IrqPending)
+
+	m.Chr.SerializeState(s)
+}
@@ -0,0 +1,105 @@
+package nes
+
+import (
+	"testing"
+)
+
+// Writes a parameter to one of the FME-7's commands
+func fme7Command(command, v Word) {
+	Ram.Write(0x8000, command)
+	Ram.Write(0xA000, v)
+}
+
+func TestFme7Banking(test *testing.T) {
+	loadMapperRom(test, 69, 0, 8, 8)
+
+	// 8k banks 4, 6 and 8, which start 16k banks 2, 3 and 4
+	fme7Command(0x9, 4)
+	fme7Command(0xA, 6)
+	fme7Command(0xB, 8)
+
+	verifyPrgBank(0x8000, 2, test)
+	verifyPrgBank(0xA000, 3, test)
+	verifyPrgBank(0xC000, 4, test)
+
+	// 1k bank $14, which is 4k bank 5, and bank 8 in the
+	// next slot
+	fme7Command(0x0, 0x14)
+	fme7Command(0x1, 0x08)
+
+	verifyChrBank(0x0000, 5, test)
+	verifyChrBank(0x0400, 2, test)
+
+	fme7Command(0xC, 0x01)
+	if ppu.Nametables.Mirroring != MirroringHorizontal {
+		test.Error("Mirroring wasn't horizontal")
+	}
+}
+
+func TestFme7PrgRam(test *testing.T) {
+	loadMapperRom(test, 69, 0, 8, 8)
+
+	// ROM bank 2 at $6000
+	fme7Command(0x8, 0x02)
+	verifyPrgBank(0x6000, 1, test)
+
+	// ROM ignores writes
+	Ram.Write(0x6000, 0x55)
+	verifyPrgBank(0x6000, 1, test)
+
+	// RAM, but disabled, is open bus and ignores writes
+	fme7Command(0x8, 0x40)
+	Ram.Write(0x6000, 0x55)
+
+	if v, _ := Ram.Read(0x6000); v != 0x60 {
+		test.Errorf("Disabled RAM read 0x%X, expected open bus", v)
+	}
+
+	fme7Command(0x8, 0xC0)
+	Ram.Write(0x6000, 0x55)
+
+	if v, _ := Ram.Read(0x6000); v != 0x55 {
+		test.Errorf("PRG-RAM read 0x%X, expected 0x55", v)
+	}
+}
+
+func TestFme7Irq(test *testing.T) {
+	m := loadMapperRom(test, 69, 0, 8, 8).(*Fme7)
+
+	// Counter of 1, with the IRQ and counter enabled
+	fme7Command(0xE, 0x01)
+	fme7Command(0xF, 0x00)
+	fme7Command(0xD, 0x81)
+
+	m.Clock(1)
+	if m.IrqAsserted() {
+		test.Error("IRQ fired when the counter reached 0")
+	}
+
+	// Fires as it underflows from 0 to $FFFF
+	m.Clock(1)
+	if !m.IrqAsserted() {
+		test.Fatal("IRQ didn't fire when the counter underflowed")
+	}
+
+	if m.IrqCounter != 0xFFFF {
+		test.Errorf("Counter was 0x%X, expected 0xFFFF", m.IrqCounter)
+	}
+
+	fme7Command(0xD, 0x81)
+	if m.IrqAsserted() {
+		test.Error("Writing command $D didn't acknowledge the IRQ")
+	}
+
+	// The counter keeps running with the IRQ disabled
+	fme7Command(0xD, 0x80)
+	m.Clock(0x10000)
+
+	if m.IrqAsserted() {
+		test.Error("IRQ fired while disabled")
+	}
+
+	if m.IrqCounter != 0xFFFF {
+		test.Errorf("Counter was 0x%X after wrapping, expected 0xFFFF", m.IrqCounter)
+	}
+}
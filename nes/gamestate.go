@@ -57,6 +57,18 @@ func LoadGameState() {
 		return
 	}
 
+	// Mapper state goes first, since it decides
+	// which nametables are restored below
+	if len(state) > 0x5127 {
+		s := NewLoadState(state[0x5127:])
+		serializeMapperState(s)
+
+		if s.Err != nil {
+			fmt.Println(s.Err.Error())
+			return
+		}
+	}
+
 	for i, v := range state[:0x2000] {
 		Ram[i] = Word(v)
 	}
@@ -82,22 +94,22 @@ func LoadGameState() {
 		ppu.Vram[i] = Word(v)
 	}
 
-	// Nametable VRAM
+	// Nametable VRAM, CIRAM then four-screen RAM
 	for i, v := range state[0x4107:0x4507] {
-		ppu.Nametables.LogicalTables[0][i] = Word(v)
+		ppu.Nametables.Nametable0[i] = Word(v)
 	}
 	for i, v := range state[0x4507:0x4907] {
-		ppu.Nametables.LogicalTables[1][i] = Word(v)
+		ppu.Nametables.Nametable1[i] = Word(v)
 	}
 	for i, v := range state[0x4907:0x4D07] {
-		ppu.Nametables.LogicalTables[2][i] = Word(v)
+		ppu.Nametables.CartridgeRam0[i] = Word(v)
 	}
 	for i, v := range state[0x4D07:0x5107] {
-		ppu.Nametables.LogicalTables[3][i] = Word(v)
+		ppu.Nametables.CartridgeRam1[i] = Word(v)
 	}
 
 	// Palette RAM
-	for i, v := range state[0x5107:0x5126] {
+	for i, v := range state[0x5107:0x5127] {
 		ppu.PaletteRam[i] = Word(v)
 	}
 }
@@ -133,17 +145,17 @@ func SaveGameState() {
 		buf.WriteByte(byte(v))
 	}
 
-	// Nametable VRAM
-	for _, v := range ppu.Nametables.LogicalTables[0] {
+	// Nametable VRAM, CIRAM then four-screen RAM
+	for _, v := range ppu.Nametables.Nametable0 {
 		buf.WriteByte(byte(v))
 	}
-	for _, v := range ppu.Nametables.LogicalTables[1] {
+	for _, v := range ppu.Nametables.Nametable1 {
 		buf.WriteByte(byte(v))
 	}
-	for _, v := range ppu.Nametables.LogicalTables[2] {
+	for _, v := range ppu.Nametables.CartridgeRam0 {
 		buf.WriteByte(byte(v))
 	}
-	for _, v := range ppu.Nametables.LogicalTables[3] {
+	for _, v := range ppu.Nametables.CartridgeRam1 {
 		buf.WriteByte(byte(v))
 	}
 
@@ -152,11 +164,42 @@ func SaveGameState() {
 		buf.WriteByte(byte(v))
 	}
 
+	s := NewSaveState()
+	serializeMapperState(s)
+	buf.Write(s.Data)
+
 	if err := ioutil.WriteFile(SaveStateFile, buf.Bytes(), 0644); err != nil {
 		panic(err.Error())
 	}
 }
 
+// Mirroring, work RAM and the mapper's registers, which
+// follow the fixed layout above
+func serializeMapperState(s *State) {
+	mirroring := ppu.Nametables.Mirroring
+
+	s.Int(&mirroring)
+	s.Words(Ram[0x6000:0x8000])
+
+	if m, ok := rom.(StateSerializer); ok {
+		m.SerializeState(s)
+	}
+
+	if s.Loading && s.Err == nil {
+		ppu.Nametables.SetMirroring(mirroring)
+		mapNametables()
+	}
+}
+
+// Console reset button
+func Reset() {
+	cpu.RequestInterrupt(InterruptReset)
+
+	if m, ok := rom.(Resetter); ok {
+		m.Reset()
+	}
+}
+
 func loadBatteryRam() {
 	fmt.Println("Loading battery RAM")
 
@@ -169,16 +212,32 @@ func loadBatteryRam() {
 	for i, v := range batteryRam[:0x2000] {
 		Ram[0x6000+i] = Word(v)
 	}
+
+	// Mapper memory is stored after the work RAM
+	if m, ok := rom.(BatteryMemory); ok {
+		data := m.BatteryData()
+		if len(batteryRam) >= 0x2000+len(data) {
+			for i, v := range batteryRam[0x2000 : 0x2000+len(data)] {
+				data[i] = Word(v)
+			}
+		}
+	}
 }
 
 func saveBatteryFile() {
 	buf := new(bytes.Buffer)
 
 	// Battery/Work RAM
-	for _, v := range Ram[0x6000:0x7FFF] {
+	for _, v := range Ram[0x6000:0x8000] {
 		buf.WriteByte(byte(v))
 	}
 
+	if m, ok := rom.(BatteryMemory); ok {
+		for _, v := range m.BatteryData() {
+			buf.WriteByte(byte(v))
+		}
+	}
+
 	if err := ioutil.WriteFile(BatteryRamFile, buf.Bytes(), 0644); err != nil {
 		panic(err.Error())
 	}
@@ -201,21 +260,25 @@ func RunSystem() {
 		cycles = cpu.Step()
 		totalCpuCycles += cycles
 
-		for i := 0; i < 3*cycles; i++ {
-			ppu.Step()
+		if runsPpu() {
+			for i := 0; i < 3*cycles; i++ {
+				ppu.Step()
+			}
 		}
 
 		for i := 0; i < cycles; i++ {
 			apu.Step()
 		}
 
-		if AudioEnabled {
+		clockMapper(cycles)
+
+		if AudioEnabled || AudioRecording() {
 			if totalCpuCycles-apu.LastFrameTick >= (cpuClockSpeed / 240) {
 				apu.FrameSequencerStep()
 				apu.LastFrameTick = totalCpuCycles
 			}
 
-			if totalCpuCycles-lastApuTick >= ((cpuClockSpeed / 44100) + flip) {
+			if totalCpuCycles-lastApuTick >= ((cpuClockSpeed / AudioSampleRate) + flip) {
 				apu.PushSample()
 				lastApuTick = totalCpuCycles
 
@@ -236,6 +299,30 @@ func Init(contents []byte, audioBuf func(int16), getter GetButtonFunc) (chan []u
 	Pads[0] = NewController(getter)
 	Pads[1] = NewController(getter)
 
+	if IsNsf(contents) {
+		m, err := LoadNsf(contents)
+		if err != nil {
+			return nil, err
+		}
+
+		rom = m
+		m.PlaySong(m.StartingSong)
+
+		return videoTick, nil
+	}
+
+	if IsFds(contents) {
+		m, err := LoadFds(contents)
+		if err != nil {
+			return nil, err
+		}
+
+		rom = m
+		cpu.SetResetVector()
+
+		return videoTick, nil
+	}
+
 	var err error
 	if rom, err = LoadRom(contents); err != nil {
 		return nil, err
@@ -0,0 +1,68 @@
+package nes
+
+// GxROM and MHROM, mapper 66
+type Gxrom struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	// 32k PRG bank and 8k CHR bank
+	PrgBank int
+	ChrBank int
+}
+
+func NewGxrom(r *Nrom) *Gxrom {
+	return &Gxrom{
+		RomBanks:     r.RomBanks,
+		VromBanks:    r.VromBanks,
+		PrgBankCount: r.PrgBankCount,
+		ChrRomCount:  r.ChrRomCount,
+		Battery:      r.Battery,
+		Data:         r.Data,
+		Chr:          r.Chr,
+	}
+}
+
+func (m *Gxrom) Write(v Word, a int) {
+	v = busConflict(m, v, a)
+
+	m.PrgBank = int(v>>4) & 0x3
+	m.ChrBank = int(v & 0x3)
+}
+
+func (m *Gxrom) Read(a int) Word {
+	bank := m.PrgBank*2 + ((a - 0x8000) >> 14)
+	return m.RomBanks[bank%len(m.RomBanks)][a&0x3FFF]
+}
+
+func (m *Gxrom) WriteVram(v Word, a int) {
+	bank := m.ChrBank*2 + (a >> 12)
+	m.Chr.WriteBank(v, bank%len(m.VromBanks), 0x1000, a&0xFFF)
+}
+
+func (m *Gxrom) ReadVram(a int) Word {
+	bank := m.ChrBank*2 + (a >> 12)
+	return m.VromBanks[bank%len(m.VromBanks)][a&0xFFF]
+}
+
+func (m *Gxrom) ReadTile(a int) []Word {
+	bank := m.ChrBank*2 + (a >> 12)
+	a &= 0xFFF
+	return m.VromBanks[bank%len(m.VromBanks)][a : a+16]
+}
+
+func (m *Gxrom) BatteryBacked() bool {
+	return m.Battery
+}
+
+func (m *Gxrom) SerializeState(s *State) {
+	s.Int(&m.PrgBank)
+	s.Int(&m.ChrBank)
+
+	m.Chr.SerializeState(s)
+}
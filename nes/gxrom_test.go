@@ -0,0 +1,24 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestGxromBanking(test *testing.T) {
+	loadMapperRom(test, 66, 0, 8, 4)
+
+	// 32k PRG bank 2 and 8k CHR bank 1
+	Ram.Write(0x8001, 0x21)
+
+	verifyPrgBank(0x8000, 4, test)
+	verifyPrgBank(0xC000, 5, test)
+	verifyChrBank(0x0000, 2, test)
+	verifyChrBank(0x1000, 3, test)
+
+	// $8000 holds 4, which isn't a bank bit, so the
+	// conflict clears both banks
+	Ram.Write(0x8000, 0x37)
+
+	verifyPrgBank(0x8000, 0, test)
+	verifyChrBank(0x0000, 0, test)
+}
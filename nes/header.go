@@ -0,0 +1,209 @@
+package nes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+const (
+	TimingNtsc = iota
+	TimingPal
+	TimingMultiRegion
+	TimingDendy
+)
+
+const (
+	ConsoleNes = iota
+	ConsoleVsSystem
+	ConsolePlaychoice
+	ConsoleExtended
+)
+
+const (
+	RomHeaderSize = 16
+	TrainerSize   = 0x200
+)
+
+var (
+	TimingNames  = []string{"NTSC", "PAL", "Multi-region", "Dendy"}
+	ConsoleNames = []string{"NES/Famicom", "Vs. System", "PlayChoice-10", "Extended"}
+)
+
+// Everything an iNES or NES 2.0 header says about a cartridge.
+// Sizes are in bytes.
+type RomHeader struct {
+	Nes2 bool
+	// Set for UNIF files, which name the board rather than the mapper
+	Board     string
+	Mapper    int
+	Submapper int
+
+	PrgRomSize   int
+	ChrRomSize   int
+	PrgRamSize   int
+	PrgNvramSize int
+	ChrRamSize   int
+	ChrNvramSize int
+	MiscRoms     int
+
+	Mirroring  int
+	FourScreen bool
+	Battery    bool
+	Trainer    bool
+
+	Timing      int
+	ConsoleType int
+	// Vs. System PPU and hardware types, or the extended console type
+	VsPpuType        int
+	VsHardwareType   int
+	ExtendedConsole  int
+	ExpansionDevice  int
+	IgnoredMapperMsb bool
+
+	// Checksums of the PRG and CHR-ROM the header declares
+	Crc32 uint32
+	Sha1  string
+}
+
+func ParseRomHeader(rom []byte) (*RomHeader, error) {
+	if len(rom) < RomHeaderSize || string(rom[0:4]) != "NES\x1a" {
+		return nil, errors.New("Invalid ROM file")
+	}
+
+	h := &RomHeader{
+		Mapper:     int(rom[6]>>4) | int(rom[7]&0xF0),
+		Battery:    rom[6]&0x2 == 0x2,
+		Trainer:    rom[6]&0x4 == 0x4,
+		FourScreen: rom[6]&0x8 == 0x8,
+		Mirroring:  MirroringHorizontal,
+	}
+
+	if rom[6]&0x1 == 0x1 {
+		h.Mirroring = MirroringVertical
+	}
+
+	switch {
+	case rom[7]&0x0C == 0x08:
+		h.parseNes2(rom)
+	case rom[7]&0x0C == 0x04 || !isZero(rom[12:16]) || bytes.Contains(rom[7:16], []byte("DiskDude!")):
+		// Byte 7 onwards is garbage left by old tools (the
+		// "DiskDude!" signature being the usual one), so only
+		// the low nibble of the mapper number can be trusted
+		h.Mapper &= 0x0F
+		h.IgnoredMapperMsb = true
+		h.PrgRomSize = int(rom[4]) * 0x4000
+		h.ChrRomSize = int(rom[5]) * 0x2000
+		h.PrgRamSize = 0x2000
+	default:
+		h.parseInes(rom)
+	}
+
+	if h.PrgRomSize < 0 || h.ChrRomSize < 0 {
+		return nil, errors.New("Invalid ROM size in NES 2.0 header")
+	}
+
+	if h.ChrRomSize == 0 && h.ChrRamSize == 0 && h.ChrNvramSize == 0 {
+		// iNES has no CHR-RAM size, so assume the usual 8k
+		h.ChrRamSize = 0x2000
+	}
+
+	return h, nil
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *RomHeader) parseInes(rom []byte) {
+	h.PrgRomSize = int(rom[4]) * 0x4000
+	h.ChrRomSize = int(rom[5]) * 0x2000
+	h.ConsoleType = int(rom[7] & 0x3)
+
+	// Zero means 8k, for compatibility
+	h.PrgRamSize = int(rom[8]) * 0x2000
+	if h.PrgRamSize == 0 {
+		h.PrgRamSize = 0x2000
+	}
+
+	if h.Battery {
+		h.PrgNvramSize = h.PrgRamSize
+		h.PrgRamSize = 0
+	}
+
+	if rom[9]&0x1 == 0x1 {
+		h.Timing = TimingPal
+	}
+}
+
+func (h *RomHeader) parseNes2(rom []byte) {
+	h.Nes2 = true
+	h.Mapper |= int(rom[8]&0x0F) << 8
+	h.Submapper = int(rom[8] >> 4)
+
+	h.PrgRomSize = nes2RomSize(rom[4], rom[9]&0x0F, 0x4000)
+	h.ChrRomSize = nes2RomSize(rom[5], rom[9]>>4, 0x2000)
+
+	h.PrgRamSize = nes2RamSize(rom[10] & 0x0F)
+	h.PrgNvramSize = nes2RamSize(rom[10] >> 4)
+	h.ChrRamSize = nes2RamSize(rom[11] & 0x0F)
+	h.ChrNvramSize = nes2RamSize(rom[11] >> 4)
+
+	h.Timing = int(rom[12] & 0x3)
+	h.ConsoleType = int(rom[7] & 0x3)
+
+	switch h.ConsoleType {
+	case ConsoleVsSystem:
+		h.VsPpuType = int(rom[13] & 0x0F)
+		h.VsHardwareType = int(rom[13] >> 4)
+	case ConsoleExtended:
+		h.ExtendedConsole = int(rom[13] & 0x0F)
+	}
+
+	h.MiscRoms = int(rom[14] & 0x3)
+	h.ExpansionDevice = int(rom[15] & 0x3F)
+}
+
+// ROM sizes are either a count of units, or with an MSB nibble
+// of $F, an exponent and multiplier: 2^E * (MM*2 + 1)
+func nes2RomSize(lsb, msb byte, unit int) int {
+	if msb == 0xF {
+		exponent := uint(lsb >> 2)
+		multiplier := int(lsb&0x3)*2 + 1
+
+		// Nothing this big could be in a ROM file
+		if exponent > 30 {
+			return -1
+		}
+
+		return (1 << exponent) * multiplier
+	}
+
+	return (int(msb)<<8 | int(lsb)) * unit
+}
+
+func nes2RamSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+
+	return 64 << uint(shift)
+}
+
+func (h *RomHeader) String() string {
+	format := "iNES"
+	if h.Nes2 {
+		format = "NES 2.0"
+	} else if h.Board != "" {
+		format = fmt.Sprintf("UNIF %s", h.Board)
+	}
+
+	return fmt.Sprintf("%s, mapper %d.%d, %s, %s", format, h.Mapper, h.Submapper,
+		TimingNames[h.Timing], ConsoleNames[h.ConsoleType])
+}
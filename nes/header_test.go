@@ -0,0 +1,91 @@
+package nes
+
+import (
+	"testing"
+)
+
+func header(b ...byte) []byte {
+	h := make([]byte, RomHeaderSize)
+	copy(h, "NES\x1a")
+	copy(h[4:], b)
+
+	return h
+}
+
+func TestInesHeader(test *testing.T) {
+	h, err := ParseRomHeader(header(2, 1, 0x43, 0x10))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if h.Nes2 || h.Mapper != 0x14 {
+		test.Errorf("Mapper was 0x%X, expected iNES mapper 0x14", h.Mapper)
+	}
+
+	if h.PrgRomSize != 0x8000 || h.ChrRomSize != 0x2000 {
+		test.Errorf("PRG/CHR were 0x%X/0x%X, expected 0x8000/0x2000", h.PrgRomSize, h.ChrRomSize)
+	}
+
+	if h.Mirroring != MirroringVertical || !h.Battery || h.Trainer {
+		test.Errorf("Flags were wrong: %+v", h)
+	}
+
+	// The battery backs the 8k of PRG-RAM iNES assumes
+	if h.PrgNvramSize != 0x2000 || h.PrgRamSize != 0 {
+		test.Errorf("PRG-RAM was 0x%X/0x%X, expected 0/0x2000", h.PrgRamSize, h.PrgNvramSize)
+	}
+}
+
+func TestDiskDudeHeader(test *testing.T) {
+	rom := header(2, 1, 0x40, 0x44)
+	copy(rom[7:], "DiskDude!")
+
+	h, err := ParseRomHeader(rom)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if h.Mapper != 0x4 || !h.IgnoredMapperMsb {
+		test.Errorf("Mapper was 0x%X, expected 0x4", h.Mapper)
+	}
+}
+
+func TestNes2Header(test *testing.T) {
+	h, err := ParseRomHeader(header(
+		// Exponent CHR size: 2^4 * 3
+		0x02, 0x11, 0x16, 0x08,
+		// Mapper 0x101, submapper 3
+		0x31,
+		0xF0,
+		0x70, 0x07, 0x01, 0x01, 0x00, 0x05,
+	))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !h.Nes2 || h.Mapper != 0x101 || h.Submapper != 3 {
+		test.Errorf("Mapper was %d.%d, expected 257.3", h.Mapper, h.Submapper)
+	}
+
+	if h.PrgRomSize != 0x8000 || h.ChrRomSize != 48 {
+		test.Errorf("PRG/CHR were 0x%X/%d, expected 0x8000/48", h.PrgRomSize, h.ChrRomSize)
+	}
+
+	if h.PrgRamSize != 0 || h.PrgNvramSize != 0x2000 || h.ChrRamSize != 0x2000 {
+		test.Errorf("RAM sizes were wrong: %+v", h)
+	}
+
+	if h.Timing != TimingPal || h.ConsoleType != ConsoleNes || h.ExpansionDevice != 5 {
+		test.Errorf("Timing/console/expansion were %d/%d/%d", h.Timing, h.ConsoleType, h.ExpansionDevice)
+	}
+
+	if !h.Trainer || !h.Battery {
+		test.Errorf("Trainer and battery flags were not set")
+	}
+}
+
+func TestInvalidHeader(test *testing.T) {
+	if _, err := ParseRomHeader([]byte("NES")); err == nil {
+		test.Errorf("Truncated header should fail")
+	}
+}
@@ -0,0 +1,79 @@
+package nes
+
+// Jaleco JF-11 and JF-14, mapper 140. GxROM with the
+// register moved to $6000-$7FFF, where there's no RAM.
+type JalecoJf11 struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	// 32k PRG bank and 8k CHR bank
+	PrgBank int
+	ChrBank int
+}
+
+func NewJalecoJf11(r *Nrom) *JalecoJf11 {
+	return &JalecoJf11{
+		RomBanks:     r.RomBanks,
+		VromBanks:    r.VromBanks,
+		PrgBankCount: r.PrgBankCount,
+		ChrRomCount:  r.ChrRomCount,
+		Battery:      r.Battery,
+		Data:         r.Data,
+		Chr:          r.Chr,
+	}
+}
+
+func (m *JalecoJf11) Write(v Word, a int) {
+	if a >= 0x8000 {
+		return
+	}
+
+	m.PrgBank = int(v>>4) & 0x3
+	m.ChrBank = int(v & 0xF)
+}
+
+func (m *JalecoJf11) Read(a int) Word {
+	if a < 0x8000 {
+		return 0
+	}
+
+	bank := m.PrgBank*2 + ((a - 0x8000) >> 14)
+	return m.RomBanks[bank%len(m.RomBanks)][a&0x3FFF]
+}
+
+func (m *JalecoJf11) MapsCpuAddress(a int) bool {
+	return a >= 0x6000
+}
+
+func (m *JalecoJf11) WriteVram(v Word, a int) {
+	bank := m.ChrBank*2 + (a >> 12)
+	m.Chr.WriteBank(v, bank%len(m.VromBanks), 0x1000, a&0xFFF)
+}
+
+func (m *JalecoJf11) ReadVram(a int) Word {
+	bank := m.ChrBank*2 + (a >> 12)
+	return m.VromBanks[bank%len(m.VromBanks)][a&0xFFF]
+}
+
+func (m *JalecoJf11) ReadTile(a int) []Word {
+	bank := m.ChrBank*2 + (a >> 12)
+	a &= 0xFFF
+	return m.VromBanks[bank%len(m.VromBanks)][a : a+16]
+}
+
+func (m *JalecoJf11) BatteryBacked() bool {
+	return m.Battery
+}
+
+func (m *JalecoJf11) SerializeState(s *State) {
+	s.Int(&m.PrgBank)
+	s.Int(&m.ChrBank)
+
+	m.Chr.SerializeState(s)
+}
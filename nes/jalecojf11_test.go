@@ -0,0 +1,21 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestJalecoJf11Banking(test *testing.T) {
+	loadMapperRom(test, 140, 0, 8, 8)
+
+	// 32k PRG bank 2 and 8k CHR bank 3
+	Ram.Write(0x6000, 0x23)
+
+	verifyPrgBank(0x8000, 4, test)
+	verifyPrgBank(0xC000, 5, test)
+	verifyChrBank(0x0000, 6, test)
+	verifyChrBank(0x1000, 7, test)
+
+	// The register isn't in ROM space
+	Ram.Write(0x8001, 0x00)
+	verifyPrgBank(0x8000, 4, test)
+}
@@ -0,0 +1,261 @@
+package nes
+
+import (
+	"errors"
+)
+
+// Every cartridge implements Mapper. The interfaces further down
+// are optional, and the core checks for those rather than for
+// particular mappers.
+type Mapper interface {
+	Write(v Word, a int)
+	Read(a int) Word
+	WriteVram(v Word, a int)
+	ReadVram(a int) Word
+	ReadTile(a int) []Word
+	BatteryBacked() bool
+}
+
+// What the PPU is fetching when an address is put on its bus
+const (
+	PpuFetchNametable = iota
+	PpuFetchAttribute
+	PpuFetchBackground
+	PpuFetchSprite
+	// A $2006 write or $2007 access from the CPU
+	PpuFetchData
+)
+
+// Hardware driven by the CPU clock, e.g. IRQ counters
+// and expansion audio
+type CpuClocked interface {
+	Clock(cycles int)
+}
+
+// Sees every address the PPU fetches from, for snooping
+// on A12, nametable fetches or CHR latch tiles. Called before
+// the fetch is made, so banks can be switched for it.
+type PpuBusObserver interface {
+	PpuBus(a int, fetch int)
+}
+
+// Registers or memory in $4020-$7FFF, which is otherwise
+// expansion area and work RAM
+type CpuBusMapper interface {
+	MapsCpuAddress(a int) bool
+}
+
+// Holds the CPU's IRQ line low until acknowledged
+type IrqSource interface {
+	IrqAsserted() bool
+}
+
+// Decides what memory backs each nametable, past what the
+// mirroring set up. Called when the mapper's registers change
+// and after restoring state.
+type NametableMapper interface {
+	MapNametables(n *Nametable)
+}
+
+// Supplies background tiles in place of the nametables and
+// pattern tables, for per-tile attributes and split screens.
+// Called for each tile the PPU fetches at VRAM address v, with
+// the column and line it will be drawn at. Returns the pattern
+// bytes and the palette, or false to fetch the tile as normal.
+type BackgroundFetcher interface {
+	FetchBackground(v int, column int, line int) (low, high, palette Word, ok bool)
+}
+
+// Memory on the board, past the work RAM, that's saved to the
+// battery file, e.g. an EEPROM or the Namco 163's internal RAM
+type BatteryMemory interface {
+	BatteryData() []Word
+}
+
+type Resetter interface {
+	Reset()
+}
+
+// Draws its own frames in place of the PPU's, which isn't run,
+// e.g. the NSF player's track display
+type FrameDrawer interface {
+	DrawDisplay()
+}
+
+// Plays a list of songs, as NSF files do
+type TrackPlayer interface {
+	NextTrack()
+	PreviousTrack()
+}
+
+// A drive for disks that can be ejected, inserted and flipped
+// over, like the FDS
+type DiskDrive interface {
+	Eject()
+	Insert(side int)
+	SwitchSide()
+	// The side in the drive, or FdsNoDisk
+	InsertedSide() int
+	// The side that was in the drive before it was ejected
+	EjectedSide() int
+}
+
+// Registers and RAM that need to go in save states. The same
+// method saves and restores, depending on the State passed in.
+type StateSerializer interface {
+	SerializeState(s *State)
+}
+
+func clockMapper(cycles int) {
+	if m, ok := rom.(CpuClocked); ok {
+		m.Clock(cycles)
+	}
+}
+
+func observePpuBus(a int, fetch int) {
+	if m, ok := rom.(PpuBusObserver); ok {
+		m.PpuBus(a, fetch)
+	}
+}
+
+func mapsCpuAddress(a int) bool {
+	m, ok := rom.(CpuBusMapper)
+	return ok && m.MapsCpuAddress(a)
+}
+
+func mapperIrq() bool {
+	m, ok := rom.(IrqSource)
+	return ok && m.IrqAsserted()
+}
+
+func mapNametables() {
+	if m, ok := rom.(NametableMapper); ok {
+		m.MapNametables(&ppu.Nametables)
+	}
+}
+
+// The PPU is only run when the mapper doesn't draw the frames
+func runsPpu() bool {
+	_, ok := rom.(FrameDrawer)
+	return !ok
+}
+
+func fetchBackground(v int, column int, line int) (low, high, palette Word, ok bool) {
+	if m, isFetcher := rom.(BackgroundFetcher); isFetcher {
+		return m.FetchBackground(v, column, line)
+	}
+
+	return
+}
+
+// NES 2.0 submappers for discrete logic boards like UNROM,
+// CNROM and ANROM, that may or may not have bus conflicts
+const (
+	SubmapperNoBusConflicts = 1
+	SubmapperBusConflicts   = 2
+)
+
+// Boards that don't stop the ROM from driving the data bus
+// during a write latch the AND of both values
+func busConflict(m Mapper, v Word, a int) Word {
+	return v & m.Read(a)
+}
+
+var errStateTruncated = errors.New("Save state is truncated")
+
+// Either a save state being written, or one being read back
+// into the values passed to it
+type State struct {
+	Loading bool
+	Data    []byte
+	Err     error
+}
+
+func NewSaveState() *State {
+	return &State{}
+}
+
+func NewLoadState(data []byte) *State {
+	return &State{Loading: true, Data: data}
+}
+
+func (s *State) next(n int) []byte {
+	if len(s.Data) < n {
+		s.Err = errStateTruncated
+		s.Data = nil
+		return make([]byte, n)
+	}
+
+	b := s.Data[:n]
+	s.Data = s.Data[n:]
+
+	return b
+}
+
+func (s *State) Int(v *int) {
+	if !s.Loading {
+		s.Data = append(s.Data, byte(*v>>24), byte(*v>>16), byte(*v>>8), byte(*v))
+		return
+	}
+
+	b := s.next(4)
+	*v = int(int32(uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])))
+}
+
+func (s *State) Ints(v []int) {
+	for i := range v {
+		s.Int(&v[i])
+	}
+}
+
+func (s *State) Bool(v *bool) {
+	if !s.Loading {
+		if *v {
+			s.Data = append(s.Data, 1)
+		} else {
+			s.Data = append(s.Data, 0)
+		}
+
+		return
+	}
+
+	*v = s.next(1)[0] != 0
+}
+
+func (s *State) Word(v *Word) {
+	if !s.Loading {
+		s.Data = append(s.Data, byte(*v))
+		return
+	}
+
+	*v = Word(s.next(1)[0])
+}
+
+func (s *State) Words(v []Word) {
+	if !s.Loading {
+		for _, w := range v {
+			s.Data = append(s.Data, byte(w))
+		}
+
+		return
+	}
+
+	for i, b := range s.next(len(v)) {
+		v[i] = Word(b)
+	}
+}
+
+func (s *State) Bytes(v []byte) {
+	if !s.Loading {
+		s.Data = append(s.Data, v...)
+		return
+	}
+
+	copy(v, s.next(len(v)))
+}
+
+func (s *State) Uint16(v *uint16) {
+	i := int(*v)
+	s.Int(&i)
+	*v = uint16(i)
+}
@@ -0,0 +1,194 @@
+package nes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Records what the PPU puts on its bus
+type busRecorder struct {
+	Mapper
+	fetches map[int]int
+}
+
+func (b *busRecorder) PpuBus(a int, fetch int) {
+	b.fetches[fetch]++
+}
+
+func TestPpuBusFetches(test *testing.T) {
+	initRomTest()
+
+	m, err := LoadRom(testRom(1, 1, 0))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	b := &busRecorder{Mapper: m, fetches: make(map[int]int)}
+	rom = b
+
+	// Background only, so the sprite slots are all empty
+	ppu.WriteMask(0x08)
+	ppu.Scanline = 0
+	ppu.Cycle = 1
+
+	for i := 0; i < 341; i++ {
+		ppu.Step()
+	}
+
+	// 34 tiles, two garbage fetches for each sprite, and the
+	// dummy fetches at the end of the line and the start
+	if b.fetches[PpuFetchNametable] != 34+16+3 {
+		test.Errorf("%d nametable fetches, expected 53", b.fetches[PpuFetchNametable])
+	}
+
+	if b.fetches[PpuFetchAttribute] != 34 {
+		test.Errorf("%d attribute fetches, expected 34", b.fetches[PpuFetchAttribute])
+	}
+
+	if b.fetches[PpuFetchBackground] != 34*2 {
+		test.Errorf("%d background fetches, expected 68", b.fetches[PpuFetchBackground])
+	}
+
+	if b.fetches[PpuFetchSprite] != 8*2 {
+		test.Errorf("%d sprite fetches, expected 16", b.fetches[PpuFetchSprite])
+	}
+
+	// Nothing is fetched with rendering off
+	b.fetches = make(map[int]int)
+	ppu.WriteMask(0x00)
+
+	for i := 0; i < 341; i++ {
+		ppu.Step()
+	}
+
+	if len(b.fetches) != 0 {
+		test.Errorf("Fetched with rendering disabled: %v", b.fetches)
+	}
+}
+
+func TestMapperIrqLine(test *testing.T) {
+	initRomTest()
+	cpu.Init()
+
+	// FME-7 with its IRQ vector pointing at a NOP at $8000,
+	// and another NOP at $9000
+	data := testRom(2, 1, 0x50)
+	data[7] = 0x40
+	data[RomHeaderSize] = 0xEA
+	data[RomHeaderSize+0x1000] = 0xEA
+	data[RomHeaderSize+0x7FFE] = 0x00
+	data[RomHeaderSize+0x7FFF] = 0x80
+
+	m, err := LoadRom(data)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rom = m
+	fme7 := m.(*Fme7)
+
+	// Enable the IRQ and counter, with the counter at 0
+	Ram.Write(0x8000, 0xD)
+	Ram.Write(0xA000, 0x81)
+
+	fme7.Clock(1)
+	if !mapperIrq() {
+		test.Fatal("Counter underflow didn't assert the IRQ line")
+	}
+
+	cpu.ProgramCounter = 0x9000
+	cpu.P = 0x24
+	cpu.Step()
+
+	if cpu.ProgramCounter != 0x9000+1 {
+		test.Errorf("IRQ was taken with interrupts disabled, PC was 0x%X", cpu.ProgramCounter)
+	}
+
+	cpu.ProgramCounter = 0x9000
+	cpu.P = 0x20
+	cpu.Step()
+
+	if cpu.ProgramCounter != 0x8001 {
+		test.Errorf("IRQ wasn't taken, PC was 0x%X", cpu.ProgramCounter)
+	}
+
+	// The line stays asserted until the game acknowledges it
+	if !mapperIrq() {
+		test.Error("Taking the IRQ deasserted the line")
+	}
+
+	Ram.Write(0x8000, 0xD)
+	Ram.Write(0xA000, 0x00)
+
+	if mapperIrq() {
+		test.Error("Writing $D didn't acknowledge the IRQ")
+	}
+}
+
+func TestMapperState(test *testing.T) {
+	initRomTest()
+
+	dir, err := ioutil.TempDir("", "fergulator")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	SaveStateFile = filepath.Join(dir, "game.state")
+	defer func() { SaveStateFile = "" }()
+
+	// MMC3
+	m, err := LoadRom(testRom(8, 8, 0x40))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rom = m
+	mmc3 := m.(*Mmc3)
+
+	// Bank 3 at $8000, IRQ latch of 20, horizontal mirroring
+	Ram.Write(0x8000, 0x06)
+	Ram.Write(0x8001, 0x03)
+	Ram.Write(0xC000, 20)
+	Ram.Write(0xA000, 0x01)
+	Ram.Write(0x6000, 0x42)
+
+	SaveGameState()
+
+	Ram.Write(0x8000, 0x06)
+	Ram.Write(0x8001, 0x05)
+	Ram.Write(0xC000, 30)
+	Ram.Write(0xA000, 0x00)
+	Ram.Write(0x6000, 0x00)
+
+	LoadGameState()
+
+	if mmc3.PrgLowerLowBank != 3 {
+		test.Errorf("PRG bank was %d, expected 3", mmc3.PrgLowerLowBank)
+	}
+
+	if mmc3.IrqLatchValue != 20 {
+		test.Errorf("IRQ latch was %d, expected 20", mmc3.IrqLatchValue)
+	}
+
+	if ppu.Nametables.Mirroring != MirroringHorizontal {
+		test.Error("Mirroring wasn't restored")
+	}
+
+	if v, _ := Ram.Read(0x6000); v != 0x42 {
+		test.Errorf("Work RAM was 0x%X, expected 0x42", v)
+	}
+
+	s := NewSaveState()
+	mmc3.SerializeState(s)
+
+	s = NewLoadState(s.Data[:len(s.Data)-1])
+	mmc3.SerializeState(s)
+
+	if s.Err == nil {
+		test.Error("Truncated state should fail")
+	}
+}
@@ -44,8 +44,14 @@ func (m Memory) WriteMirroredRam(v Word, a int) {
 func (m Memory) Write(address interface{}, val Word) error {
 	if a, err := fitAddressSize(address); err == nil {
 		if a >= 0x2000 && a <= 0x2007 {
+			syncPpu()
 			ppu.RegWrite(val, a)
 			// m.WriteMirroredRam(val, a)
+		} else if a >= 0x4020 && a < 0x8000 && mapsCpuAddress(a) {
+			// Mapper registers, expansion audio and RAM
+			syncPpu()
+			rom.Write(val, a)
+			return nil
 		} else if a == 0x4014 {
 			ppu.RegWrite(val, a)
 			m[a] = val
@@ -59,16 +65,9 @@ func (m Memory) Write(address interface{}, val Word) error {
 		} else if a&0xF000 == 0x4000 {
 			apu.RegWrite(val, a)
 		} else if a >= 0x8000 && a <= 0xFFFF {
+			syncPpu()
 			rom.Write(val, a)
 			return nil
-		} else if a >= 0x5100 && a <= 0x6000 {
-			if v, ok := rom.(*Mmc5); ok {
-				// MMC5 register handling
-				v.Write(val, a)
-				return nil
-			}
-
-			m[a] = val
 		} else {
 			m[a] = val
 		}
@@ -83,9 +82,14 @@ func (m Memory) Read(a uint16) (Word, error) {
 	switch {
 	case a >= 0x2008 && a < 0x4000:
 		offset := a % 0x8
+		syncPpu()
 		return ppu.RegRead(int(0x2000 + offset))
 	case a <= 0x2007 && a >= 0x2000:
+		syncPpu()
 		return ppu.RegRead(int(a))
+	case a >= 0x4020 && a < 0x8000 && mapsCpuAddress(int(a)):
+		// Mapper registers, expansion audio and RAM
+		return rom.Read(int(a)), nil
 	case a == 0x4016:
 		return Pads[0].Read(), nil
 	case a == 0x4017:
@@ -94,12 +98,16 @@ func (m Memory) Read(a uint16) (Word, error) {
 		return apu.RegRead(int(a))
 	case a >= 0x8000 && a <= 0xFFFF:
 		return rom.Read(int(a)), nil
-	case a >= 0x5100 && a <= 0x6000:
-		if _, ok := rom.(*Mmc5); ok {
-			// MMC5 register handling
-			return rom.Read(int(a)), nil
-		}
 	}
 
 	return m[a], nil
 }
+
+// The PPU and mapper see the CPU's register accesses on the
+// instruction's last cycle, rather than once the whole
+// instruction has run
+func syncPpu() {
+	if cpu.Executing && runsPpu() {
+		ppu.CatchUp(cpu.CycleCount - 1)
+	}
+}
@@ -20,6 +20,7 @@ type Mmc1 struct {
 	ChrRomCount  int
 	Battery      bool
 	Data         []byte
+	Chr          *ChrMemory
 
 	Buffer        int
 	BufferCounter uint
@@ -41,6 +42,7 @@ func NewMmc1(r *Nrom) *Mmc1 {
 		ChrRomCount:  r.ChrRomCount,
 		Battery:      r.Battery,
 		Data:         r.Data,
+		Chr:          r.Chr,
 		PrgSwapBank:  BankLower,
 		PrgUpperBank: len(r.RomBanks) - 1,
 		ChrUpperBank: len(r.VromBanks) - 1,
@@ -81,11 +83,11 @@ func (m *Mmc1) Read(a int) Word {
 
 func (m *Mmc1) WriteVram(v Word, a int) {
 	if a >= 0x1000 {
-		m.VromBanks[m.ChrUpperBank][a&0xFFF] = v
+		m.Chr.WriteBank(v, m.ChrUpperBank, 0x1000, a&0xFFF)
 		return
 	}
 
-	m.VromBanks[m.ChrLowerBank][a&0xFFF] = v
+	m.Chr.WriteBank(v, m.ChrLowerBank, 0x1000, a&0xFFF)
 }
 
 func (m *Mmc1) ReadVram(a int) Word {
@@ -228,3 +230,22 @@ func (m *Mmc1) RegisterNumber(a int) int {
 
 	return 3
 }
+
+func (m *Mmc1) SerializeState(s *State) {
+	counter := int(m.BufferCounter)
+
+	s.Int(&m.Buffer)
+	s.Int(&counter)
+	s.Int(&m.PrgLowerBank)
+	s.Int(&m.PrgUpperBank)
+	s.Int(&m.PrgSwapBank)
+	s.Int(&m.PrgBankSize)
+	s.Int(&m.ChrBankSize)
+	s.Int(&m.ChrLowerBank)
+	s.Int(&m.ChrUpperBank)
+	s.Int(&m.Mirroring)
+
+	m.BufferCounter = uint(counter)
+
+	m.Chr.SerializeState(s)
+}
@@ -21,6 +21,10 @@ type Mmc2 struct {
 	ChrRomCount  int
 	Battery      bool
 	Data         []byte
+	Chr          *ChrMemory
+
+	// The MMC4 has 16k PRG banks
+	Mmc4 bool
 
 	LatchLow  int
 	LatchHigh int
@@ -29,6 +33,10 @@ type Mmc2 struct {
 	LatchFD0  int
 	LatchFD1  int
 
+	// The latches switch banks after the tile that
+	// triggered them has been fetched
+	LastFetch int
+
 	PrgUpperHighBank int
 	PrgUpperLowBank  int
 	PrgLowerHighBank int
@@ -46,6 +54,7 @@ func NewMmc2(r *Nrom) *Mmc2 {
 		ChrRomCount:  r.ChrRomCount,
 		Battery:      r.Battery,
 		Data:         r.Data,
+		Chr:          r.Chr,
 	}
 
 	m.LatchLow = 0xFE
@@ -60,6 +69,17 @@ func NewMmc2(r *Nrom) *Mmc2 {
 	return m
 }
 
+// The MMC4 has the same latches, with a 16k PRG bank
+// at $8000 and the last bank fixed at $C000
+func NewMmc4(r *Nrom) *Mmc2 {
+	m := NewMmc2(r)
+	m.Mmc4 = true
+
+	m.PrgBankSelect(0)
+
+	return m
+}
+
 func (m *Mmc2) Load() {
 	// 2x the banks since we're storing 8k per bank
 	// instead of 16k
@@ -75,29 +95,8 @@ func (m *Mmc2) Load() {
 		m.RomBanks[i] = bank
 	}
 
-	// Everything after PRG-ROM
-	chrRom := m.Data[0x2000*len(m.RomBanks):]
-
 	// CHR is stored in 4k banks
-	m.VromBanks = make([][]Word, m.ChrRomCount*2)
-
-	for i := 0; i < cap(m.VromBanks); i++ {
-		// Move 16kb chunk to 16kb bank
-		m.VromBanks[i] = make([]Word, 0x1000)
-
-		// If the game doesn't have CHR banks we
-		// just need to allocate VRAM
-
-		for x := 0; x < 0x1000; x++ {
-			var val Word
-			if m.ChrRomCount == 0 {
-				val = 0
-			} else {
-				val = Word(chrRom[(0x1000*i)+x])
-			}
-			m.VromBanks[i][x] = val
-		}
-	}
+	m.VromBanks = m.Chr.Banks(0x1000)
 
 	// The PRG banks are 8192 bytes in size, half the size of an
 	// iNES PRG bank. If your emulator or copier handles PRG data
@@ -136,19 +135,13 @@ func (m *Mmc2) Write(v Word, a int) {
 func (m *Mmc2) WriteVram(v Word, a int) {
 	switch {
 	case a >= 0x1000:
-		m.VromBanks[m.ChrHighBank][a&0xFFF] = v
+		m.Chr.WriteBank(v, m.ChrHighBank, 0x1000, a&0xFFF)
 	default:
-		m.VromBanks[m.ChrLowBank][a&0xFFF] = v
+		m.Chr.WriteBank(v, m.ChrLowBank, 0x1000, a&0xFFF)
 	}
 }
 
 func (m *Mmc2) ReadVram(a int) Word {
-	// TODO: Causes some minor glitching in the
-	// Punch Out! title screen. This used to happen
-	// in ppu.fetchTileAttributes()
-	m.LatchTrigger(ppu.bgPatternTableAddress(
-		ppu.Nametables.readNametableData(ppu.VramAddress)))
-
 	switch {
 	case a >= 0x1000:
 		return m.VromBanks[m.ChrHighBank][a&0xFFF]
@@ -181,23 +174,35 @@ func (m *Mmc2) Read(a int) Word {
 	return 0
 }
 
+func (m *Mmc2) PpuBus(a int, fetch int) {
+	m.LatchTrigger(m.LastFetch)
+	m.LastFetch = a
+}
+
+// The latches switch once the high plane of tile $FD or $FE has
+// been fetched, so both planes come from the old bank. The MMC2
+// only checks the first line of the tile in the low table.
 func (m *Mmc2) LatchTrigger(a int) {
-	a &= 0x3FF0
+	if !m.Mmc4 && a < 0x1000 && a&0x7 != 0 {
+		return
+	}
+
+	a &= 0x3FF8
 
 	switch {
-	case a == 0x0FD0 && m.LatchLow != 0xFD:
+	case a == 0x0FD8 && m.LatchLow != 0xFD:
 		m.LatchLow = 0xFD
 
 		m.ChrLowBank = m.LatchFD0 % len(m.VromBanks)
-	case a == 0x0FE0 && m.LatchLow != 0xFE:
+	case a == 0x0FE8 && m.LatchLow != 0xFE:
 		m.LatchLow = 0xFE
 
 		m.ChrLowBank = m.LatchFE0 % len(m.VromBanks)
-	case a == 0x1FD0 && m.LatchHigh != 0xFD:
+	case a == 0x1FD8 && m.LatchHigh != 0xFD:
 		m.LatchHigh = 0xFD
 
 		m.ChrHighBank = m.LatchFD1 % len(m.VromBanks)
-	case a == 0x1FE0 && m.LatchHigh != 0xFE:
+	case a == 0x1FE8 && m.LatchHigh != 0xFE:
 		m.LatchHigh = 0xFE
 
 		m.ChrHighBank = m.LatchFE1 % len(m.VromBanks)
@@ -228,6 +233,14 @@ func (m *Mmc2) RegisterNumber(a int) int {
 }
 
 func (m *Mmc2) PrgBankSelect(v Word) {
+	if m.Mmc4 {
+		bank := int(v&0xF) * 2
+
+		m.PrgLowerLowBank = bank % len(m.RomBanks)
+		m.PrgLowerHighBank = (bank + 1) % len(m.RomBanks)
+		return
+	}
+
 	m.PrgLowerLowBank = int(v&0xF) % len(m.RomBanks)
 }
 
@@ -269,3 +282,23 @@ func (m *Mmc2) MirroringSelect(v Word) {
 		ppu.Nametables.SetMirroring(MirroringVertical)
 	}
 }
+
+func (m *Mmc2) SerializeState(s *State) {
+	s.Int(&m.LatchLow)
+	s.Int(&m.LatchHigh)
+	s.Int(&m.LatchFE0)
+	s.Int(&m.LatchFE1)
+	s.Int(&m.LatchFD0)
+	s.Int(&m.LatchFD1)
+	s.Int(&m.LastFetch)
+
+	s.Int(&m.PrgUpperHighBank)
+	s.Int(&m.PrgUpperLowBank)
+	s.Int(&m.PrgLowerHighBank)
+	s.Int(&m.PrgLowerLowBank)
+
+	s.Int(&m.ChrHighBank)
+	s.Int(&m.ChrLowBank)
+
+	m.Chr.SerializeState(s)
+}
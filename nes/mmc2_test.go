@@ -0,0 +1,53 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestMmc4Banking(test *testing.T) {
+	loadMapperRom(test, 10, 0, 8, 8)
+
+	verifyPrgBank(0x8000, 0, test)
+	verifyPrgBank(0xC000, 7, test)
+
+	Ram.Write(0xA000, 0x03)
+
+	verifyPrgBank(0x8000, 3, test)
+	verifyPrgBank(0xC000, 7, test)
+
+	// $FE latches start out selected
+	Ram.Write(0xC000, 0x03)
+	Ram.Write(0xE000, 0x05)
+
+	verifyChrBank(0x0000, 3, test)
+	verifyChrBank(0x1000, 5, test)
+}
+
+func TestMmc2Latch(test *testing.T) {
+	m := loadMapperRom(test, 9, 0, 8, 8).(*Mmc2)
+
+	// $FD selects bank 2 and $FE bank 3
+	Ram.Write(0xB000, 0x02)
+	Ram.Write(0xC000, 0x03)
+
+	verifyChrBank(0x0000, 3, test)
+
+	// Both planes of tile $FD come from the old bank
+	m.PpuBus(0x0FD0, PpuFetchBackground)
+	if m.ChrLowBank != 3 {
+		test.Error("Latch switched before the low plane was fetched")
+	}
+
+	m.PpuBus(0x0FD8, PpuFetchBackground)
+	if m.ChrLowBank != 3 {
+		test.Error("Latch switched before the high plane was fetched")
+	}
+
+	m.PpuBus(0x2000, PpuFetchNametable)
+	verifyChrBank(0x0000, 2, test)
+
+	// The MMC2 only checks the first line of the tile
+	m.PpuBus(0x0FE9, PpuFetchBackground)
+	m.PpuBus(0x2000, PpuFetchNametable)
+	verifyChrBank(0x0000, 2, test)
+}
@@ -28,6 +28,24 @@ const (
 	RegisterIrqReload
 	RegisterIrqDisable
 	RegisterIrqEnable
+
+	// A12 has to be low for this many PPU cycles, a little
+	// over three M2 cycles, before a rise clocks the counter
+	Mmc3A12Filter = 10
+
+	// PPU cycles from the A12 rise until the CPU can see the
+	// IRQ. The CPU polls a cycle before the end of an
+	// instruction, and the MMC3 sets its flag two PPU cycles
+	// after the rise.
+	Mmc3IrqDelay = 5
+
+	// The MMC3A and NEC MMC3 fire IRQs differently
+	Mmc3SubmapperNec = 4
+
+	// Boards built around the MMC3
+	Mmc3SubmapperMmc6 = 1
+	Mmc3MapperTxSrom  = 118
+	Mmc3MapperTqRom   = 119
 )
 
 type Mmc3 struct {
@@ -38,6 +56,7 @@ type Mmc3 struct {
 	ChrRomCount  int
 	Battery      bool
 	Data         []byte
+	Chr          *ChrMemory
 
 	BankSelection   int
 	PrgBankMode     int
@@ -46,8 +65,31 @@ type Mmc3 struct {
 	IrqEnabled      bool
 	IrqLatchValue   Word
 	IrqCounter      Word
-	IrqReset        bool
-	IrqResetVbl     bool
+	IrqReloading    bool
+	IrqPending      bool
+	NecIrq          bool
+
+	A12      bool
+	A12Low   int
+	IrqCycle int
+
+	// The MMC6 has 1k of RAM at $7000, mirrored up to $7FFF,
+	// with reads and writes of each half enabled by $A001
+	Mmc6           bool
+	Mmc6RamEnabled bool
+	Mmc6Protect    Word
+
+	// TxSROM wires bit 7 of the CHR registers to the
+	// nametable select instead of the mirroring register
+	TxSrom bool
+
+	// TQROM has 8k of CHR-RAM after the CHR-ROM, selected
+	// by bit 6 of the CHR registers
+	TqRom       bool
+	ChrRomBanks int
+
+	// R0-R7 as last written
+	Registers [8]int
 
 	PrgUpperHighBank int
 	PrgUpperLowBank  int
@@ -72,6 +114,14 @@ func NewMmc3(r *Nrom) *Mmc3 {
 		ChrRomCount:  r.ChrRomCount,
 		Battery:      r.Battery,
 		Data:         r.Data,
+		Chr:          r.Chr,
+	}
+
+	if h := r.Header; h != nil {
+		m.NecIrq = h.Mapper == 4 && h.Submapper == Mmc3SubmapperNec
+		m.Mmc6 = h.Mapper == 4 && h.Submapper == Mmc3SubmapperMmc6
+		m.TxSrom = h.Mapper == Mmc3MapperTxSrom
+		m.TqRom = h.Mapper == Mmc3MapperTqRom
 	}
 
 	// This just needs to be non-zero and not a 1
@@ -80,6 +130,10 @@ func NewMmc3(r *Nrom) *Mmc3 {
 
 	m.Load()
 
+	if m.TxSrom {
+		m.MapNametables(&ppu.Nametables)
+	}
+
 	return m
 }
 
@@ -95,27 +149,19 @@ func (m *Mmc3) Load() {
 		}
 	}
 
-	// Everything after PRG-ROM
-	chrRom := m.Data[0x2000*2*m.PrgBankCount:]
-
-	// CHR is stored in 1k banks
-	if m.ChrRomCount > 0 {
-		m.VromBanks = make([]Word, (m.ChrRomCount*8)*0x0400)
-	} else {
-		m.VromBanks = make([]Word, 8*0x0400)
+	// TQROM has 8k of CHR-RAM alongside the ROM, even
+	// when the header doesn't say so
+	if m.TqRom && len(m.Chr.Ram()) < 0x2000 {
+		chrRom := m.Data[0x4000*m.PrgBankCount:]
+		m.Chr = NewChrMemory(chrRom[:m.Chr.RomSize], 0x2000)
 	}
 
-	for i := 0; i < m.ChrRomCount*8; i++ {
-		// Move 16kb chunk to 16kb bank
-		for x := 0; x < 0x0400; x++ {
-			var val Word
-			if m.ChrRomCount == 0 {
-				val = 0
-			} else {
-				val = Word(chrRom[(0x0400*i)+x])
-			}
-			m.VromBanks[(0x0400*i)+x] = val
-		}
+	// CHR is stored in 1k banks, and TQROM selects its RAM
+	// with bit 6 of the bank rather than by the bank number
+	m.VromBanks = m.Chr.Data
+	m.ChrRomBanks = len(m.VromBanks) >> 10
+	if m.TqRom {
+		m.ChrRomBanks = m.Chr.RomSize >> 10
 	}
 
 	// The PRG banks are 8192 bytes in size, half the size of an
@@ -142,6 +188,11 @@ func (m *Mmc3) BatteryBacked() bool {
 }
 
 func (m *Mmc3) Write(v Word, a int) {
+	if a < 0x8000 {
+		m.writeMmc6Ram(v, a)
+		return
+	}
+
 	switch m.RegisterNumber(a) {
 	case RegisterBankSelect:
 		m.BankSelect(int(v))
@@ -184,7 +235,7 @@ func (m *Mmc3) WriteVram(v Word, a int) {
 		addr = (m.Chr000Bank << 0xA) + a&0x3FF
 	}
 
-	m.VromBanks[addr] = v
+	m.Chr.Write(v, addr)
 }
 
 func (m *Mmc3) ReadVram(a int) Word {
@@ -237,7 +288,15 @@ func (m *Mmc3) ReadTile(a int) []Word {
 	return m.VromBanks[addr : addr+16]
 }
 
+func (m *Mmc3) MapsCpuAddress(a int) bool {
+	return m.Mmc6 && a >= 0x6000
+}
+
 func (m *Mmc3) Read(a int) Word {
+	if a < 0x8000 {
+		return m.readMmc6Ram(a)
+	}
+
 	var addr int
 
 	switch {
@@ -294,6 +353,14 @@ func (m *Mmc3) BankSelect(v int) {
 
 	m.PrgBankMode = address
 	m.ChrA12Inversion = (v >> 7) & 0x1
+
+	if m.Mmc6 {
+		m.Mmc6RamEnabled = v&0x20 == 0x20
+	}
+
+	if m.TxSrom {
+		mapNametables()
+	}
 }
 
 func (m *Mmc3) BankData(v int) {
@@ -321,13 +388,18 @@ func (m *Mmc3) BankData(v int) {
 		}
 	}
 
+	m.Registers[m.BankSelection] = v
+	if m.TxSrom && m.BankSelection <= ChrBank1k1C00 {
+		mapNametables()
+	}
+
 	switch m.BankSelection {
 	case ChrBank2k0000:
 		if m.ChrRomCount == 0 {
 			break
 		}
 
-		b := v % len(m.VromBanks)
+		b := m.chrBank(v)
 		if m.ChrA12Inversion == ChrA12InversionModeLow {
 			m.Chr000Bank = b
 			m.Chr400Bank = b + 1
@@ -340,7 +412,7 @@ func (m *Mmc3) BankData(v int) {
 			break
 		}
 
-		b := v % len(m.VromBanks)
+		b := m.chrBank(v)
 		if m.ChrA12Inversion == ChrA12InversionModeLow {
 			m.Chr800Bank = b
 			m.ChrC00Bank = b + 1
@@ -353,7 +425,7 @@ func (m *Mmc3) BankData(v int) {
 			break
 		}
 
-		b := v % len(m.VromBanks)
+		b := m.chrBank(v)
 		if m.ChrA12Inversion == ChrA12InversionModeLow {
 			m.Chr1000Bank = b
 		} else {
@@ -364,7 +436,7 @@ func (m *Mmc3) BankData(v int) {
 			break
 		}
 
-		b := v % len(m.VromBanks)
+		b := m.chrBank(v)
 		if m.ChrA12Inversion == ChrA12InversionModeLow {
 			m.Chr1400Bank = b
 		} else {
@@ -375,7 +447,7 @@ func (m *Mmc3) BankData(v int) {
 			break
 		}
 
-		b := v % len(m.VromBanks)
+		b := m.chrBank(v)
 		if m.ChrA12Inversion == ChrA12InversionModeLow {
 			m.Chr1800Bank = b
 		} else {
@@ -386,7 +458,7 @@ func (m *Mmc3) BankData(v int) {
 			break
 		}
 
-		b := v % len(m.VromBanks)
+		b := m.chrBank(v)
 		if m.ChrA12Inversion == ChrA12InversionModeLow {
 			m.Chr1C00Bank = b
 		} else {
@@ -424,7 +496,20 @@ func (m *Mmc3) BankData(v int) {
 	}
 }
 
+// Turns a CHR register value into a 1k bank
+func (m *Mmc3) chrBank(v int) int {
+	if m.TqRom && v&0x40 == 0x40 {
+		return m.ChrRomBanks + v&0x7
+	}
+
+	return v % m.ChrRomBanks
+}
+
 func (m *Mmc3) SetMirroring(v int) {
+	if m.TxSrom {
+		return
+	}
+
 	switch v & 0x1 {
 	case 0x0:
 		ppu.Nametables.SetMirroring(MirroringVertical)
@@ -434,10 +519,76 @@ func (m *Mmc3) SetMirroring(v int) {
 }
 
 func (m *Mmc3) RamProtection(v int) {
+	if m.Mmc6 {
+		// Only writable while the RAM is enabled
+		if m.Mmc6RamEnabled {
+			m.Mmc6Protect = Word(v)
+		}
+
+		return
+	}
+
 	// TODO: WhAT IS THIS I DON'T EVEN
 	fmt.Println("RamProtection register")
 }
 
+// Whether the half of MMC6 RAM at a can be read, and
+// whether it can be written
+func (m *Mmc3) mmc6Access(a int) (read, write bool) {
+	p := m.Mmc6Protect
+	if a&0x200 == 0x200 {
+		p >>= 2
+	}
+
+	// Writes need reads to be enabled too
+	read = m.Mmc6RamEnabled && p&0x10 == 0x10
+	write = read && p&0x20 == 0x20
+
+	return
+}
+
+func (m *Mmc3) readMmc6Ram(a int) Word {
+	// Open bus unless either half is readable
+	if a < 0x7000 || !m.Mmc6RamEnabled || m.Mmc6Protect&0x50 == 0 {
+		return Word(a >> 8)
+	}
+
+	if read, _ := m.mmc6Access(a); !read {
+		return 0
+	}
+
+	return Ram[0x7000|a&0x3FF]
+}
+
+func (m *Mmc3) writeMmc6Ram(v Word, a int) {
+	if _, write := m.mmc6Access(a); write && a >= 0x7000 {
+		Ram[0x7000|a&0x3FF] = v
+	}
+}
+
+// TxSROM nametables follow bit 7 of the registers for the 1k
+// CHR banks at $0000-$0FFF, which are R0 and R1 or R2-R5
+func (m *Mmc3) MapNametables(n *Nametable) {
+	if !m.TxSrom {
+		return
+	}
+
+	for i := 0; i < 4; i++ {
+		var r int
+		if m.ChrA12Inversion == ChrA12InversionModeLow {
+			r = m.Registers[i>>1]
+		} else {
+			r = m.Registers[ChrBank1k1000+i]
+		}
+
+		if r&0x80 == 0x80 {
+			n.MapTable(i, n.Page(NametableCiram1))
+		} else {
+			n.MapTable(i, n.Page(NametableCiram0))
+		}
+	}
+}
+
 func (m *Mmc3) IrqLatch(v int) {
 	// $C000
 	m.IrqLatchValue = Word(v)
@@ -445,20 +596,14 @@ func (m *Mmc3) IrqLatch(v int) {
 
 func (m *Mmc3) IrqReload(v int) {
 	// $C001
-	m.IrqCounter |= 0x80
-
-	if ppu.Scanline < 240 {
-		m.IrqReset = true
-	} else {
-		m.IrqResetVbl = true
-		m.IrqReset = false
-	}
+	m.IrqCounter = 0
+	m.IrqReloading = true
 }
 
 func (m *Mmc3) IrqDisable(v int) {
 	// $E000
 	m.IrqEnabled = false
-	m.IrqCounter = m.IrqLatchValue
+	m.IrqPending = false
 }
 
 func (m *Mmc3) IrqEnable(v int) {
@@ -466,27 +611,95 @@ func (m *Mmc3) IrqEnable(v int) {
 	m.IrqEnabled = true
 }
 
-func (m *Mmc3) Hook() {
-	// A12 Rising Edge
-	if (ppu.Scanline > -1 && ppu.Scanline < 240) && (ppu.ShowBackground || ppu.ShowSprites) {
-		if m.IrqResetVbl {
-			m.IrqCounter = m.IrqLatchValue
-			m.IrqResetVbl = false
-		}
+func (m *Mmc3) clockIrqCounter() {
+	previous := m.IrqCounter
 
-		if m.IrqReset {
-			m.IrqCounter = m.IrqLatchValue
-			m.IrqReset = false
-		} else if m.IrqCounter > 0 {
-			m.IrqCounter--
-		}
+	if m.IrqCounter == 0 || m.IrqReloading {
+		m.IrqCounter = m.IrqLatchValue
+	} else {
+		m.IrqCounter--
 	}
 
-	if m.IrqCounter == 0 {
-		if m.IrqEnabled {
-			cpu.RequestInterrupt(InterruptIrq)
+	fire := m.IrqCounter == 0
+	if m.NecIrq {
+		// Only when the counter is decremented to zero, or
+		// reloaded with zero after a $C001 write
+		fire = fire && (previous > 0 || m.IrqReloading)
+	}
+
+	if fire && m.IrqEnabled {
+		m.IrqPending = true
+		m.IrqCycle = ppu.BusCycle
+	}
+
+	m.IrqReloading = false
+}
+
+// The IRQ counter is clocked when A12 rises, which happens once
+// per scanline when the background and sprites use different
+// pattern tables. Short drops to fetch nametables are filtered
+// out, since the MMC3 only sees A12 low across M2 edges.
+func (m *Mmc3) PpuBus(a int, fetch int) {
+	if a&0x1000 == 0 {
+		if m.A12 {
+			m.A12 = false
+			m.A12Low = ppu.BusCycle
 		}
 
-		m.IrqReset = true
+		return
+	}
+
+	if !m.A12 && ppu.BusCycle-m.A12Low >= Mmc3A12Filter {
+		m.clockIrqCounter()
 	}
+
+	m.A12 = true
+}
+
+// The PPU fetches a line's tiles ahead of time, so the line
+// isn't pulled low until the PPU reaches the fetch that set it
+func (m *Mmc3) IrqAsserted() bool {
+	return m.IrqPending && ppu.Cycles >= m.IrqCycle+Mmc3IrqDelay
+}
+
+func (m *Mmc3) SerializeState(s *State) {
+	s.Int(&m.BankSelection)
+	s.Int(&m.PrgBankMode)
+	s.Int(&m.ChrA12Inversion)
+	s.Bool(&m.AddressChanged)
+
+	s.Bool(&m.IrqEnabled)
+	s.Word(&m.IrqLatchValue)
+	s.Word(&m.IrqCounter)
+	s.Bool(&m.IrqReloading)
+	s.Bool(&m.IrqPending)
+	s.Bool(&m.A12)
+
+	// These are PPU cycle counts, which aren't saved
+	if s.Loading {
+		m.A12Low = 0
+		m.IrqCycle = 0
+	}
+
+	s.Int(&m.PrgUpperHighBank)
+	s.Int(&m.PrgUpperLowBank)
+	s.Int(&m.PrgLowerHighBank)
+	s.Int(&m.PrgLowerLowBank)
+
+	s.Int(&m.Chr000Bank)
+	s.Int(&m.Chr400Bank)
+	s.Int(&m.Chr800Bank)
+	s.Int(&m.ChrC00Bank)
+	s.Int(&m.Chr1000Bank)
+	s.Int(&m.Chr1400Bank)
+	s.Int(&m.Chr1800Bank)
+	s.Int(&m.Chr1C00Bank)
+
+	s.Ints(m.RamProtectDest[:])
+
+	s.Bool(&m.Mmc6RamEnabled)
+	s.Word(&m.Mmc6Protect)
+	s.Ints(m.Registers[:])
+
+	m.Chr.SerializeState(s)
 }
@@ -0,0 +1,210 @@
+package nes
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+const (
+	testRomFrames = 600
+)
+
+func readTestRom(test *testing.T, filename string) []byte {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	return contents
+}
+
+// Runs one of blargg's test ROMs until it reports a result at
+// $6000, and returns the result code and the text it printed.
+// ok is false if it never reported one.
+func runTestRom(test *testing.T, contents []byte) (result Word, text string, ok bool) {
+	var err error
+
+	Ram = NewMemory()
+	Handler = NewNoopEventHandler()
+	cpu.Init()
+	apu.Init(func(int16) {})
+	ppu.Init()
+
+	Pads[0] = NewController(func(interface{}) int { return 0 })
+	Pads[1] = NewController(func(interface{}) int { return 0 })
+
+	if rom, err = LoadRom(contents); err != nil {
+		test.Fatal(err)
+	}
+
+	cpu.SetResetVector()
+
+	// The frames are only counted, not displayed
+	ppu.Output = make(chan []uint32, 1)
+	frames := 0
+
+	for frames < testRomFrames {
+		cycles := cpu.Step()
+
+		for i := 0; i < 3*cycles; i++ {
+			ppu.Step()
+		}
+
+		for i := 0; i < cycles; i++ {
+			apu.Step()
+		}
+
+		clockMapper(cycles)
+
+		select {
+		case <-ppu.Output:
+			frames++
+		default:
+		}
+
+		// $80 means the test is still running, and
+		// $81 that it needs a reset
+		running := Ram[0x6000] == 0x80 || Ram[0x6000] == 0x81
+		if !running && Ram[0x6001] == 0xDE && Ram[0x6002] == 0xB0 && Ram[0x6003] == 0x61 {
+			ok = true
+			break
+		}
+	}
+
+	var printed []byte
+	for a := 0x6004; a < 0x8000 && Ram[a] != 0; a++ {
+		printed = append(printed, byte(Ram[a]))
+	}
+
+	return Ram[0x6000], string(printed), ok
+}
+
+func TestMmc3TestRoms(test *testing.T) {
+	// The headers alone have to be enough
+	RomDatabaseEnabled = false
+	defer func() { RomDatabaseEnabled = true }()
+
+	for _, name := range []string{
+		"1-clocking.nes",
+		"2-details.nes",
+		"3-A12_clocking.nes",
+		"4-scanline_timing.nes",
+		"5-MMC3.nes",
+		"6-MMC3_alt.nes",
+	} {
+		contents := readTestRom(test, "../test_roms/mmc3_test_2/rom_singles/"+name)
+
+		// The alt test is for the MMC3A and NEC revisions,
+		// which an iNES header can't describe. It gets an
+		// NES 2.0 header with the submapper and 8k of PRG-RAM.
+		if name == "6-MMC3_alt.nes" {
+			contents[7] = contents[7]&0xF3 | 0x08
+			contents[8] = Mmc3SubmapperNec << 4
+			contents[10] = 0x07
+		}
+
+		result, text, ok := runTestRom(test, contents)
+
+		if !ok {
+			test.Errorf("%s didn't report a result within %d frames:\n%s", name, testRomFrames, text)
+		} else if result != 0 {
+			test.Errorf("%s failed with code %d:\n%s", name, result, text)
+		}
+	}
+}
+
+func TestMmc6Ram(test *testing.T) {
+	loadMapperRom(test, 4, Mmc3SubmapperMmc6, 8, 8)
+
+	// Enable the RAM, then reads and writes of the low half
+	Ram.Write(0x8000, 0x20)
+	Ram.Write(0xA001, 0x30)
+
+	Ram.Write(0x7000, 0x42)
+	if v, _ := Ram.Read(0x7400); v != 0x42 {
+		test.Errorf("Mirrored RAM read 0x%X, expected 0x42", v)
+	}
+
+	// The high half reads as 0 while the low half is readable
+	Ram.Write(0x7200, 0x55)
+	if v, _ := Ram.Read(0x7200); v != 0x00 {
+		test.Errorf("Disabled half read 0x%X, expected 0", v)
+	}
+
+	Ram.Write(0xA001, 0xC0)
+	if v, _ := Ram.Read(0x7200); v != 0x00 {
+		test.Errorf("Write to a protected half went through, read 0x%X", v)
+	}
+
+	// Open bus with neither half readable
+	Ram.Write(0xA001, 0x00)
+	if v, _ := Ram.Read(0x7000); v != 0x70 {
+		test.Errorf("Unreadable RAM read 0x%X, expected open bus", v)
+	}
+
+	// $A001 is ignored while the RAM is disabled
+	Ram.Write(0x8000, 0x00)
+	Ram.Write(0xA001, 0x30)
+	Ram.Write(0x8000, 0x20)
+
+	if v, _ := Ram.Read(0x7000); v != 0x70 {
+		test.Errorf("$A001 was written with the RAM disabled, read 0x%X", v)
+	}
+}
+
+func TestTxSromNametables(test *testing.T) {
+	loadMapperRom(test, Mmc3MapperTxSrom, 0, 8, 16)
+
+	n := &ppu.Nametables
+
+	// R0 covers the first two nametables, R1 the others
+	Ram.Write(0x8000, 0x00)
+	Ram.Write(0x8001, 0x80)
+	Ram.Write(0x8000, 0x01)
+	Ram.Write(0x8001, 0x00)
+
+	if n.LogicalTables[0] != &n.Nametable1 || n.LogicalTables[1] != &n.Nametable1 {
+		test.Error("R0 bit 7 didn't select the second nametable")
+	}
+
+	if n.LogicalTables[2] != &n.Nametable0 || n.LogicalTables[3] != &n.Nametable0 {
+		test.Error("R1 bit 7 didn't select the first nametable")
+	}
+
+	// The mirroring register does nothing
+	Ram.Write(0xA000, 0x01)
+	if n.LogicalTables[0] != &n.Nametable1 {
+		test.Error("Mirroring register changed the nametables")
+	}
+
+	// With CHR inversion R2-R5 pick one each
+	Ram.Write(0x8000, 0x85)
+	Ram.Write(0x8001, 0x80)
+
+	if n.LogicalTables[3] != &n.Nametable1 || n.LogicalTables[0] != &n.Nametable0 {
+		test.Error("R5 bit 7 didn't select the second nametable")
+	}
+}
+
+func TestTqRomChrRam(test *testing.T) {
+	m := loadMapperRom(test, Mmc3MapperTqRom, 0, 8, 8).(*Mmc3)
+
+	// CHR-RAM bank 1 at $1000
+	Ram.Write(0x8000, 0x02)
+	Ram.Write(0x8001, 0x41)
+
+	m.WriteVram(0x77, 0x1000)
+	if v := m.ReadVram(0x1000); v != 0x77 {
+		test.Errorf("CHR-RAM read 0x%X, expected 0x77", v)
+	}
+
+	if m.VromBanks[(m.ChrRomBanks+1)<<10] != 0x77 {
+		test.Error("CHR-RAM wasn't written after the CHR-ROM")
+	}
+
+	// Back to CHR-ROM
+	Ram.Write(0x8001, 0x01)
+	if v := m.ReadVram(0x1000); v == 0x77 {
+		test.Error("CHR-ROM bank read back the CHR-RAM")
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"fmt"
 )
 
+const (
+	// Two scanlines of CPU cycles
+	Mmc5IdleCycles = 2 * 341 / 3
+)
+
 type Mmc5 struct {
 	RomBanks  [][]Word
 	VromBanks [][]Word
@@ -14,6 +19,7 @@ type Mmc5 struct {
 	ChrRomCount  int
 	Battery      bool
 	Data         []byte
+	Chr          *ChrMemory
 
 	PrgSwitchMode   Word
 	ChrSwitchMode   Word
@@ -22,6 +28,16 @@ type Mmc5 struct {
 
 	FillModeTile  Word
 	FillModeColor Word
+	// Nametable of the fill tile and color
+	FillTable [0x400]Word
+
+	// $5200-$5202
+	SplitControl Word
+	SplitScroll  Word
+	SplitBank    Word
+
+	MultiplierA Word
+	MultiplierB Word
 
 	SelectedPrgRamChip Word
 
@@ -30,6 +46,19 @@ type Mmc5 struct {
 	IrqEnabled bool
 	IrqStatus  Word
 
+	// Scanlines are spotted by the PPU reading the same
+	// nametable address three times in a row, and the frame
+	// ends when the PPU stops fetching
+	LastPpuFetch     int
+	NametableMatches int
+	IdleCycles       int
+
+	// Whether the sprite or background CHR banks are
+	// swapped in, or -1 to swap on the next fetch
+	ChrFetch int
+
+	NametableMapping Word
+
 	PrgUpperHighBank int
 	PrgUpperLowBank  int
 	PrgLowerHighBank int
@@ -46,6 +75,10 @@ type Mmc5 struct {
 
 	SpriteSwapFunc [8]func()
 	BgSwapFunc     [4]func()
+
+	// $5120-$512B as last written, to rebuild the
+	// swap functions from
+	ChrRegisters [12]Word
 }
 
 func NewMmc5(r *Nrom) *Mmc5 {
@@ -56,9 +89,11 @@ func NewMmc5(r *Nrom) *Mmc5 {
 		ChrRomCount:  r.ChrRomCount,
 		Battery:      r.Battery,
 		Data:         r.Data,
+		Chr:          r.Chr,
 	}
 
 	m.PrgSwitchMode = 0x3
+	m.ChrFetch = -1
 
 	m.Load()
 
@@ -80,33 +115,8 @@ func (m *Mmc5) Load() {
 		m.RomBanks[i] = bank
 	}
 
-	// Everything after PRG-ROM
-	chrRom := m.Data[0x2000*len(m.RomBanks):]
-
 	// CHR is stored in 1k banks
-	if m.ChrRomCount > 0 {
-		m.VromBanks = make([][]Word, m.ChrRomCount*8)
-	} else {
-		m.VromBanks = make([][]Word, 2)
-	}
-
-	for i := 0; i < cap(m.VromBanks); i++ {
-		// Move 16kb chunk to 16kb bank
-		m.VromBanks[i] = make([]Word, 0x0400)
-
-		// If the game doesn't have CHR banks we
-		// just need to allocate VRAM
-
-		for x := 0; x < 0x0400; x++ {
-			var val Word
-			if m.ChrRomCount == 0 {
-				val = 0
-			} else {
-				val = Word(chrRom[(0x0400*i)+x])
-			}
-			m.VromBanks[i][x] = val
-		}
-	}
+	m.VromBanks = m.Chr.Banks(0x400)
 
 	// The PRG banks are 8192 bytes in size, half the size of an
 	// iNES PRG bank. If your emulator or copier handles PRG data
@@ -142,15 +152,19 @@ func (m *Mmc5) Write(v Word, a int) {
 		// Extended RAM mode
 		fmt.Printf("Extended RAM mode: 0x%X\n", v&0x3)
 		m.ExtendedRamMode = v & 0x3
+		mapNametables()
 	case 0x5105:
 		// Nametable mapping
-		m.SetNametableMapping(v)
+		m.NametableMapping = v
+		mapNametables()
 	case 0x5106:
 		// Fill-mode tile
 		m.FillModeTile = v
+		m.updateFillTable()
 	case 0x5107:
-		// Fill-mode tile
+		// Fill-mode color
 		m.FillModeColor = v & 0x3
+		m.updateFillTable()
 	case 0x5113:
 		// PRG-RAM bank
 		m.SelectedPrgRamChip = ((v >> 2) & 0x1)
@@ -466,12 +480,30 @@ func (m *Mmc5) Write(v Word, a int) {
 		// IRQ Counter
 		m.IrqLatch = int(v)
 		m.IrqCounter = 0
+	case 0x5200:
+		// Vertical split mode
+		m.SplitControl = v
+	case 0x5201:
+		// Vertical split scroll
+		m.SplitScroll = v
+	case 0x5202:
+		// Vertical split CHR bank
+		m.SplitBank = v
 	case 0x5204:
 		m.IrqEnabled = (v&0x80 == 0x80)
+	case 0x5205:
+		m.MultiplierA = v
+	case 0x5206:
+		m.MultiplierB = v
 	default:
 		// fmt.Printf("Unhandled write to: 0x%X -> 0x%X\n", a, v)
 	}
 
+	if a >= 0x5120 && a <= 0x512B {
+		m.ChrRegisters[a-0x5120] = v
+		m.ChrFetch = -1
+	}
+
 	if a >= 0x5C00 && a <= 0x5FFF {
 		if m.ExtendedRamMode != 0x3 {
 			Ram[a] = v
@@ -483,21 +515,21 @@ func (m *Mmc5) Write(v Word, a int) {
 func (m *Mmc5) WriteVram(v Word, a int) {
 	switch {
 	case a >= 0x1C00:
-		m.VromBanks[m.Chr1C00Bank][a&0x3FF] = v
+		m.Chr.WriteBank(v, m.Chr1C00Bank, 0x400, a&0x3FF)
 	case a >= 0x1800:
-		m.VromBanks[m.Chr1800Bank][a&0x3FF] = v
+		m.Chr.WriteBank(v, m.Chr1800Bank, 0x400, a&0x3FF)
 	case a >= 0x1400:
-		m.VromBanks[m.Chr1400Bank][a&0x3FF] = v
+		m.Chr.WriteBank(v, m.Chr1400Bank, 0x400, a&0x3FF)
 	case a >= 0x1000:
-		m.VromBanks[m.Chr1000Bank][a&0x3FF] = v
+		m.Chr.WriteBank(v, m.Chr1000Bank, 0x400, a&0x3FF)
 	case a >= 0x0C00:
-		m.VromBanks[m.ChrC00Bank][a&0x3FF] = v
+		m.Chr.WriteBank(v, m.ChrC00Bank, 0x400, a&0x3FF)
 	case a >= 0x0800:
-		m.VromBanks[m.Chr800Bank][a&0x3FF] = v
+		m.Chr.WriteBank(v, m.Chr800Bank, 0x400, a&0x3FF)
 	case a >= 0x0400:
-		m.VromBanks[m.Chr400Bank][a&0x3FF] = v
+		m.Chr.WriteBank(v, m.Chr400Bank, 0x400, a&0x3FF)
 	default:
-		m.VromBanks[m.Chr000Bank][a&0x3FF] = v
+		m.Chr.WriteBank(v, m.Chr000Bank, 0x400, a&0x3FF)
 	}
 }
 
@@ -557,6 +589,10 @@ func (m *Mmc5) Read(a int) Word {
 		switch {
 		case a == 0x5204:
 			return m.ReadIrqStatus()
+		case a == 0x5205:
+			return Word(int(m.MultiplierA) * int(m.MultiplierB))
+		case a == 0x5206:
+			return Word((int(m.MultiplierA) * int(m.MultiplierB)) >> 8)
 		case a >= 0x5C00 && a <= 0x5FFF:
 			if m.ExtendedRamMode == 0x2 || m.ExtendedRamMode == 0x3 {
 				return m.ExtendedRam[a-0x5C00]
@@ -573,67 +609,227 @@ func (m *Mmc5) BatteryBacked() bool {
 	return m.Battery
 }
 
-func (m *Mmc5) SetNametableMapping(v Word) {
-	var i Word
-	for i = 0; i < 4; i++ {
-		bits := (v >> (i * 2)) & 0x3
+func (m *Mmc5) MapsCpuAddress(a int) bool {
+	return a >= 0x5100 && a <= 0x6000
+}
+
+func (m *Mmc5) MapNametables(n *Nametable) {
+	for i := 0; i < 4; i++ {
+		bits := (m.NametableMapping >> uint(i*2)) & 0x3
 		switch bits {
 		case 0:
-			ppu.Nametables.LogicalTables[i] = &ppu.Nametables.Nametable0
+			n.MapTable(i, n.Page(NametableCiram0))
 		case 1:
-			ppu.Nametables.LogicalTables[i] = &ppu.Nametables.Nametable1
+			n.MapTable(i, n.Page(NametableCiram1))
 		case 2:
 			if m.ExtendedRamMode <= 0x1 {
-				ppu.Nametables.LogicalTables[i] = &m.ExtendedRam
+				n.MapTable(i, &m.ExtendedRam)
 			} else {
-				var fillmode [0x400]Word
-				ppu.Nametables.LogicalTables[i] = &fillmode
+				// ExRAM reads back as zeroes
+				var empty [0x400]Word
+				n.MapReadOnlyTable(i, &empty)
 			}
 		case 3:
-			var fillmode [0x400]Word
-			ppu.Nametables.LogicalTables[i] = &fillmode
+			n.MapReadOnlyTable(i, &m.FillTable)
+		}
+	}
+}
+
+func (m *Mmc5) updateFillTable() {
+	color := m.FillModeColor
+	color |= color<<2 | color<<4 | color<<6
+
+	for i := range m.FillTable {
+		if i < 0x3C0 {
+			m.FillTable[i] = m.FillModeTile
+		} else {
+			m.FillTable[i] = color
 		}
 	}
 }
 
+// Reads a pattern row from a 4k CHR bank, outside of the
+// regular banking
+func (m *Mmc5) readChr4k(bank int, a int) Word {
+	a += bank * 0x1000
+	return m.VromBanks[(a>>10)%len(m.VromBanks)][a&0x3FF]
+}
+
+// Tiles inside the split come from ExRAM, scrolled separately
+// and with their own CHR bank. Otherwise in ExRAM mode 1 each
+// tile picks its own 4k CHR bank and palette from ExRAM.
+func (m *Mmc5) FetchBackground(v int, column int, line int) (low, high, palette Word, ok bool) {
+	if m.ExtendedRamMode <= 0x1 && m.inSplit(column) {
+		y := (int(m.SplitScroll) + line) % 240
+
+		x := column & 0x1F
+		tile := int(m.ExtendedRam[(y>>3)*32+x])
+
+		attr := m.ExtendedRam[0x3C0+(y>>5)*8+(x>>2)]
+		shift := uint((y>>2)&0x4 | x&0x2)
+
+		a := tile*16 + (y & 0x7)
+		return m.readChr4k(int(m.SplitBank), a), m.readChr4k(int(m.SplitBank), a+8), (attr >> shift) & 0x3, true
+	}
+
+	if m.ExtendedRamMode == 0x1 {
+		ex := m.ExtendedRam[v&0x3FF]
+		bank := int(m.ChrUpperBits)<<6 | int(ex&0x3F)
+
+		a := int(ppu.Nametables.readNametableData(v))*16 + (v >> 12)
+		return m.readChr4k(bank, a), m.readChr4k(bank, a+8), ex >> 6, true
+	}
+
+	return
+}
+
+func (m *Mmc5) inSplit(column int) bool {
+	if m.SplitControl&0x80 == 0 {
+		return false
+	}
+
+	threshold := int(m.SplitControl & 0x1F)
+	if m.SplitControl&0x40 == 0 {
+		// Left side
+		return column < threshold
+	}
+
+	return column >= threshold
+}
+
 func (m *Mmc5) SwapSpriteVram() {
 	for _, s := range m.SpriteSwapFunc {
-		s()
+		// Registers that haven't been written yet
+		if s != nil {
+			s()
+		}
 	}
 }
 
 func (m *Mmc5) SwapBgVram() {
 	for _, bg := range m.BgSwapFunc {
-		bg()
+		if bg != nil {
+			bg()
+		}
 	}
 }
 
 func (m *Mmc5) ReadIrqStatus() Word {
 	result := m.IrqStatus
 	m.IrqStatus &= 0x7F
-	cpu.RequestInterrupt(InterruptNone)
 
 	return result
 }
 
-func (m *Mmc5) NotifyScanline() {
-	if ppu.Scanline < 240 && ppu.Scanline > -1 {
-		if m.IrqStatus&0x40 == 0x40 {
-			// If In-Frame flag is set
-			m.IrqCounter++
-			if m.IrqCounter == m.IrqLatch {
-				m.IrqStatus |= 0x80
-
-				if m.IrqEnabled {
-					cpu.RequestInterrupt(InterruptIrq)
-				}
-			}
+func (m *Mmc5) IrqAsserted() bool {
+	return m.IrqEnabled && m.IrqStatus&0x80 == 0x80
+}
+
+func (m *Mmc5) PpuBus(a int, fetch int) {
+	m.IdleCycles = 0
+
+	switch fetch {
+	case PpuFetchNametable:
+		if a == m.LastPpuFetch {
+			m.NametableMatches++
 		} else {
-			m.IrqStatus = 0x40
-			m.IrqCounter = 0
-			cpu.RequestInterrupt(InterruptNone)
+			m.NametableMatches = 0
 		}
-	} else {
+
+		if m.NametableMatches == 2 {
+			m.NametableMatches = 0
+			m.NotifyScanline()
+		}
+	case PpuFetchBackground:
+		if m.ChrFetch != fetch {
+			m.SwapBgVram()
+			m.ChrFetch = fetch
+		}
+	case PpuFetchSprite:
+		if m.ChrFetch != fetch {
+			m.SwapSpriteVram()
+			m.ChrFetch = fetch
+		}
+	}
+
+	m.LastPpuFetch = a
+}
+
+// The PPU renders a line's background in one go, so it can
+// be quiet for most of a scanline without having stopped
+func (m *Mmc5) Clock(cycles int) {
+	if m.IdleCycles > Mmc5IdleCycles {
+		return
+	}
+
+	m.IdleCycles += cycles
+	if m.IdleCycles > Mmc5IdleCycles {
+		// Out of frame
 		m.IrqStatus &= 0xBF
+		m.LastPpuFetch = -1
+		m.NametableMatches = 0
 	}
 }
+
+func (m *Mmc5) NotifyScanline() {
+	if m.IrqStatus&0x40 == 0x40 {
+		// If In-Frame flag is set
+		m.IrqCounter++
+		if m.IrqCounter == m.IrqLatch {
+			m.IrqStatus |= 0x80
+		}
+	} else {
+		m.IrqStatus = 0x40
+		m.IrqCounter = 0
+	}
+}
+
+func (m *Mmc5) SerializeState(s *State) {
+	s.Words(m.ExtendedRam[:])
+
+	s.Word(&m.PrgSwitchMode)
+	s.Word(&m.ChrSwitchMode)
+	s.Word(&m.ExtendedRamMode)
+	s.Word(&m.ChrUpperBits)
+	s.Word(&m.FillModeTile)
+	s.Word(&m.FillModeColor)
+	s.Word(&m.SplitControl)
+	s.Word(&m.SplitScroll)
+	s.Word(&m.SplitBank)
+	s.Word(&m.MultiplierA)
+	s.Word(&m.MultiplierB)
+	s.Word(&m.SelectedPrgRamChip)
+	s.Word(&m.NametableMapping)
+
+	s.Int(&m.IrqLatch)
+	s.Int(&m.IrqCounter)
+	s.Bool(&m.IrqEnabled)
+	s.Word(&m.IrqStatus)
+
+	s.Int(&m.PrgUpperHighBank)
+	s.Int(&m.PrgUpperLowBank)
+	s.Int(&m.PrgLowerHighBank)
+	s.Int(&m.PrgLowerLowBank)
+
+	s.Int(&m.Chr000Bank)
+	s.Int(&m.Chr400Bank)
+	s.Int(&m.Chr800Bank)
+	s.Int(&m.ChrC00Bank)
+	s.Int(&m.Chr1000Bank)
+	s.Int(&m.Chr1400Bank)
+	s.Int(&m.Chr1800Bank)
+	s.Int(&m.Chr1C00Bank)
+
+	s.Words(m.ChrRegisters[:])
+
+	if s.Loading {
+		for i, v := range m.ChrRegisters {
+			m.Write(v, 0x5120+i)
+		}
+
+		copy(Ram[0x5C00:0x6000], m.ExtendedRam[:])
+		m.updateFillTable()
+	}
+
+	m.Chr.SerializeState(s)
+}
@@ -0,0 +1,116 @@
+package nes
+
+import (
+	"testing"
+)
+
+func initMmc5Test(test *testing.T) *Mmc5 {
+	initRomTest()
+
+	m, err := LoadRom(testRom(2, 2, 0x50))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rom = m
+
+	return m.(*Mmc5)
+}
+
+func TestMmc5Multiplier(test *testing.T) {
+	initMmc5Test(test)
+
+	Ram.Write(0x5205, 0x12)
+	Ram.Write(0x5206, 0x34)
+
+	low, _ := Ram.Read(0x5205)
+	high, _ := Ram.Read(0x5206)
+
+	if low != 0xA8 || high != 0x03 {
+		test.Errorf("Product was 0x%X%02X, expected 0x3A8", high, low)
+	}
+}
+
+func TestMmc5FillMode(test *testing.T) {
+	initMmc5Test(test)
+
+	Ram.Write(0x5106, 0x42)
+	Ram.Write(0x5107, 0x02)
+	Ram.Write(0x5105, 0xFF)
+
+	if v := ppu.Nametables.readNametableData(0x2C00); v != 0x42 {
+		test.Errorf("Fill tile was 0x%X, expected 0x42", v)
+	}
+
+	if v := ppu.Nametables.readNametableData(0x23C0); v != 0xAA {
+		test.Errorf("Fill attribute was 0x%X, expected 0xAA", v)
+	}
+
+	// Writes to the fill table are ignored
+	ppu.Nametables.writeNametableData(0x2C00, 0x11)
+	if v := ppu.Nametables.readNametableData(0x2C00); v != 0x42 {
+		test.Errorf("Fill tile was written, read 0x%X", v)
+	}
+}
+
+func TestMmc5ExtendedAttributes(test *testing.T) {
+	m := initMmc5Test(test)
+
+	Ram.Write(0x5104, 0x01)
+
+	// Tile 5 at the second nametable entry, using 4k CHR
+	// bank 2 and palette 3
+	ppu.Nametables.writeNametableData(0x2001, 5)
+	Ram.Write(0x5C01, 0xC2)
+
+	m.VromBanks[2*4][5*16+3] = 0x11
+	m.VromBanks[2*4][5*16+8+3] = 0x22
+
+	ppu.VramAddress = 0x3001
+	low, high, attr := ppu.fetchTileAttributes(1)
+
+	if low != 0x11 || high != 0x22 {
+		test.Errorf("Pattern was 0x%X 0x%X, expected 0x11 0x22", low, high)
+	}
+
+	if attr != 3<<2 {
+		test.Errorf("Palette was %d, expected 3", attr>>2)
+	}
+}
+
+func TestMmc5VerticalSplit(test *testing.T) {
+	m := initMmc5Test(test)
+
+	// Four tiles on the left, scrolled down 8 lines, from
+	// 4k CHR bank 3
+	Ram.Write(0x5200, 0x84)
+	Ram.Write(0x5201, 0x08)
+	Ram.Write(0x5202, 0x03)
+
+	// Line 2 is row 1 of the split, with fine Y of 2
+	Ram.Write(0x5C00+32+2, 5)
+	Ram.Write(0x5C00+0x3C0, 0x0C)
+
+	m.VromBanks[3*4][5*16+2] = 0x33
+	m.VromBanks[3*4][5*16+8+2] = 0x44
+
+	ppu.Scanline = 2
+	ppu.VramAddress = 0x2000
+
+	// The first fetch of the line is the third column
+	low, high, attr := ppu.fetchTileAttributes(1)
+
+	if low != 0x33 || high != 0x44 {
+		test.Errorf("Pattern was 0x%X 0x%X, expected 0x33 0x44", low, high)
+	}
+
+	if attr != 3<<2 {
+		test.Errorf("Palette was %d, expected 3", attr>>2)
+	}
+
+	// Past the split the nametable is used
+	ppu.VramAddress = 0x2002
+	if low, _, _ := ppu.fetchTileAttributes(9 * 8); low == 0x33 {
+		test.Error("Tile past the split came from the split")
+	}
+}
@@ -0,0 +1,103 @@
+package nes
+
+const (
+	// Length counters and envelopes are clocked at
+	// a fixed 240Hz, independent of the APU
+	Mmc5FrameCycles = 7457
+)
+
+// Two pulse channels that behave like the APU's (minus the
+// sweep unit), plus a raw 8-bit PCM channel
+type Mmc5Audio struct {
+	Square1 Square
+	Square2 Square
+
+	PcmReadMode bool
+	Pcm         Word
+
+	FrameCycles int
+	Sample      float64
+}
+
+func (m *Mmc5Audio) Write(v Word, a int) {
+	switch a {
+	case 0x5000:
+		m.Square1.WriteControl(v)
+	case 0x5002:
+		m.Square1.WriteLow(v)
+	case 0x5003:
+		m.Square1.WriteHigh(v)
+	case 0x5004:
+		m.Square2.WriteControl(v)
+	case 0x5006:
+		m.Square2.WriteLow(v)
+	case 0x5007:
+		m.Square2.WriteHigh(v)
+	case 0x5010:
+		m.PcmReadMode = v&0x1 == 0x1
+	case 0x5011:
+		// Writing zero has no effect
+		if !m.PcmReadMode && v != 0 {
+			m.Pcm = v
+		}
+	case 0x5015:
+		m.Square1.Enabled = v&0x1 == 0x1
+		m.Square2.Enabled = v&0x2 == 0x2
+
+		if !m.Square1.Enabled {
+			m.Square1.Length = 0
+		}
+
+		if !m.Square2.Enabled {
+			m.Square2.Length = 0
+		}
+	}
+}
+
+func (m *Mmc5Audio) Read(a int) Word {
+	if a == 0x5015 {
+		var status Word
+		if m.Square1.Length > 0 {
+			status |= 0x1
+		}
+
+		if m.Square2.Length > 0 {
+			status |= 0x2
+		}
+
+		return status
+	}
+
+	return 0
+}
+
+// Called once per CPU cycle
+func (m *Mmc5Audio) Clock() {
+	if m.Square1.Enabled {
+		m.Square1.Clock()
+	}
+
+	if m.Square2.Enabled {
+		m.Square2.Clock()
+	}
+
+	m.FrameCycles++
+	if m.FrameCycles == Mmc5FrameCycles {
+		m.FrameCycles = 0
+
+		for _, s := range []*Square{&m.Square1, &m.Square2} {
+			if s.LengthEnabled && s.Length > 0 {
+				s.Length--
+			}
+
+			s.Envelope.ClockDecay()
+		}
+	}
+}
+
+func (m *Mmc5Audio) Output() float64 {
+	pulse := apu.PulseOut[m.Square1.Sample+m.Square2.Sample]
+	pcm := float64(m.Pcm) / 255 * 0.25
+
+	return pulse + pcm
+}
@@ -0,0 +1,366 @@
+package nes
+
+import (
+	"fmt"
+)
+
+const (
+	// Each channel update takes 15 CPU cycles, and only one
+	// channel is updated at a time
+	Namco163ChannelCycles = 15
+	Namco163Volume        = 0.0012
+)
+
+type Namco163 struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	// 128 bytes of internal RAM, shared between the
+	// wavetable samples and the channel registers
+	InternalRam      [0x80]Word
+	RamAddress       Word
+	RamAutoIncrement bool
+
+	IrqCounter int
+	IrqEnabled bool
+	IrqPending bool
+
+	PrgBanks      [4]int
+	ChrBanks      [8]Word
+	NametableBank [4]Word
+
+	// When set, CHR values $E0-$FF for the low/high pattern
+	// table select CHR-ROM instead of CIRAM
+	ChrRamLowDisabled  bool
+	ChrRamHighDisabled bool
+
+	SoundDisabled bool
+	WriteProtect  Word
+
+	ChannelCycles  int
+	CurrentChannel int
+	ChannelOutput  [8]int
+
+	// Accumulated output since the last sample was pulled
+	OutputSum    int
+	OutputCycles int
+}
+
+func NewNamco163(r *Nrom) *Namco163 {
+	m := &Namco163{
+		PrgBankCount: r.PrgBankCount,
+		ChrRomCount:  r.ChrRomCount,
+		Battery:      r.Battery,
+		Data:         r.Data,
+		Chr:          r.Chr,
+	}
+
+	m.Load()
+
+	apu.Expansion = append(apu.Expansion, m)
+
+	return m
+}
+
+func (m *Namco163) Load() {
+	// 2x the banks since we're storing 8k per bank
+	// instead of 16k
+	fmt.Printf("  Emulated PRG banks: %d\n", 2*m.PrgBankCount)
+	m.RomBanks = make([][]Word, 2*m.PrgBankCount)
+	for i := 0; i < 2*m.PrgBankCount; i++ {
+		// Move 8kb chunk to 8kb bank
+		bank := make([]Word, 0x2000)
+		for x := 0; x < 0x2000; x++ {
+			bank[x] = Word(m.Data[(0x2000*i)+x])
+		}
+
+		m.RomBanks[i] = bank
+	}
+
+	// CHR is switched in 1k banks
+	m.VromBanks = m.Chr.Banks(0x400)
+
+	m.PrgBanks[0] = 0
+	m.PrgBanks[1] = 1 % len(m.RomBanks)
+	m.PrgBanks[2] = (len(m.RomBanks) - 2) % len(m.RomBanks)
+	// Last bank is hardwired to $E000
+	m.PrgBanks[3] = len(m.RomBanks) - 1
+
+	for i := 0; i < 8; i++ {
+		m.ChrBanks[i] = Word(i)
+	}
+}
+
+func (m *Namco163) BatteryBacked() bool {
+	return m.Battery
+}
+
+// Internal RAM is saved after the work RAM
+func (m *Namco163) BatteryData() []Word {
+	return m.InternalRam[:]
+}
+
+// Sound RAM and IRQ registers, and the write protected
+// PRG-RAM
+func (m *Namco163) MapsCpuAddress(a int) bool {
+	return a >= 0x4800
+}
+
+// $F800 has to be written with $4x to enable PRG-RAM writes,
+// and the low bits each protect 2k of it
+func (m *Namco163) prgRamWritable(a int) bool {
+	return m.WriteProtect&0xF0 == 0x40 && m.WriteProtect>>uint((a-0x6000)>>11)&0x1 == 0
+}
+
+func (m *Namco163) Write(v Word, a int) {
+	switch {
+	case a >= 0x6000 && a <= 0x7FFF:
+		if m.prgRamWritable(a) {
+			Ram[a] = v
+		}
+	case a >= 0x4800 && a <= 0x4FFF:
+		// Sound RAM data port
+		m.InternalRam[m.RamAddress] = v
+		m.incrementRamAddress()
+	case a >= 0x5000 && a <= 0x57FF:
+		// IRQ counter low 8 bits, acknowledges the IRQ
+		m.IrqCounter = (m.IrqCounter & 0x7F00) | int(v)
+		m.IrqPending = false
+	case a >= 0x5800 && a <= 0x5FFF:
+		// IRQ counter high 7 bits and the enable flag
+		m.IrqCounter = (m.IrqCounter & 0xFF) | (int(v&0x7F) << 8)
+		m.IrqEnabled = v&0x80 == 0x80
+		m.IrqPending = false
+	case a >= 0x8000 && a <= 0xBFFF:
+		// CHR banks for $0000-$1FFF
+		m.ChrBanks[(a-0x8000)>>11] = v
+	case a >= 0xC000 && a <= 0xDFFF:
+		// CHR banks for $2000-$2FFF
+		m.NametableBank[(a-0xC000)>>11] = v
+		mapNametables()
+	case a >= 0xE000 && a <= 0xE7FF:
+		m.PrgBanks[0] = int(v&0x3F) % len(m.RomBanks)
+		m.SoundDisabled = v&0x40 == 0x40
+	case a >= 0xE800 && a <= 0xEFFF:
+		m.PrgBanks[1] = int(v&0x3F) % len(m.RomBanks)
+		m.ChrRamLowDisabled = v&0x40 == 0x40
+		m.ChrRamHighDisabled = v&0x80 == 0x80
+	case a >= 0xF000 && a <= 0xF7FF:
+		m.PrgBanks[2] = int(v&0x3F) % len(m.RomBanks)
+	case a >= 0xF800:
+		// PRG-RAM write protect, which shares the register
+		// with the sound RAM address port
+		m.WriteProtect = v
+		m.RamAddress = v & 0x7F
+		m.RamAutoIncrement = v&0x80 == 0x80
+	}
+}
+
+func (m *Namco163) Read(a int) Word {
+	switch {
+	case a >= 0x8000:
+		return m.RomBanks[m.PrgBanks[(a-0x8000)>>13]][a&0x1FFF]
+	case a >= 0x6000:
+		return Ram[a]
+	case a >= 0x4800 && a <= 0x4FFF:
+		v := m.InternalRam[m.RamAddress]
+		m.incrementRamAddress()
+
+		return v
+	case a >= 0x5000 && a <= 0x57FF:
+		return Word(m.IrqCounter & 0xFF)
+	case a >= 0x5800 && a <= 0x5FFF:
+		v := Word(m.IrqCounter>>8) & 0x7F
+		if m.IrqEnabled {
+			v |= 0x80
+		}
+
+		return v
+	}
+
+	return 0
+}
+
+func (m *Namco163) incrementRamAddress() {
+	if m.RamAutoIncrement {
+		m.RamAddress = (m.RamAddress + 1) & 0x7F
+	}
+}
+
+// Returns the 1k bank mapped into the pattern tables at the
+// given address, and whether it's a CIRAM page rather than CHR
+func (m *Namco163) chrBank(a int) (int, bool) {
+	slot := (a >> 10) & 0x7
+	bank := int(m.ChrBanks[slot])
+
+	ciramDisabled := m.ChrRamLowDisabled
+	if slot >= 4 {
+		ciramDisabled = m.ChrRamHighDisabled
+	}
+
+	if bank >= 0xE0 && !ciramDisabled {
+		return NametableCiram0 + bank&0x1, true
+	}
+
+	return bank % len(m.VromBanks), false
+}
+
+func (m *Namco163) chrPage(a int) []Word {
+	bank, ciram := m.chrBank(a)
+	if ciram {
+		return ppu.Nametables.Page(bank)[:]
+	}
+
+	return m.VromBanks[bank]
+}
+
+func (m *Namco163) WriteVram(v Word, a int) {
+	bank, ciram := m.chrBank(a)
+	if ciram {
+		ppu.Nametables.Page(bank)[a&0x3FF] = v
+		return
+	}
+
+	m.Chr.WriteBank(v, bank, 0x400, a&0x3FF)
+}
+
+func (m *Namco163) ReadVram(a int) Word {
+	return m.chrPage(a)[a&0x3FF]
+}
+
+func (m *Namco163) ReadTile(a int) []Word {
+	return m.chrPage(a)[a&0x3FF : a&0x3FF+16]
+}
+
+func (m *Namco163) MapNametables(n *Nametable) {
+	for i, bank := range m.NametableBank {
+		if bank >= 0xE0 {
+			n.MapTable(i, n.Page(NametableCiram0+int(bank&0x1)))
+			continue
+		}
+
+		b := int(bank) % len(m.VromBanks)
+		page := (*[0x400]Word)(m.VromBanks[b])
+
+		if b*0x400 < m.Chr.RomSize {
+			n.MapReadOnlyTable(i, page)
+		} else {
+			n.MapTable(i, page)
+		}
+	}
+}
+
+// Called once per CPU instruction with the number of
+// cycles it took
+func (m *Namco163) Clock(cycles int) {
+	for i := 0; i < cycles; i++ {
+		m.clockIrq()
+		m.clockAudio()
+	}
+}
+
+func (m *Namco163) clockIrq() {
+	if !m.IrqEnabled || m.IrqCounter == 0x7FFF {
+		return
+	}
+
+	m.IrqCounter++
+
+	if m.IrqCounter == 0x7FFF {
+		m.IrqPending = true
+	}
+}
+
+func (m *Namco163) IrqAsserted() bool {
+	return m.IrqPending
+}
+
+func (m *Namco163) clockAudio() {
+	if !m.SoundDisabled {
+		m.ChannelCycles++
+
+		if m.ChannelCycles == Namco163ChannelCycles {
+			m.ChannelCycles = 0
+			m.updateChannel(7 - m.CurrentChannel)
+
+			m.CurrentChannel++
+			if m.CurrentChannel >= m.EnabledChannels() {
+				m.CurrentChannel = 0
+			}
+		}
+	}
+
+	// The chip only ever outputs a single channel at a time, so
+	// the mixed signal is the average over the time each of the
+	// channels spends on the output
+	m.OutputSum += m.ChannelOutput[7-m.CurrentChannel]
+	m.OutputCycles++
+}
+
+func (m *Namco163) EnabledChannels() int {
+	return int((m.InternalRam[0x7F]>>4)&0x7) + 1
+}
+
+func (m *Namco163) updateChannel(c int) {
+	base := 0x40 + (c * 8)
+	r := m.InternalRam[base : base+8]
+
+	frequency := int(r[0]) | int(r[2])<<8 | int(r[4]&0x3)<<16
+	phase := int(r[1]) | int(r[3])<<8 | int(r[5])<<16
+	length := (256 - int(r[4]&0xFC)) << 16
+	offset := int(r[6])
+	volume := int(r[7] & 0xF)
+
+	phase = (phase + frequency) % length
+
+	r[1] = Word(phase & 0xFF)
+	r[3] = Word((phase >> 8) & 0xFF)
+	r[5] = Word((phase >> 16) & 0xFF)
+
+	// Samples are 4-bit, packed two per byte with the
+	// low nibble first
+	address := ((phase >> 16) + offset) & 0xFF
+	sample := int(m.InternalRam[address>>1]>>uint((address&0x1)*4)) & 0xF
+
+	m.ChannelOutput[c] = (sample - 8) * volume
+}
+
+func (m *Namco163) Output() float64 {
+	if m.OutputCycles == 0 {
+		return 0
+	}
+
+	out := float64(m.OutputSum) / float64(m.OutputCycles)
+
+	m.OutputSum = 0
+	m.OutputCycles = 0
+
+	return out * Namco163Volume
+}
+
+func (m *Namco163) SerializeState(s *State) {
+	s.Words(m.InternalRam[:])
+	s.Word(&m.RamAddress)
+	s.Bool(&m.RamAutoIncrement)
+
+	s.Int(&m.IrqCounter)
+	s.Bool(&m.IrqEnabled)
+	s.Bool(&m.IrqPending)
+
+	s.Ints(m.PrgBanks[:])
+	s.Words(m.ChrBanks[:])
+	s.Words(m.NametableBank[:])
+	s.Bool(&m.ChrRamLowDisabled)
+	s.Bool(&m.ChrRamHighDisabled)
+
+	s.Bool(&m.SoundDisabled)
+	s.Word(&m.WriteProtect)
+
+	m.Chr.SerializeState(s)
+}
@@ -0,0 +1,157 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestNamco163Banking(test *testing.T) {
+	loadMapperRom(test, 19, 0, 8, 8)
+
+	// 8k banks 4, 6 and 8, which start 16k banks 2, 3 and 4
+	Ram.Write(0xE000, 4)
+	Ram.Write(0xE800, 6)
+	Ram.Write(0xF000, 8)
+
+	verifyPrgBank(0x8000, 2, test)
+	verifyPrgBank(0xA000, 3, test)
+	verifyPrgBank(0xC000, 4, test)
+
+	// 1k bank $14, which is 4k bank 5, and bank 8 in the
+	// next slot
+	Ram.Write(0x8000, 0x14)
+	Ram.Write(0x8800, 0x08)
+
+	verifyChrBank(0x0000, 5, test)
+	verifyChrBank(0x0400, 2, test)
+
+	// Banks $E0-$FF select CIRAM, which can be written
+	Ram.Write(0x9000, 0xE1)
+	rom.WriteVram(0x77, 0x0800)
+
+	if ppu.Nametables.Nametable1[0] != 0x77 {
+		test.Error("CIRAM in the pattern tables wasn't written")
+	}
+
+	// Until it's disabled for the low pattern table
+	Ram.Write(0xE800, 0x46)
+	if v := rom.ReadVram(0x0800); v == 0x77 {
+		test.Error("CIRAM was still mapped with it disabled")
+	}
+}
+
+func TestNamco163Nametables(test *testing.T) {
+	loadMapperRom(test, 19, 0, 8, 8)
+
+	n := &ppu.Nametables
+
+	Ram.Write(0xC000, 0xE1)
+	Ram.Write(0xC800, 0xE0)
+
+	if n.LogicalTables[0] != &n.Nametable1 || n.LogicalTables[1] != &n.Nametable0 {
+		test.Error("Banks $E0-$FF didn't select CIRAM")
+	}
+
+	// CHR-ROM bank 4, which starts 4k bank 1
+	Ram.Write(0xD000, 0x04)
+
+	if v := n.readNametableData(0x2800); v != 1 {
+		test.Errorf("Nametable from CHR-ROM was %d, expected 1", v)
+	}
+
+	n.writeNametableData(0x2800, 0x55)
+	if v := n.readNametableData(0x2800); v != 1 {
+		test.Errorf("Nametable write went to CHR-ROM, read 0x%X", v)
+	}
+}
+
+func TestNamco163Irq(test *testing.T) {
+	m := loadMapperRom(test, 19, 0, 8, 8).(*Namco163)
+
+	// Counter of $7FFD, enabled
+	Ram.Write(0x5000, 0xFD)
+	Ram.Write(0x5800, 0xFF)
+
+	m.Clock(1)
+	if m.IrqAsserted() {
+		test.Error("IRQ fired early")
+	}
+
+	m.Clock(1)
+	if !m.IrqAsserted() {
+		test.Fatal("IRQ didn't fire when the counter reached $7FFF")
+	}
+
+	// The counter stops at $7FFF
+	m.Clock(10)
+
+	low, _ := Ram.Read(0x5000)
+	high, _ := Ram.Read(0x5800)
+	if low != 0xFF || high != 0xFF {
+		test.Errorf("Counter was 0x%X%02X, expected 0xFFFF", high, low)
+	}
+
+	Ram.Write(0x5000, 0x00)
+	if m.IrqAsserted() {
+		test.Error("Writing $5000 didn't acknowledge the IRQ")
+	}
+}
+
+func TestNamco163SoundRam(test *testing.T) {
+	m := loadMapperRom(test, 19, 0, 8, 8).(*Namco163)
+
+	// Address $7F with auto-increment, which wraps around
+	Ram.Write(0xF800, 0xFF)
+	Ram.Write(0x4800, 0x11)
+	Ram.Write(0x4800, 0x22)
+
+	if m.InternalRam[0x7F] != 0x11 || m.InternalRam[0x00] != 0x22 {
+		test.Error("Sound RAM writes didn't auto-increment")
+	}
+
+	Ram.Write(0xF800, 0xFF)
+	if v, _ := Ram.Read(0x4800); v != 0x11 {
+		test.Errorf("Sound RAM read 0x%X, expected 0x11", v)
+	}
+
+	if v, _ := Ram.Read(0x4800); v != 0x22 {
+		test.Errorf("Sound RAM read 0x%X after incrementing, expected 0x22", v)
+	}
+
+	// Without auto-increment the address stays put
+	Ram.Write(0xF800, 0x10)
+	Ram.Write(0x4800, 0x33)
+	Ram.Write(0x4800, 0x44)
+
+	if m.InternalRam[0x10] != 0x44 || m.InternalRam[0x11] != 0x00 {
+		test.Error("Sound RAM address incremented")
+	}
+}
+
+func TestNamco163PrgRamProtect(test *testing.T) {
+	loadMapperRom(test, 19, 0, 8, 8)
+
+	// Writes are disabled until $F800 is written with $4x
+	Ram.Write(0x6000, 0x11)
+	if v, _ := Ram.Read(0x6000); v != 0x00 {
+		test.Errorf("PRG-RAM was written while protected, read 0x%X", v)
+	}
+
+	Ram.Write(0xF800, 0x40)
+	Ram.Write(0x6000, 0x11)
+	if v, _ := Ram.Read(0x6000); v != 0x11 {
+		test.Errorf("PRG-RAM read 0x%X, expected 0x11", v)
+	}
+
+	// Bit 1 protects $6800-$6FFF only
+	Ram.Write(0xF800, 0x42)
+	Ram.Write(0x6800, 0x22)
+	Ram.Write(0x7000, 0x33)
+
+	if v, _ := Ram.Read(0x6800); v != 0x00 {
+		test.Errorf("Protected 2k was written, read 0x%X", v)
+	}
+
+	if v, _ := Ram.Read(0x7000); v != 0x33 {
+		test.Errorf("PRG-RAM read 0x%X, expected 0x33", v)
+	}
+}
@@ -5,44 +5,94 @@ const (
 	MirroringHorizontal
 	MirroringSingleUpper
 	MirroringSingleLower
+	MirroringFourScreen
 )
 
+// Nametable RAM a table can be mapped to. Mappers can also map
+// tables to their own memory, such as CHR-ROM or a fill tile.
+const (
+	// The console's 2k of CIRAM
+	NametableCiram0 = iota
+	NametableCiram1
+	// 2k of RAM on four-screen boards
+	NametableCartridge0
+	NametableCartridge1
+)
+
+// Which page backs each of the four tables, for each mirroring
+var mirroringLayouts = map[int][4]int{
+	MirroringVertical:    {NametableCiram0, NametableCiram1, NametableCiram0, NametableCiram1},
+	MirroringHorizontal:  {NametableCiram0, NametableCiram0, NametableCiram1, NametableCiram1},
+	MirroringSingleUpper: {NametableCiram0, NametableCiram0, NametableCiram0, NametableCiram0},
+	MirroringSingleLower: {NametableCiram1, NametableCiram1, NametableCiram1, NametableCiram1},
+	MirroringFourScreen:  {NametableCiram0, NametableCiram1, NametableCartridge0, NametableCartridge1},
+}
+
 type Nametable struct {
 	Mirroring     int
 	LogicalTables [4]*[0x400]Word
 	Nametable0    [0x400]Word
 	Nametable1    [0x400]Word
+
+	// Tables mapped to ROM, or to anything else the PPU
+	// can't write to, ignore writes
+	ReadOnlyTables [4]bool
+
+	// Four-screen boards wire the tables to CIRAM and their
+	// own RAM, so the mapper's mirroring has no effect
+	FourScreen    bool
+	CartridgeRam0 [0x400]Word
+	CartridgeRam1 [0x400]Word
 }
 
 func (n *Nametable) SetMirroring(m int) {
+	if n.FourScreen {
+		m = MirroringFourScreen
+	}
+
 	n.Mirroring = m
 
-	switch n.Mirroring {
-	case MirroringHorizontal:
-		n.LogicalTables[0] = &n.Nametable0
-		n.LogicalTables[1] = &n.Nametable0
-		n.LogicalTables[2] = &n.Nametable1
-		n.LogicalTables[3] = &n.Nametable1
-	case MirroringVertical:
-		n.LogicalTables[0] = &n.Nametable0
-		n.LogicalTables[1] = &n.Nametable1
-		n.LogicalTables[2] = &n.Nametable0
-		n.LogicalTables[3] = &n.Nametable1
-	case MirroringSingleUpper:
-		n.LogicalTables[0] = &n.Nametable0
-		n.LogicalTables[1] = &n.Nametable0
-		n.LogicalTables[2] = &n.Nametable0
-		n.LogicalTables[3] = &n.Nametable0
-	case MirroringSingleLower:
-		n.LogicalTables[0] = &n.Nametable1
-		n.LogicalTables[1] = &n.Nametable1
-		n.LogicalTables[2] = &n.Nametable1
-		n.LogicalTables[3] = &n.Nametable1
+	for i, page := range mirroringLayouts[m] {
+		n.MapTable(i, n.Page(page))
 	}
 }
 
+// Nametable RAM, one of the NametableCiram or
+// NametableCartridge pages
+func (n *Nametable) Page(page int) *[0x400]Word {
+	switch page {
+	case NametableCiram1:
+		return &n.Nametable1
+	case NametableCartridge0:
+		return &n.CartridgeRam0
+	case NametableCartridge1:
+		return &n.CartridgeRam1
+	}
+
+	return &n.Nametable0
+}
+
+// Backs the table at $2000, $2400, $2800 or $2C00, numbered
+// 0 to 3, with the given memory
+func (n *Nametable) MapTable(table int, memory *[0x400]Word) {
+	n.LogicalTables[table] = memory
+	n.ReadOnlyTables[table] = false
+}
+
+// Backs a table with memory that ignores writes, such as
+// CHR-ROM
+func (n *Nametable) MapReadOnlyTable(table int, memory *[0x400]Word) {
+	n.LogicalTables[table] = memory
+	n.ReadOnlyTables[table] = true
+}
+
 func (n *Nametable) writeNametableData(a int, v Word) {
-	n.LogicalTables[(a&0xC00)>>10][a&0x3FF] = v
+	table := (a & 0xC00) >> 10
+	if n.ReadOnlyTables[table] {
+		return
+	}
+
+	n.LogicalTables[table][a&0x3FF] = v
 }
 
 func (n *Nametable) readNametableData(a int) Word {
@@ -9,6 +9,8 @@ type Nrom struct {
 	ChrRomCount  int
 	Battery      bool
 	Data         []byte
+	Chr          *ChrMemory
+	Header       *RomHeader
 }
 
 func (m *Nrom) Load() {
@@ -23,32 +25,8 @@ func (m *Nrom) Load() {
 		m.RomBanks[i] = bank
 	}
 
-	// Everything after PRG-ROM
-	chrRom := m.Data[0x4000*len(m.RomBanks):]
-
-	if m.ChrRomCount > 0 {
-		m.VromBanks = make([][]Word, m.ChrRomCount*2)
-	} else {
-		m.VromBanks = make([][]Word, 2)
-	}
-
-	for i := 0; i < cap(m.VromBanks); i++ {
-		// Move 16kb chunk to 16kb bank
-		m.VromBanks[i] = make([]Word, 0x1000, 0x1000)
-
-		// If the game doesn't have CHR banks we
-		// just need to allocate VRAM
-
-		for x := 0; x < 0x1000; x++ {
-			var val Word
-			if m.ChrRomCount == 0 {
-				val = 0
-			} else {
-				val = Word(chrRom[(0x1000*i)+x])
-			}
-			m.VromBanks[i][x] = val
-		}
-	}
+	// CHR is stored in 4k banks
+	m.VromBanks = m.Chr.Banks(0x1000)
 }
 
 func (m *Nrom) Write(v Word, a int) {
@@ -65,11 +43,11 @@ func (m *Nrom) Read(a int) Word {
 
 func (m *Nrom) WriteVram(v Word, a int) {
 	if a >= 0x1000 {
-		m.VromBanks[len(m.VromBanks)-1][a&0xFFF] = v
+		m.Chr.WriteBank(v, len(m.VromBanks)-1, 0x1000, a&0xFFF)
 		return
 	}
 
-	m.VromBanks[0][a&0xFFF] = v
+	m.Chr.WriteBank(v, 0, 0x1000, a&0xFFF)
 }
 
 func (m *Nrom) ReadVram(a int) Word {
@@ -91,3 +69,7 @@ func (m *Nrom) ReadTile(a int) []Word {
 func (m *Nrom) BatteryBacked() bool {
 	return m.Battery
 }
+
+func (m *Nrom) SerializeState(s *State) {
+	m.Chr.SerializeState(s)
+}
@@ -0,0 +1,640 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/scottferg/Fergulator/nes/opll"
+)
+
+const (
+	NsfChipVrc6 = 1 << iota
+	NsfChipVrc7
+	NsfChipFds
+	NsfChipMmc5
+	NsfChipNamco163
+	NsfChipSunsoft5b
+)
+
+const (
+	// The player parks the CPU here between INIT and PLAY
+	// calls, in a JMP to itself
+	NsfIdleAddress = 0x5FF0
+
+	NsfDefaultSpeed = 16639
+	NsfFrameCycles  = 29781
+)
+
+type Nsf struct {
+	// 4k banks for $8000-$FFFF
+	RomBanks [][]Word
+	// Dummy pattern tables, never rendered
+	VromBanks []Word
+
+	Version      int
+	TotalSongs   int
+	StartingSong int
+	LoadAddress  int
+	InitAddress  int
+	PlayAddress  int
+	PlaySpeed    int
+	Name         string
+	Artist       string
+	Copyright    string
+	TrackLabels  []string
+	InitialBanks [8]Word
+	Bankswitched bool
+	Chips        Word
+
+	PrgBanks [8]int
+
+	// FDS tunes have RAM from $6000-$DFFF
+	FdsRam []Word
+
+	CurrentSong  int
+	PendingSong  int
+	Busy         bool
+	PlayCycles   int
+	PlayPeriod   int
+	FrameCycles  int
+	Framebuffer  []uint32
+	MultiplierA  Word
+	MultiplierB  Word
+	ExtendedRam  [0x400]Word
+	ElapsedTicks int
+
+	Vrc6      *Vrc6Audio
+	Vrc7      *opll.Opll
+	Vrc7Audio *Vrc7
+	Fds       *FdsAudio
+	Mmc5      *Mmc5Audio
+	Namco163  *Namco163
+	Sunsoft5b *Sunsoft5b
+}
+
+func IsNsf(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("NESM\x1a")) ||
+		bytes.HasPrefix(data, []byte("NSFE"))
+}
+
+func LoadNsf(data []byte) (m *Nsf, e error) {
+	m = &Nsf{
+		PendingSong: -1,
+	}
+
+	var tune []byte
+	switch {
+	case bytes.HasPrefix(data, []byte("NESM\x1a")):
+		tune, e = m.parseNsf(data)
+	case bytes.HasPrefix(data, []byte("NSFE")):
+		tune, e = m.parseNsfe(data)
+	default:
+		e = errors.New("Invalid NSF file")
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	if m.TotalSongs == 0 {
+		return nil, errors.New("NSF file contains no songs")
+	}
+
+	if m.PlaySpeed == 0 {
+		m.PlaySpeed = NsfDefaultSpeed
+	}
+
+	m.PlayPeriod = int(int64(m.PlaySpeed) * int64(cpuClockSpeed) / 1000000)
+
+	for _, b := range m.InitialBanks {
+		if b != 0 {
+			m.Bankswitched = true
+		}
+	}
+
+	// Only the FDS has RAM below $8000 to load into
+	if !m.Bankswitched && m.LoadAddress < 0x8000 && m.Chips&NsfChipFds == 0 {
+		return nil, errors.New(fmt.Sprintf("NSF load address 0x%X is below $8000", m.LoadAddress))
+	}
+
+	fmt.Printf("-----------------\nNSF:\n  ")
+	fmt.Printf("Name: %s\n  ", m.Name)
+	fmt.Printf("Artist: %s\n  ", m.Artist)
+	fmt.Printf("Copyright: %s\n  ", m.Copyright)
+	fmt.Printf("Songs: %d\n  ", m.TotalSongs)
+	fmt.Printf("Load: 0x%X Init: 0x%X Play: 0x%X\n", m.LoadAddress, m.InitAddress, m.PlayAddress)
+	fmt.Printf("-----------------\n")
+
+	m.Load(tune)
+
+	return m, nil
+}
+
+func (m *Nsf) parseNsf(data []byte) ([]byte, error) {
+	if len(data) < 0x80 {
+		return nil, errors.New("NSF header is truncated")
+	}
+
+	m.Version = int(data[0x5])
+	m.TotalSongs = int(data[0x6])
+	m.StartingSong = int(data[0x7]) - 1
+	m.LoadAddress = int(binary.LittleEndian.Uint16(data[0x8:]))
+	m.InitAddress = int(binary.LittleEndian.Uint16(data[0xA:]))
+	m.PlayAddress = int(binary.LittleEndian.Uint16(data[0xC:]))
+	m.Name = nsfString(data[0x0E:0x2E])
+	m.Artist = nsfString(data[0x2E:0x4E])
+	m.Copyright = nsfString(data[0x4E:0x6E])
+	m.PlaySpeed = int(binary.LittleEndian.Uint16(data[0x6E:]))
+	m.Chips = Word(data[0x7B])
+
+	for i := range m.InitialBanks {
+		m.InitialBanks[i] = Word(data[0x70+i])
+	}
+
+	return data[0x80:], nil
+}
+
+func (m *Nsf) parseNsfe(data []byte) (tune []byte, e error) {
+	var info bool
+
+	for offset := 4; offset+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[offset:]))
+		id := string(data[offset+4 : offset+8])
+		offset += 8
+
+		if length < 0 || offset+length > len(data) {
+			return nil, errors.New(fmt.Sprintf("NSFe chunk %s is truncated", id))
+		}
+
+		chunk := data[offset : offset+length]
+		offset += length
+
+		switch id {
+		case "INFO":
+			// The song count and starting song are optional
+			if len(chunk) < 8 {
+				return nil, errors.New("NSFe INFO chunk is too short")
+			}
+
+			info = true
+			m.LoadAddress = int(binary.LittleEndian.Uint16(chunk[0:]))
+			m.InitAddress = int(binary.LittleEndian.Uint16(chunk[2:]))
+			m.PlayAddress = int(binary.LittleEndian.Uint16(chunk[4:]))
+			m.Chips = Word(chunk[7])
+			m.TotalSongs = 1
+
+			if len(chunk) > 8 {
+				m.TotalSongs = int(chunk[8])
+			}
+
+			if len(chunk) > 9 {
+				m.StartingSong = int(chunk[9])
+			}
+		case "DATA":
+			tune = chunk
+		case "BANK":
+			for i := 0; i < len(chunk) && i < len(m.InitialBanks); i++ {
+				m.InitialBanks[i] = Word(chunk[i])
+			}
+		case "RATE":
+			if len(chunk) >= 2 {
+				m.PlaySpeed = int(binary.LittleEndian.Uint16(chunk))
+			}
+		case "auth":
+			fields := bytes.Split(chunk, []byte{0})
+			for i, f := range fields {
+				switch i {
+				case 0:
+					m.Name = string(f)
+				case 1:
+					m.Artist = string(f)
+				case 2:
+					m.Copyright = string(f)
+				}
+			}
+		case "tlbl":
+			for _, f := range bytes.Split(chunk, []byte{0}) {
+				m.TrackLabels = append(m.TrackLabels, string(f))
+			}
+		case "NEND":
+			offset = len(data)
+		default:
+			// Chunks with an uppercase first letter are
+			// required to play the file correctly
+			if id[0] >= 'A' && id[0] <= 'Z' {
+				return nil, errors.New(fmt.Sprintf("Unsupported NSFe chunk: %s", id))
+			}
+		}
+	}
+
+	if !info || tune == nil {
+		return nil, errors.New("NSFe file is missing INFO or DATA")
+	}
+
+	return tune, nil
+}
+
+func nsfString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	return string(b)
+}
+
+func (m *Nsf) Load(tune []byte) {
+	var image []byte
+
+	if m.Bankswitched {
+		// Bankswitched tunes are padded so that the load
+		// address falls at the right offset in the first bank
+		image = make([]byte, m.LoadAddress&0xFFF, (m.LoadAddress&0xFFF)+len(tune))
+		image = append(image, tune...)
+	} else {
+		// Otherwise the tune is loaded into a 32k image
+		// starting at the load address
+		image = make([]byte, 0x8000)
+		if m.LoadAddress >= 0x8000 {
+			copy(image[m.LoadAddress-0x8000:], tune)
+		} else if m.LoadAddress+len(tune) > 0x8000 {
+			// FDS tunes can start in the work RAM and run on
+			// into the vectors at the top
+			copy(image, tune[0x8000-m.LoadAddress:])
+		}
+	}
+
+	banks := (len(image) + 0xFFF) / 0x1000
+	m.RomBanks = make([][]Word, banks)
+	for i := range m.RomBanks {
+		m.RomBanks[i] = make([]Word, 0x1000)
+
+		for x := 0; x < 0x1000 && (i*0x1000)+x < len(image); x++ {
+			m.RomBanks[i][x] = Word(image[(i*0x1000)+x])
+		}
+	}
+
+	m.VromBanks = make([]Word, 0x2000)
+	m.Framebuffer = make([]uint32, 0xEFE0)
+
+	if m.Chips&NsfChipFds != 0 {
+		m.FdsRam = make([]Word, 0x8000)
+
+		// $6000-$DFFF is all RAM, so the tune is copied there
+		// wherever it loads, leaving $E000 and up to the banks
+		if !m.Bankswitched && m.LoadAddress >= 0x6000 {
+			for i, v := range tune {
+				if m.LoadAddress-0x6000+i >= len(m.FdsRam) {
+					break
+				}
+
+				m.FdsRam[m.LoadAddress-0x6000+i] = Word(v)
+			}
+		}
+	}
+}
+
+func (m *Nsf) enableChips() {
+	if m.Chips&NsfChipVrc6 != 0 {
+		m.Vrc6 = &Vrc6Audio{}
+		apu.Expansion = append(apu.Expansion, m.Vrc6)
+	}
+
+	if m.Chips&NsfChipVrc7 != 0 {
+		// The VRC7 mapper takes care of clocking
+		// and averaging the FM output
+		m.Vrc7Audio = &Vrc7{Fm: opll.New()}
+		m.Vrc7 = m.Vrc7Audio.Fm
+		apu.Expansion = append(apu.Expansion, m.Vrc7Audio)
+	}
+
+	if m.Chips&NsfChipFds != 0 {
+		m.Fds = NewFdsAudio()
+		apu.Expansion = append(apu.Expansion, m.Fds)
+	}
+
+	if m.Chips&NsfChipMmc5 != 0 {
+		m.Mmc5 = &Mmc5Audio{}
+		apu.Expansion = append(apu.Expansion, m.Mmc5)
+	}
+
+	if m.Chips&NsfChipNamco163 != 0 {
+		m.Namco163 = &Namco163{}
+		apu.Expansion = append(apu.Expansion, m.Namco163)
+	}
+
+	if m.Chips&NsfChipSunsoft5b != 0 {
+		m.Sunsoft5b = NewSunsoft5b()
+		apu.Expansion = append(apu.Expansion, m.Sunsoft5b)
+	}
+}
+
+func (m *Nsf) BatteryBacked() bool {
+	return false
+}
+
+// Bankswitching, expansion audio and RAM
+func (m *Nsf) MapsCpuAddress(a int) bool {
+	return true
+}
+
+func (m *Nsf) Write(v Word, a int) {
+	switch {
+	case a >= 0x4040 && a <= 0x408A:
+		if m.Fds != nil {
+			m.Fds.Write(v, a)
+		}
+	case a >= 0x4800 && a <= 0x4FFF:
+		if m.Namco163 != nil {
+			m.Namco163.Write(v, a)
+		}
+	case a >= 0x5000 && a <= 0x5015:
+		if m.Mmc5 != nil {
+			m.Mmc5.Write(v, a)
+		}
+	case a == 0x5205:
+		m.MultiplierA = v
+	case a == 0x5206:
+		m.MultiplierB = v
+	case a >= 0x5C00 && a < NsfIdleAddress:
+		m.ExtendedRam[a-0x5C00] = v
+	case a >= 0x5FF6 && a <= 0x5FFF:
+		m.SwitchBank(a-0x5FF8, v)
+	case a >= 0x6000 && a <= 0x7FFF:
+		if m.FdsRam != nil {
+			m.FdsRam[a-0x6000] = v
+		} else {
+			Ram[a] = v
+		}
+	case a >= 0x8000:
+		// FDS tunes can write over their own code
+		if m.FdsRam != nil && a < 0xE000 {
+			m.FdsRam[a-0x6000] = v
+		}
+
+		m.writeExpansion(v, a)
+	}
+}
+
+func (m *Nsf) writeExpansion(v Word, a int) {
+	switch {
+	case m.Vrc6 != nil && a >= 0x9000 && a <= 0xB002:
+		m.Vrc6.Write(v, a)
+	case m.Vrc7 != nil && a == 0x9010:
+		m.Vrc7.WriteAddress(uint8(v))
+	case m.Vrc7 != nil && a == 0x9030:
+		logYm2413Write(m.Vrc7.Address, uint8(v))
+		m.Vrc7.WriteData(uint8(v))
+	case m.Namco163 != nil && a >= 0xF800:
+		m.Namco163.Write(v, a)
+	case m.Sunsoft5b != nil && a >= 0xC000 && a <= 0xDFFF:
+		m.Sunsoft5b.SelectRegister(v)
+	case m.Sunsoft5b != nil && a >= 0xE000:
+		m.Sunsoft5b.WriteRegister(v)
+	}
+}
+
+// Bank registers at $5FF8-$5FFF select 4k banks for $8000-$FFFF.
+// FDS tunes also have $5FF6 and $5FF7 for $6000-$7FFF.
+func (m *Nsf) SwitchBank(slot int, v Word) {
+	bank := int(v) % len(m.RomBanks)
+
+	if m.FdsRam != nil {
+		// FDS RAM is loaded with a copy of the bank
+		start := (slot + 2) * 0x1000
+		if start < len(m.FdsRam) {
+			copy(m.FdsRam[start:start+0x1000], m.RomBanks[bank])
+		}
+
+		if slot < 6 {
+			return
+		}
+	}
+
+	if slot >= 0 {
+		m.PrgBanks[slot] = bank
+	}
+}
+
+func (m *Nsf) Read(a int) Word {
+	switch {
+	case a >= NsfIdleAddress && a < NsfIdleAddress+3:
+		// JMP NsfIdleAddress
+		return []Word{0x4C, NsfIdleAddress & 0xFF, NsfIdleAddress >> 8}[a-NsfIdleAddress]
+	case a >= 0x4040 && a <= 0x4092:
+		if m.Fds != nil {
+			return m.Fds.Read(a)
+		}
+	case a >= 0x4800 && a <= 0x4FFF:
+		if m.Namco163 != nil {
+			return m.Namco163.Read(a)
+		}
+	case a == 0x5015:
+		if m.Mmc5 != nil {
+			return m.Mmc5.Read(a)
+		}
+	case a == 0x5205:
+		return Word(int(m.MultiplierA) * int(m.MultiplierB) & 0xFF)
+	case a == 0x5206:
+		return Word(int(m.MultiplierA) * int(m.MultiplierB) >> 8)
+	case a >= 0x5C00 && a < NsfIdleAddress:
+		return m.ExtendedRam[a-0x5C00]
+	case a >= 0x6000 && a <= 0x7FFF:
+		if m.FdsRam != nil {
+			return m.FdsRam[a-0x6000]
+		}
+
+		return Ram[a]
+	case a >= 0x8000:
+		if m.FdsRam != nil && a < 0xE000 {
+			return m.FdsRam[a-0x6000]
+		}
+
+		return m.RomBanks[m.PrgBanks[(a-0x8000)>>12]][a&0xFFF]
+	}
+
+	return 0
+}
+
+func (m *Nsf) WriteVram(v Word, a int) {
+	m.VromBanks[a&0x1FFF] = v
+}
+
+func (m *Nsf) ReadVram(a int) Word {
+	return m.VromBanks[a&0x1FFF]
+}
+
+func (m *Nsf) ReadTile(a int) []Word {
+	a &= 0x1FFF
+	return m.VromBanks[a : a+16]
+}
+
+// Resets the machine and runs the INIT routine for
+// the given (zero based) song
+func (m *Nsf) PlaySong(song int) {
+	if song < 0 {
+		song = m.TotalSongs - 1
+	} else if song >= m.TotalSongs {
+		song = 0
+	}
+
+	m.CurrentSong = song
+	m.ElapsedTicks = 0
+
+	// Start every song with fresh expansion chips
+	apu.Expansion = nil
+	m.enableChips()
+
+	for i := 0; i < 0x800; i++ {
+		Ram[i] = 0
+	}
+
+	for i := 0x6000; i < 0x8000; i++ {
+		Ram[i] = 0
+	}
+
+	for a := 0x4000; a <= 0x4013; a++ {
+		apu.RegWrite(0, a)
+	}
+
+	apu.RegWrite(0x0, 0x4015)
+	apu.RegWrite(0xF, 0x4015)
+	apu.RegWrite(0x40, 0x4017)
+
+	if m.Fds != nil {
+		m.Fds.Write(0x80, 0x4089)
+		m.Fds.Write(0xE8, 0x408A)
+	}
+
+	if m.Bankswitched {
+		for i, b := range m.InitialBanks {
+			if m.FdsRam != nil && i >= 6 {
+				// $5FF6 and $5FF7 get the last two bank values
+				m.SwitchBank(i-8, b)
+			}
+
+			m.SwitchBank(i, b)
+		}
+	} else {
+		for i := range m.PrgBanks {
+			m.PrgBanks[i] = i
+		}
+	}
+
+	cpu.A = Word(song)
+	// NTSC
+	cpu.X = 0
+	cpu.Y = 0
+	cpu.P = 0x34
+	cpu.StackPointer = 0xFD
+	cpu.CyclesToWait = 0
+	cpu.InterruptRequested = InterruptNone
+
+	m.call(m.InitAddress)
+	m.PlayCycles = 0
+
+	fmt.Printf("Playing song %d of %d\n", song+1, m.TotalSongs)
+}
+
+// Jumps to a routine, with the return address pointing
+// at the idle loop
+func (m *Nsf) call(a int) {
+	ret := NsfIdleAddress - 1
+
+	cpu.pushToStack(Word(ret >> 8))
+	cpu.pushToStack(Word(ret & 0xFF))
+	cpu.ProgramCounter = uint16(a)
+
+	m.Busy = true
+}
+
+// Starts the current song over
+func (m *Nsf) Reset() {
+	m.PlaySong(m.CurrentSong)
+}
+
+// Songs are switched at the start of the next frame
+func (m *Nsf) NextTrack() {
+	m.PendingSong = m.CurrentSong + 1
+}
+
+func (m *Nsf) PreviousTrack() {
+	m.PendingSong = m.CurrentSong - 1
+}
+
+func NextTrack() {
+	if m, ok := rom.(TrackPlayer); ok {
+		m.NextTrack()
+	}
+}
+
+func PreviousTrack() {
+	if m, ok := rom.(TrackPlayer); ok {
+		m.PreviousTrack()
+	}
+}
+
+// Called once per CPU instruction with the number of
+// cycles it took
+func (m *Nsf) Clock(cycles int) {
+	if m.PendingSong != -1 {
+		song := m.PendingSong
+		m.PendingSong = -1
+
+		m.PlaySong(song)
+		return
+	}
+
+	if int(cpu.ProgramCounter) == NsfIdleAddress {
+		m.Busy = false
+	}
+
+	for i := 0; i < cycles; i++ {
+		m.clockChips()
+	}
+
+	m.PlayCycles += cycles
+	if m.PlayCycles >= m.PlayPeriod && !m.Busy {
+		m.PlayCycles -= m.PlayPeriod
+		m.ElapsedTicks++
+
+		m.call(m.PlayAddress)
+	}
+
+	m.FrameCycles += cycles
+	if m.FrameCycles >= NsfFrameCycles {
+		m.FrameCycles -= NsfFrameCycles
+
+		Handler.Handle("vblank")
+
+		m.DrawDisplay()
+		ppu.Output <- m.Framebuffer
+	}
+}
+
+func (m *Nsf) clockChips() {
+	if m.Vrc6 != nil {
+		m.Vrc6.Clock()
+	}
+
+	if m.Vrc7Audio != nil {
+		m.Vrc7Audio.Clock(1)
+	}
+
+	if m.Fds != nil {
+		m.Fds.Clock()
+	}
+
+	if m.Mmc5 != nil {
+		m.Mmc5.Clock()
+	}
+
+	if m.Namco163 != nil {
+		m.Namco163.clockAudio()
+	}
+
+	if m.Sunsoft5b != nil {
+		m.Sunsoft5b.Clock()
+	}
+}
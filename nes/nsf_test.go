@@ -0,0 +1,199 @@
+package nes
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// INIT stores the song number at $00, PLAY increments $01
+var nsfTestCode = []byte{
+	0x85, 0x00, 0x60, // STA $00; RTS
+	0xE6, 0x01, 0x60, // INC $01; RTS
+}
+
+func newTestNsf() []byte {
+	data := make([]byte, 0x80)
+	copy(data, "NESM\x1a")
+	data[0x5] = 1
+	data[0x6] = 3
+	data[0x7] = 2
+	binary.LittleEndian.PutUint16(data[0x8:], 0x8000)
+	binary.LittleEndian.PutUint16(data[0xA:], 0x8000)
+	binary.LittleEndian.PutUint16(data[0xC:], 0x8003)
+	copy(data[0x0E:], "Test Tune")
+	binary.LittleEndian.PutUint16(data[0x6E:], NsfDefaultSpeed)
+
+	return append(data, nsfTestCode...)
+}
+
+func nsfeChunk(id string, data []byte) []byte {
+	chunk := make([]byte, 8)
+	binary.LittleEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], id)
+
+	return append(chunk, data...)
+}
+
+func initNsfTest(contents []byte, test *testing.T) *Nsf {
+	Ram = NewMemory()
+	Handler = NewNoopEventHandler()
+	cpu.Init()
+	apu.Init(func(int16) {})
+	ppu.Init()
+
+	// Don't block on the display frames
+	ppu.Output = make(chan []uint32, 16)
+
+	n, err := LoadNsf(contents)
+	if err != nil {
+		test.Fatalf("LoadNsf failed: %s", err.Error())
+	}
+
+	rom = n
+
+	return n
+}
+
+func runNsf(n *Nsf, cycles int) {
+	for total := 0; total < cycles; {
+		c := cpu.Step()
+		n.Clock(c)
+		total += c
+	}
+}
+
+func TestNsfHeader(test *testing.T) {
+	n := initNsfTest(newTestNsf(), test)
+
+	if n.TotalSongs != 3 || n.StartingSong != 1 {
+		test.Errorf("Songs were %d starting at %d, expected 3 starting at 1", n.TotalSongs, n.StartingSong)
+	}
+
+	if n.Name != "Test Tune" {
+		test.Errorf("Name was %q, expected \"Test Tune\"", n.Name)
+	}
+
+	if n.Bankswitched {
+		test.Errorf("Tune should not be bankswitched")
+	}
+
+	if n.Read(0x8003) != 0xE6 {
+		test.Errorf("0x8003 was 0x%X, expected 0xE6", n.Read(0x8003))
+	}
+
+	// Tunes can't be loaded below $8000 without the FDS
+	contents := newTestNsf()
+	binary.LittleEndian.PutUint16(contents[0x8:], 0x6000)
+
+	if _, err := LoadNsf(contents); err == nil {
+		test.Errorf("Tune loaded at 0x6000 should fail to load")
+	}
+}
+
+func TestNsfFdsLoad(test *testing.T) {
+	// Without bankswitching FDS tunes go in the RAM at
+	// $6000-$DFFF, wherever they load
+	for _, load := range []int{0x7FFD, 0x8000} {
+		contents := newTestNsf()
+		contents[0x7B] = byte(NsfChipFds)
+		binary.LittleEndian.PutUint16(contents[0x8:], uint16(load))
+
+		n := initNsfTest(contents, test)
+
+		for i, v := range nsfTestCode {
+			if r := n.Read(load + i); r != Word(v) {
+				test.Errorf("0x%X was 0x%X loaded at 0x%X, expected 0x%X", load+i, r, load, v)
+			}
+		}
+	}
+
+	// The tail past $E000 is read from the ROM banks
+	contents := newTestNsf()
+	contents[0x7B] = byte(NsfChipFds)
+	binary.LittleEndian.PutUint16(contents[0x8:], 0xDFFE)
+
+	n := initNsfTest(contents, test)
+	n.PlaySong(n.StartingSong)
+
+	if r := n.Read(0xE000); r != 0x60 {
+		test.Errorf("0xE000 was 0x%X, expected 0x60", r)
+	}
+}
+
+func TestNsfPlayback(test *testing.T) {
+	n := initNsfTest(newTestNsf(), test)
+	n.PlaySong(n.StartingSong)
+
+	if runsPpu() {
+		test.Error("The PPU was run in place of the NSF display")
+	}
+
+	runNsf(n, n.PlayPeriod*3+100)
+
+	if Ram[0x00] != 1 {
+		test.Errorf("INIT was passed song %d, expected 1", Ram[0x00])
+	}
+
+	if Ram[0x01] != 3 {
+		test.Errorf("PLAY was called %d times, expected 3", Ram[0x01])
+	}
+
+	NextTrack()
+	runNsf(n, 100)
+
+	if n.CurrentSong != 2 || Ram[0x00] != 2 {
+		test.Errorf("Song was %d, expected 2", n.CurrentSong)
+	}
+
+	// Wraps around to the first song
+	NextTrack()
+	runNsf(n, 100)
+
+	if n.CurrentSong != 0 {
+		test.Errorf("Song was %d, expected 0", n.CurrentSong)
+	}
+}
+
+func TestNsfeChunks(test *testing.T) {
+	info := make([]byte, 10)
+	binary.LittleEndian.PutUint16(info[0:], 0x8000)
+	binary.LittleEndian.PutUint16(info[2:], 0x8000)
+	binary.LittleEndian.PutUint16(info[4:], 0x8003)
+	info[8] = 4
+	info[9] = 3
+
+	contents := []byte("NSFE")
+	contents = append(contents, nsfeChunk("INFO", info)...)
+	contents = append(contents, nsfeChunk("DATA", nsfTestCode)...)
+	contents = append(contents, nsfeChunk("auth", []byte("Name\x00Artist\x00Copyright\x00"))...)
+	contents = append(contents, nsfeChunk("NEND", nil)...)
+
+	n := initNsfTest(contents, test)
+
+	if n.TotalSongs != 4 || n.StartingSong != 3 {
+		test.Errorf("Songs were %d starting at %d, expected 4 starting at 3", n.TotalSongs, n.StartingSong)
+	}
+
+	if n.Artist != "Artist" {
+		test.Errorf("Artist was %q, expected \"Artist\"", n.Artist)
+	}
+
+	if n.PlaySpeed != NsfDefaultSpeed {
+		test.Errorf("Play speed was %d, expected %d", n.PlaySpeed, NsfDefaultSpeed)
+	}
+
+	if _, err := LoadNsf(append([]byte("NSFE"), nsfeChunk("ZZZZ", nil)...)); err == nil {
+		test.Errorf("Unknown required chunk should fail to load")
+	}
+
+	// Without the song count there's a single song
+	contents = []byte("NSFE")
+	contents = append(contents, nsfeChunk("INFO", info[:8])...)
+	contents = append(contents, nsfeChunk("DATA", nsfTestCode)...)
+
+	n = initNsfTest(contents, test)
+
+	if n.TotalSongs != 1 || n.StartingSong != 0 {
+		test.Errorf("Songs were %d starting at %d, expected 1 starting at 0", n.TotalSongs, n.StartingSong)
+	}
+}
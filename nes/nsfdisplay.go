@@ -0,0 +1,111 @@
+package nes
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	NsfDisplayWidth  = 240
+	NsfDisplayHeight = 224
+
+	NsfBackgroundColor = 0x002A88
+	NsfTextColor       = 0xFFFEFF
+	NsfHighlightColor  = 0xFECCC5
+)
+
+// 5x7 font for the NSF player display, covering ' ' through 'Z'.
+// Each glyph is five columns, with the top row in the low bit.
+var NsfFont = [][5]uint8{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, {0x00, 0x00, 0x5F, 0x00, 0x00},
+	{0x00, 0x07, 0x00, 0x07, 0x00}, {0x14, 0x7F, 0x14, 0x7F, 0x14},
+	{0x24, 0x2A, 0x7F, 0x2A, 0x12}, {0x23, 0x13, 0x08, 0x64, 0x62},
+	{0x36, 0x49, 0x55, 0x22, 0x50}, {0x00, 0x05, 0x03, 0x00, 0x00},
+	{0x00, 0x1C, 0x22, 0x41, 0x00}, {0x00, 0x41, 0x22, 0x1C, 0x00},
+	{0x08, 0x2A, 0x1C, 0x2A, 0x08}, {0x08, 0x08, 0x3E, 0x08, 0x08},
+	{0x00, 0x50, 0x30, 0x00, 0x00}, {0x08, 0x08, 0x08, 0x08, 0x08},
+	{0x00, 0x60, 0x60, 0x00, 0x00}, {0x20, 0x10, 0x08, 0x04, 0x02},
+	{0x3E, 0x51, 0x49, 0x45, 0x3E}, {0x00, 0x42, 0x7F, 0x40, 0x00},
+	{0x42, 0x61, 0x51, 0x49, 0x46}, {0x21, 0x41, 0x45, 0x4B, 0x31},
+	{0x18, 0x14, 0x12, 0x7F, 0x10}, {0x27, 0x45, 0x45, 0x45, 0x39},
+	{0x3C, 0x4A, 0x49, 0x49, 0x30}, {0x01, 0x71, 0x09, 0x05, 0x03},
+	{0x36, 0x49, 0x49, 0x49, 0x36}, {0x06, 0x49, 0x49, 0x29, 0x1E},
+	{0x00, 0x36, 0x36, 0x00, 0x00}, {0x00, 0x56, 0x36, 0x00, 0x00},
+	{0x00, 0x08, 0x14, 0x22, 0x41}, {0x14, 0x14, 0x14, 0x14, 0x14},
+	{0x41, 0x22, 0x14, 0x08, 0x00}, {0x02, 0x01, 0x51, 0x09, 0x06},
+	{0x32, 0x49, 0x79, 0x41, 0x3E}, {0x7E, 0x11, 0x11, 0x11, 0x7E},
+	{0x7F, 0x49, 0x49, 0x49, 0x36}, {0x3E, 0x41, 0x41, 0x41, 0x22},
+	{0x7F, 0x41, 0x41, 0x22, 0x1C}, {0x7F, 0x49, 0x49, 0x49, 0x41},
+	{0x7F, 0x09, 0x09, 0x01, 0x01}, {0x3E, 0x41, 0x41, 0x51, 0x32},
+	{0x7F, 0x08, 0x08, 0x08, 0x7F}, {0x00, 0x41, 0x7F, 0x41, 0x00},
+	{0x20, 0x40, 0x41, 0x3F, 0x01}, {0x7F, 0x08, 0x14, 0x22, 0x41},
+	{0x7F, 0x40, 0x40, 0x40, 0x40}, {0x7F, 0x02, 0x04, 0x02, 0x7F},
+	{0x7F, 0x04, 0x08, 0x10, 0x7F}, {0x3E, 0x41, 0x41, 0x41, 0x3E},
+	{0x7F, 0x09, 0x09, 0x09, 0x06}, {0x3E, 0x41, 0x51, 0x21, 0x5E},
+	{0x7F, 0x09, 0x19, 0x29, 0x46}, {0x46, 0x49, 0x49, 0x49, 0x31},
+	{0x01, 0x01, 0x7F, 0x01, 0x01}, {0x3F, 0x40, 0x40, 0x40, 0x3F},
+	{0x1F, 0x20, 0x40, 0x20, 0x1F}, {0x7F, 0x20, 0x18, 0x20, 0x7F},
+	{0x63, 0x14, 0x08, 0x14, 0x63}, {0x03, 0x04, 0x78, 0x04, 0x03},
+	{0x61, 0x51, 0x49, 0x45, 0x43},
+}
+
+// Renders the track info in place of the PPU output
+func (m *Nsf) DrawDisplay() {
+	for i := range m.Framebuffer {
+		m.Framebuffer[i] = NsfBackgroundColor << 8
+	}
+
+	m.drawText(m.Name, 24, 1, NsfHighlightColor)
+	m.drawText(m.Artist, 40, 1, NsfTextColor)
+	m.drawText(m.Copyright, 52, 1, NsfTextColor)
+
+	track := fmt.Sprintf("TRACK %d/%d", m.CurrentSong+1, m.TotalSongs)
+	m.drawText(track, 88, 2, NsfHighlightColor)
+
+	if m.CurrentSong < len(m.TrackLabels) {
+		m.drawText(m.TrackLabels[m.CurrentSong], 112, 1, NsfTextColor)
+	}
+
+	seconds := m.ElapsedTicks * m.PlaySpeed / 1000000
+	m.drawText(fmt.Sprintf("%d:%02d", seconds/60, seconds%60), 128, 2, NsfTextColor)
+
+	m.drawText("[ PREVIOUS    ] NEXT", 192, 1, NsfTextColor)
+}
+
+// Draws a line of text centered horizontally
+func (m *Nsf) drawText(s string, y, scale int, color uint32) {
+	s = strings.ToUpper(s)
+
+	// Truncate anything that doesn't fit on a line
+	if max := NsfDisplayWidth / (6 * scale); len(s) > max {
+		s = s[:max]
+	}
+
+	x := (NsfDisplayWidth - (len(s) * 6 * scale)) / 2
+
+	for _, c := range s {
+		if c < ' ' || int(c-' ') >= len(NsfFont) {
+			c = '?'
+		}
+
+		for col, bits := range NsfFont[c-' '] {
+			for row := 0; row < 7; row++ {
+				if bits&(1<<uint(row)) == 0 {
+					continue
+				}
+
+				m.fillRect(x+(col*scale), y+(row*scale), scale, color)
+			}
+		}
+
+		x += 6 * scale
+	}
+}
+
+func (m *Nsf) fillRect(x, y, size int, color uint32) {
+	for py := y; py < y+size && py < NsfDisplayHeight; py++ {
+		for px := x; px < x+size && px < NsfDisplayWidth; px++ {
+			m.Framebuffer[(py*NsfDisplayWidth)+px] = color << 8
+		}
+	}
+}
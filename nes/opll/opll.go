@@ -0,0 +1,437 @@
+// Package opll implements the YM2413 derived FM synthesizer found
+// in the Konami VRC7. It has six two-operator FM channels, 15 fixed
+// instrument patches and a single user defined patch. No rhythm mode.
+//
+// All of the synthesis is done in integer math using the same
+// log-sin/exponent table approach as the real chip, so the output for
+// a given sequence of register writes is fully deterministic.
+package opll
+
+import (
+	"math"
+)
+
+const (
+	// The chip runs at 3.58MHz and produces one
+	// sample every 72 clocks
+	ClockRate  = 3579545
+	SampleRate = ClockRate / 72
+
+	Channels = 6
+)
+
+const (
+	egAttack = iota
+	egDecay
+	egSustain
+	egRelease
+	egOff
+)
+
+const (
+	// Envelope attenuation is 7 bits in 0.375dB steps
+	egMax = 127
+)
+
+var (
+	// Built in instrument set, dumped from a VRC7 die.
+	// Patch 0 is the user defined instrument.
+	Patches = [16][8]uint8{
+		{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		{0x03, 0x21, 0x05, 0x06, 0xE8, 0x81, 0x42, 0x27}, // Buzzy bell
+		{0x13, 0x41, 0x14, 0x0D, 0xD8, 0xF6, 0x23, 0x12}, // Guitar
+		{0x11, 0x11, 0x08, 0x08, 0xFA, 0xB2, 0x20, 0x12}, // Wurly
+		{0x31, 0x61, 0x0C, 0x07, 0xA8, 0x64, 0x61, 0x27}, // Flute
+		{0x32, 0x21, 0x1E, 0x06, 0xE1, 0x76, 0x01, 0x28}, // Clarinet
+		{0x02, 0x01, 0x06, 0x00, 0xA3, 0xE2, 0xF4, 0xF4}, // Synth
+		{0x21, 0x61, 0x1D, 0x07, 0x82, 0x81, 0x11, 0x07}, // Trumpet
+		{0x23, 0x21, 0x22, 0x17, 0xA2, 0x72, 0x01, 0x17}, // Organ
+		{0x35, 0x11, 0x25, 0x00, 0x40, 0x73, 0x72, 0x01}, // Bells
+		{0xB5, 0x01, 0x0F, 0x0F, 0xA8, 0xA5, 0x51, 0x02}, // Vibes
+		{0x17, 0xC1, 0x24, 0x07, 0xF8, 0xF8, 0x22, 0x12}, // Vibraphone
+		{0x71, 0x23, 0x11, 0x06, 0x65, 0x74, 0x18, 0x16}, // Tutti
+		{0x01, 0x02, 0xD3, 0x05, 0xC9, 0x95, 0x03, 0x02}, // Fretless
+		{0x61, 0x63, 0x0C, 0x00, 0x94, 0xC0, 0x33, 0xF6}, // Synth bass
+		{0x21, 0x72, 0x0D, 0x00, 0xC1, 0xD5, 0x56, 0x06}, // Sweep
+	}
+
+	// Frequency multipliers, doubled so that the
+	// 1/2 multiplier is an integer
+	multTable = [16]int{
+		1, 2, 4, 6, 8, 10, 12, 14,
+		16, 18, 20, 20, 24, 24, 30, 30,
+	}
+
+	// Key scale level attenuation per F-number, in 0.375dB steps
+	kslTable = [16]int{
+		0, 24, 32, 37, 40, 43, 45, 47,
+		48, 50, 51, 52, 53, 54, 55, 56,
+	}
+
+	// Envelope increments for the four sub-rates
+	egIncrement = [4][8]int{
+		{0, 1, 0, 1, 0, 1, 0, 1},
+		{0, 1, 0, 1, 1, 1, 0, 1},
+		{0, 1, 1, 1, 0, 1, 1, 1},
+		{0, 1, 1, 1, 1, 1, 1, 1},
+	}
+
+	// Vibrato offsets applied to the top bits of the F-number
+	vibTable = [8]int{0, 1, 2, 1, 0, -1, -2, -1}
+
+	// Quarter wave of -log2(sin(x)), in 1/256ths
+	logSinTable [256]int
+	// 2^(-x/256), scaled to 10 bits
+	expTable [256]int
+)
+
+func init() {
+	for i := range logSinTable {
+		s := math.Sin((float64(i) + 0.5) * math.Pi / 512)
+		logSinTable[i] = int(math.Floor(-math.Log2(s)*256 + 0.5))
+	}
+
+	for i := range expTable {
+		expTable[i] = int(math.Floor(math.Pow(2, -float64(i)/256)*1024 + 0.5))
+	}
+}
+
+type Operator struct {
+	Phase  int
+	Output int
+
+	EgState int
+	EgLevel int
+
+	// Previous two outputs, used for modulator feedback
+	Feedback [2]int
+}
+
+type Channel struct {
+	FNumber    int
+	Block      int
+	KeyOn      bool
+	Sustain    bool
+	Instrument int
+	Volume     int
+
+	Modulator Operator
+	Carrier   Operator
+}
+
+type Opll struct {
+	Registers [0x40]uint8
+	Channels  [Channels]Channel
+	Address   uint8
+
+	EgCounter  int
+	AmCounter  int
+	VibCounter int
+
+	// Output of the most recent sample
+	Sample int
+}
+
+func New() *Opll {
+	o := &Opll{}
+	o.Reset()
+
+	return o
+}
+
+func (o *Opll) Reset() {
+	*o = Opll{}
+
+	for i := range o.Channels {
+		c := &o.Channels[i]
+		c.Modulator.EgState = egOff
+		c.Modulator.EgLevel = egMax
+		c.Carrier.EgState = egOff
+		c.Carrier.EgLevel = egMax
+	}
+}
+
+func (o *Opll) WriteAddress(v uint8) {
+	o.Address = v & 0x3F
+}
+
+func (o *Opll) WriteData(v uint8) {
+	o.Write(o.Address, v)
+}
+
+func (o *Opll) Write(a uint8, v uint8) {
+	a &= 0x3F
+	o.Registers[a] = v
+
+	if a < 0x08 {
+		// Custom instrument, read back out of the
+		// registers when a channel uses patch 0
+		return
+	}
+
+	i := int(a & 0xF)
+	if i >= Channels {
+		return
+	}
+
+	c := &o.Channels[i]
+
+	switch a & 0xF0 {
+	case 0x10:
+		c.FNumber = (c.FNumber & 0x100) | int(v)
+	case 0x20:
+		// --SK BBBF
+		//   || ||||
+		//   || |||+- F-number bit 8
+		//   || +++-- Block (octave)
+		//   |+------ Key on
+		//   +------- Sustain
+		c.FNumber = (c.FNumber & 0xFF) | (int(v&0x1) << 8)
+		c.Block = int(v>>1) & 0x7
+		c.Sustain = v&0x20 == 0x20
+
+		key := v&0x10 == 0x10
+		if key && !c.KeyOn {
+			c.keyOn()
+		} else if !key && c.KeyOn {
+			c.keyOff()
+		}
+
+		c.KeyOn = key
+	case 0x30:
+		c.Instrument = int(v >> 4)
+		c.Volume = int(v & 0xF)
+	}
+}
+
+func (c *Channel) keyOn() {
+	c.Modulator.EgState = egAttack
+	c.Modulator.Phase = 0
+	c.Carrier.EgState = egAttack
+	c.Carrier.Phase = 0
+}
+
+func (c *Channel) keyOff() {
+	if c.Modulator.EgState != egOff {
+		c.Modulator.EgState = egRelease
+	}
+
+	if c.Carrier.EgState != egOff {
+		c.Carrier.EgState = egRelease
+	}
+}
+
+func (o *Opll) patch(c *Channel) []uint8 {
+	if c.Instrument == 0 {
+		return o.Registers[0:8]
+	}
+
+	return Patches[c.Instrument][:]
+}
+
+// Generates a single sample. Should be called at SampleRate,
+// every 36 NES CPU cycles.
+func (o *Opll) Clock() {
+	o.EgCounter++
+	o.AmCounter = (o.AmCounter + 1) % (SampleRate * 10 / 37)
+	o.VibCounter = (o.VibCounter + 1) % (SampleRate * 10 / 64)
+
+	sum := 0
+	for i := range o.Channels {
+		sum += o.clockChannel(&o.Channels[i])
+	}
+
+	o.Sample = sum
+}
+
+// Tremolo, a 3.7Hz triangle wave with a depth of 4.8dB
+func (o *Opll) amLevel() int {
+	period := SampleRate * 10 / 37
+	half := period / 2
+
+	pos := o.AmCounter
+	if pos >= half {
+		pos = period - pos
+	}
+
+	return (pos * 13) / half
+}
+
+// Vibrato, a 6.4Hz wave in 8 steps
+func (o *Opll) vibStep() int {
+	period := SampleRate * 10 / 64
+	return vibTable[(o.VibCounter*8)/period]
+}
+
+func (o *Opll) clockChannel(c *Channel) int {
+	p := o.patch(c)
+
+	// Modulator
+	feedback := int(p[3] & 0x7)
+	var modIn int
+	if feedback > 0 {
+		modIn = (c.Modulator.Feedback[0] + c.Modulator.Feedback[1]) >> uint(9-feedback)
+	}
+
+	tl := int(p[2]&0x3F) << 1
+	mod := o.clockOperator(c, &c.Modulator, p[0], p[2]>>6, p[4], p[6], p[3]&0x8 == 0x8, tl, modIn)
+
+	c.Modulator.Feedback[1] = c.Modulator.Feedback[0]
+	c.Modulator.Feedback[0] = mod
+
+	// Carrier, phase modulated by the modulator
+	vol := c.Volume << 3
+	return o.clockOperator(c, &c.Carrier, p[1], p[3]>>6, p[5], p[7], p[3]&0x10 == 0x10, vol, mod>>1)
+}
+
+func (o *Opll) clockOperator(c *Channel, op *Operator, flags, ksl, adr, slrr uint8, rectified bool, base, mod int) int {
+	// Phase generator
+	fnum := c.FNumber
+	if flags&0x40 == 0x40 {
+		fnum += ((c.FNumber >> 6) * o.vibStep()) >> 1
+	}
+
+	op.Phase += ((fnum << uint(c.Block)) * multTable[flags&0xF]) >> 1
+	op.Phase &= 0x7FFFF
+
+	o.clockEnvelope(c, op, flags, adr, slrr)
+
+	// Total attenuation in 0.375dB steps
+	att := op.EgLevel + base
+	if ksl > 0 {
+		k := kslTable[c.FNumber>>5] - ((7 - c.Block) << 3)
+		if k > 0 {
+			att += k >> (3 - ksl)
+		}
+	}
+
+	if flags&0x80 == 0x80 {
+		att += o.amLevel()
+	}
+
+	if att >= egMax || op.EgState == egOff {
+		op.Output = 0
+		return 0
+	}
+
+	phase := ((op.Phase >> 9) + mod) & 0x3FF
+
+	// The second half of the wave is negative, or
+	// silent for the rectified wave
+	negative := phase&0x200 == 0x200
+	if negative && rectified {
+		op.Output = 0
+		return 0
+	}
+
+	// Mirror the quarter wave table
+	index := phase & 0xFF
+	if phase&0x100 == 0x100 {
+		index = 0xFF - index
+	}
+
+	// Each envelope step is 0.375dB, which is 16 steps
+	// of the 1/256 octave log table
+	l := logSinTable[index] + (att << 4)
+	out := (expTable[l&0xFF] << 1) >> uint(l>>8)
+
+	if negative {
+		out = -out
+	}
+
+	op.Output = out
+
+	return out
+}
+
+func (o *Opll) egRate(c *Channel, flags uint8, r int) int {
+	if r == 0 {
+		return 0
+	}
+
+	// Key scale rate
+	rks := c.Block >> 1
+	if flags&0x10 == 0x10 {
+		rks = (c.Block << 1) | (c.FNumber >> 8)
+	}
+
+	rate := (r << 2) + rks
+	if rate > 63 {
+		rate = 63
+	}
+
+	return rate
+}
+
+func (o *Opll) egStep(rate int) int {
+	if rate == 0 {
+		return 0
+	}
+
+	shift := 13 - (rate >> 2)
+	if shift <= 0 {
+		// Fastest rates step multiple times per sample
+		return egIncrement[rate&0x3][o.EgCounter&0x7] << uint((rate>>2)-13)
+	}
+
+	if o.EgCounter&((1<<uint(shift))-1) != 0 {
+		return 0
+	}
+
+	return egIncrement[rate&0x3][(o.EgCounter>>uint(shift))&0x7]
+}
+
+func (o *Opll) clockEnvelope(c *Channel, op *Operator, flags, adr, slrr uint8) {
+	sustained := flags&0x20 == 0x20
+	ar := int(adr >> 4)
+	dr := int(adr & 0xF)
+	sl := int(slrr>>4) << 3
+	rr := int(slrr & 0xF)
+
+	switch op.EgState {
+	case egAttack:
+		if ar == 15 {
+			op.EgLevel = 0
+		} else {
+			inc := o.egStep(o.egRate(c, flags, ar))
+			op.EgLevel -= ((op.EgLevel >> 3) + 1) * inc
+		}
+
+		if op.EgLevel <= 0 {
+			op.EgLevel = 0
+			op.EgState = egDecay
+		}
+	case egDecay:
+		op.EgLevel += o.egStep(o.egRate(c, flags, dr))
+
+		if op.EgLevel >= sl {
+			op.EgState = egSustain
+		}
+	case egSustain:
+		// Percussive instruments keep decaying
+		// at the release rate
+		if !sustained {
+			op.EgLevel += o.egStep(o.egRate(c, flags, rr))
+		}
+	case egRelease:
+		var rate int
+		switch {
+		case c.Sustain:
+			rate = o.egRate(c, flags, 5)
+		case sustained:
+			rate = o.egRate(c, flags, rr)
+		default:
+			rate = o.egRate(c, flags, 7)
+		}
+
+		op.EgLevel += o.egStep(rate)
+	}
+
+	if op.EgLevel >= egMax {
+		op.EgLevel = egMax
+
+		if op.EgState != egAttack {
+			op.EgState = egOff
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package opll
+
+import (
+	"testing"
+)
+
+// Plays a middle A on the flute patch, then releases it
+func playNote(o *Opll, samples int) []int {
+	out := make([]int, 0, samples)
+
+	o.Write(0x30, 0x40)
+	o.Write(0x10, 0x20)
+	o.Write(0x20, 0x19)
+
+	for i := 0; i < samples; i++ {
+		if i == samples/2 {
+			o.Write(0x20, 0x09)
+		}
+
+		o.Clock()
+		out = append(out, o.Sample)
+	}
+
+	return out
+}
+
+func TestSilentAfterReset(test *testing.T) {
+	o := New()
+
+	for i := 0; i < 1000; i++ {
+		o.Clock()
+
+		if o.Sample != 0 {
+			test.Fatalf("Sample %d was %d, expected silence", i, o.Sample)
+		}
+	}
+}
+
+func TestKeyOnProducesOutput(test *testing.T) {
+	o := New()
+
+	peak := 0
+	for _, s := range playNote(o, SampleRate/4) {
+		if s > peak {
+			peak = s
+		}
+	}
+
+	if peak == 0 {
+		test.Errorf("Keyed on channel produced no output")
+	}
+}
+
+func TestDeterministicOutput(test *testing.T) {
+	a := playNote(New(), SampleRate)
+	b := playNote(New(), SampleRate)
+
+	for i := range a {
+		if a[i] != b[i] {
+			test.Fatalf("Sample %d differed: %d != %d", i, a[i], b[i])
+		}
+	}
+}
+
+func TestCustomPatch(test *testing.T) {
+	o := New()
+
+	// Sustained sine carrier with the modulator
+	// fully attenuated
+	patch := []uint8{0x20, 0x21, 0x3F, 0x00, 0xF0, 0xF0, 0x00, 0x00}
+	for i, v := range patch {
+		o.Write(uint8(i), v)
+	}
+
+	o.Write(0x30, 0x00)
+	o.Write(0x10, 0x80)
+	o.Write(0x20, 0x18)
+
+	var positive, negative bool
+	for i := 0; i < SampleRate/10; i++ {
+		o.Clock()
+
+		if o.Sample > 0 {
+			positive = true
+		} else if o.Sample < 0 {
+			negative = true
+		}
+	}
+
+	if !positive || !negative {
+		test.Errorf("Custom patch did not produce a full wave")
+	}
+}
@@ -0,0 +1,350 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var (
+	PatchExtensions = []string{".ips", ".ups", ".bps"}
+
+	errPatchTruncated = errors.New("Patch file is truncated")
+)
+
+// Patches named after the game that sit alongside the ROM,
+// in the order they should be applied
+func FindPatches(dir, name string) []string {
+	var patches []string
+
+	for _, ext := range PatchExtensions {
+		filename := filepath.Join(dir, name+ext)
+
+		if _, err := os.Stat(filename); err == nil {
+			patches = append(patches, filename)
+		}
+	}
+
+	return patches
+}
+
+// Applies each patch file in turn, so later patches
+// apply on top of the earlier ones
+func PatchRom(rom []byte, patches []string) ([]byte, error) {
+	for _, filename := range patches {
+		patch, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		if rom, err = ApplyPatch(rom, patch); err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: %s", filename, err.Error()))
+		}
+
+		fmt.Println("Applied patch", filename)
+	}
+
+	return rom, nil
+}
+
+// Applies an IPS, UPS or BPS patch to the whole ROM image,
+// header included, returning the patched copy
+func ApplyPatch(rom, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte("PATCH")):
+		return ApplyIps(rom, patch)
+	case bytes.HasPrefix(patch, []byte("UPS1")):
+		return ApplyUps(rom, patch)
+	case bytes.HasPrefix(patch, []byte("BPS1")):
+		return ApplyBps(rom, patch)
+	}
+
+	return nil, errors.New("Unrecognized patch format")
+}
+
+// Records are a 24-bit offset and a 16-bit length followed by the
+// data, or a zero length then a run length and the byte to repeat
+func ApplyIps(rom, patch []byte) ([]byte, error) {
+	out := make([]byte, len(rom))
+	copy(out, rom)
+
+	p := 5
+	for {
+		if p+3 > len(patch) {
+			return nil, errPatchTruncated
+		}
+
+		if string(patch[p:p+3]) == "EOF" {
+			p += 3
+			break
+		}
+
+		if p+5 > len(patch) {
+			return nil, errPatchTruncated
+		}
+
+		offset := int(patch[p])<<16 | int(patch[p+1])<<8 | int(patch[p+2])
+		size := int(binary.BigEndian.Uint16(patch[p+3:]))
+		p += 5
+
+		var data []byte
+		if size == 0 {
+			if p+3 > len(patch) {
+				return nil, errPatchTruncated
+			}
+
+			data = bytes.Repeat(patch[p+2:p+3], int(binary.BigEndian.Uint16(patch[p:])))
+			p += 3
+		} else {
+			if p+size > len(patch) {
+				return nil, errPatchTruncated
+			}
+
+			data = patch[p : p+size]
+			p += size
+		}
+
+		if offset+len(data) > len(out) {
+			out = append(out, make([]byte, offset+len(data)-len(out))...)
+		}
+
+		copy(out[offset:], data)
+	}
+
+	// Some patches truncate the file after applying
+	if p+3 <= len(patch) {
+		size := int(patch[p])<<16 | int(patch[p+1])<<8 | int(patch[p+2])
+		if size < len(out) {
+			out = out[:size]
+		}
+	}
+
+	return out, nil
+}
+
+// Builds an IPS patch that turns the original into the modified
+// copy, which has to be the same size
+func MakeIps(original, modified []byte) []byte {
+	patch := []byte("PATCH")
+
+	for i := 0; i < len(modified); {
+		if modified[i] == original[i] {
+			i++
+			continue
+		}
+
+		// Runs are split at 64k, the most a record can hold
+		start := i
+		for i < len(modified) && modified[i] != original[i] && i-start < 0xFFFF {
+			i++
+		}
+
+		patch = append(patch, byte(start>>16), byte(start>>8), byte(start))
+		patch = append(patch, byte((i-start)>>8), byte(i-start))
+		patch = append(patch, modified[start:i]...)
+	}
+
+	return append(patch, []byte("EOF")...)
+}
+
+type patchReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *patchReader) readByte() byte {
+	if r.pos >= len(r.data) {
+		r.err = errPatchTruncated
+		return 0
+	}
+
+	r.pos++
+	return r.data[r.pos-1]
+}
+
+// The variable length integers used by UPS and BPS
+func (r *patchReader) readNumber() int {
+	n, shift := 0, 1
+
+	for r.err == nil {
+		x := r.readByte()
+		n += int(x&0x7F) * shift
+
+		if x&0x80 != 0 || shift > 1<<28 {
+			break
+		}
+
+		shift <<= 7
+		n += shift
+	}
+
+	return n
+}
+
+// UPS and BPS both end in the CRC32s of the source,
+// target and of the patch itself
+func checkPatch(rom, patch []byte) error {
+	if len(patch) < 16 {
+		return errPatchTruncated
+	}
+
+	footer := patch[len(patch)-12:]
+
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != binary.LittleEndian.Uint32(footer[8:]) {
+		return errors.New("Patch file is corrupt: checksum mismatch")
+	}
+
+	if c := binary.LittleEndian.Uint32(footer); crc32.ChecksumIEEE(rom) != c {
+		return errors.New(fmt.Sprintf("Patch is for a different ROM: expected CRC32 %08X, got %08X",
+			c, crc32.ChecksumIEEE(rom)))
+	}
+
+	return nil
+}
+
+func checkTarget(out, patch []byte) error {
+	footer := patch[len(patch)-12:]
+
+	if c := binary.LittleEndian.Uint32(footer[4:]); crc32.ChecksumIEEE(out) != c {
+		return errors.New(fmt.Sprintf("Patched ROM has CRC32 %08X, expected %08X",
+			crc32.ChecksumIEEE(out), c))
+	}
+
+	return nil
+}
+
+// The patch XORs runs of bytes against the source, each run
+// starting a given distance after the end of the last
+func ApplyUps(rom, patch []byte) ([]byte, error) {
+	if err := checkPatch(rom, patch); err != nil {
+		return nil, err
+	}
+
+	r := &patchReader{data: patch[:len(patch)-12], pos: 4}
+	r.readNumber()
+	size := r.readNumber()
+
+	if r.err != nil || size > 1<<26 {
+		return nil, errors.New("Invalid UPS patch size")
+	}
+
+	out := make([]byte, size)
+	copy(out, rom)
+
+	for i := 0; r.pos < len(r.data) && r.err == nil; {
+		i += r.readNumber()
+
+		for r.err == nil {
+			x := r.readByte()
+			if x == 0 {
+				i++
+				break
+			}
+
+			if i < len(out) {
+				out[i] ^= x
+			}
+
+			i++
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return out, checkTarget(out, patch)
+}
+
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// The target is built from runs copied from the source or from
+// earlier in the target, or read out of the patch
+func ApplyBps(rom, patch []byte) ([]byte, error) {
+	if err := checkPatch(rom, patch); err != nil {
+		return nil, err
+	}
+
+	r := &patchReader{data: patch[:len(patch)-12], pos: 4}
+	r.readNumber()
+	size := r.readNumber()
+	r.pos += r.readNumber()
+
+	if r.err != nil || size > 1<<26 {
+		return nil, errors.New("Invalid BPS patch size")
+	}
+
+	out := make([]byte, size)
+	o, sourceRel, targetRel := 0, 0, 0
+
+	relative := func() int {
+		n := r.readNumber()
+		if n&1 == 1 {
+			return -(n >> 1)
+		}
+
+		return n >> 1
+	}
+
+	for r.pos < len(r.data) && r.err == nil {
+		n := r.readNumber()
+		length := (n >> 2) + 1
+
+		if o+length > len(out) {
+			return nil, errors.New("BPS patch writes past the end of the ROM")
+		}
+
+		switch n & 0x3 {
+		case bpsSourceRead:
+			if o+length > len(rom) {
+				return nil, errors.New("BPS patch reads past the end of the ROM")
+			}
+
+			copy(out[o:], rom[o:o+length])
+			o += length
+		case bpsTargetRead:
+			for i := 0; i < length; i++ {
+				out[o] = r.readByte()
+				o++
+			}
+		case bpsSourceCopy:
+			sourceRel += relative()
+			if sourceRel < 0 || sourceRel+length > len(rom) {
+				return nil, errors.New("BPS patch reads past the end of the ROM")
+			}
+
+			copy(out[o:], rom[sourceRel:sourceRel+length])
+			o += length
+			sourceRel += length
+		case bpsTargetCopy:
+			targetRel += relative()
+			if targetRel < 0 || targetRel >= o {
+				return nil, errors.New("BPS patch copies from outside the ROM")
+			}
+
+			// Overlapping copies repeat what was just written
+			for i := 0; i < length; i++ {
+				out[o] = out[targetRel]
+				o++
+				targetRel++
+			}
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return out, checkTarget(out, patch)
+}
@@ -0,0 +1,152 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func patchNumber(n int) []byte {
+	var b []byte
+
+	for {
+		x := byte(n & 0x7F)
+		n >>= 7
+
+		if n == 0 {
+			return append(b, x|0x80)
+		}
+
+		b = append(b, x)
+		n--
+	}
+}
+
+func patchFooter(patch, source, target []byte) []byte {
+	footer := make([]byte, 4)
+
+	binary.LittleEndian.PutUint32(footer, crc32.ChecksumIEEE(source))
+	patch = append(patch, footer...)
+	binary.LittleEndian.PutUint32(footer, crc32.ChecksumIEEE(target))
+	patch = append(patch, footer...)
+	binary.LittleEndian.PutUint32(footer, crc32.ChecksumIEEE(patch))
+
+	return append(patch, footer...)
+}
+
+func TestIps(test *testing.T) {
+	rom := testRom(1, 1, 0)
+
+	patch := []byte("PATCH")
+	// Three bytes at $10
+	patch = append(patch, 0x00, 0x00, 0x10, 0x00, 0x03, 0xAA, 0xBB, 0xCC)
+	// A run of four $EE at $20
+	patch = append(patch, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x04, 0xEE)
+	patch = append(patch, []byte("EOF")...)
+
+	out, err := ApplyPatch(rom, patch)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !bytes.Equal(out[0x10:0x13], []byte{0xAA, 0xBB, 0xCC}) {
+		test.Errorf("Patched bytes were % X", out[0x10:0x13])
+	}
+
+	if !bytes.Equal(out[0x1F:0x25], []byte{0x00, 0xEE, 0xEE, 0xEE, 0xEE, 0x00}) {
+		test.Errorf("Patched run was % X", out[0x1F:0x25])
+	}
+
+	if rom[0x10] != 0 {
+		test.Error("The original ROM was modified")
+	}
+
+	if _, err := ApplyPatch(rom, patch[:len(patch)-3]); err == nil {
+		test.Error("Expected an error for a truncated patch")
+	}
+}
+
+func TestUps(test *testing.T) {
+	rom := testRom(1, 1, 0)
+	target := make([]byte, len(rom)+2)
+	copy(target, rom)
+	target[0x10] = 0x12
+	target[0x11] = 0x34
+	target[len(target)-1] = 0x56
+
+	patch := []byte("UPS1")
+	patch = append(patch, patchNumber(len(rom))...)
+	patch = append(patch, patchNumber(len(target))...)
+	patch = append(patch, patchNumber(0x10)...)
+	patch = append(patch, 0x12, 0x34, 0x00)
+	patch = append(patch, patchNumber(len(target)-1-0x13)...)
+	patch = append(patch, 0x56, 0x00)
+	patch = patchFooter(patch, rom, target)
+
+	out, err := ApplyPatch(rom, patch)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !bytes.Equal(out, target) {
+		test.Error("UPS patched ROM didn't match the target")
+	}
+
+	// Applied to the wrong ROM
+	if _, err := ApplyPatch(target, patch); err == nil {
+		test.Error("Expected a source checksum mismatch")
+	}
+
+	patch[5] ^= 0xFF
+	if _, err := ApplyPatch(rom, patch); err == nil {
+		test.Error("Expected a patch checksum mismatch")
+	}
+}
+
+func TestBps(test *testing.T) {
+	rom := testRom(1, 1, 0)
+	for i := range rom[RomHeaderSize:] {
+		rom[RomHeaderSize+i] = byte(i)
+	}
+
+	// Header, then "HI", then a run of $FF, then the
+	// source's PRG data shifted along by one byte
+	target := make([]byte, len(rom))
+	copy(target, rom[:RomHeaderSize])
+	copy(target[RomHeaderSize:], []byte{'H', 'I', 0xFF, 0xFF, 0xFF, 0xFF})
+	rest := len(target) - RomHeaderSize - 6
+	copy(target[RomHeaderSize+6:], rom[RomHeaderSize+1:RomHeaderSize+1+rest])
+
+	patch := []byte("BPS1")
+	patch = append(patch, patchNumber(len(rom))...)
+	patch = append(patch, patchNumber(len(target))...)
+	patch = append(patch, patchNumber(4)...)
+	patch = append(patch, []byte("meta")...)
+	// SourceRead the header
+	patch = append(patch, patchNumber((RomHeaderSize-1)<<2|bpsSourceRead)...)
+	// TargetRead "HI" and one $FF
+	patch = append(patch, patchNumber(2<<2|bpsTargetRead)...)
+	patch = append(patch, 'H', 'I', 0xFF)
+	// TargetCopy the $FF three more times
+	patch = append(patch, patchNumber(2<<2|bpsTargetCopy)...)
+	patch = append(patch, patchNumber((RomHeaderSize+2)<<1)...)
+	// SourceCopy from one byte into the PRG
+	patch = append(patch, patchNumber((rest-1)<<2|bpsSourceCopy)...)
+	patch = append(patch, patchNumber((RomHeaderSize+1)<<1)...)
+	patch = patchFooter(patch, rom, target)
+
+	out, err := ApplyPatch(rom, patch)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if !bytes.Equal(out, target) {
+		test.Errorf("BPS patched ROM didn't match the target: % X", out[RomHeaderSize:RomHeaderSize+8])
+	}
+
+	// Patches stack, so applying it to its own output fails
+	if _, err := ApplyPatch(out, patch); err == nil {
+		test.Error("Expected a source checksum mismatch")
+	}
+}
@@ -1,5 +1,9 @@
 package nes
 
+import (
+	"sync/atomic"
+)
+
 const (
 	StatusSpriteOverflow = iota
 	StatusSprite0Hit
@@ -53,6 +57,7 @@ type Registers struct {
 	WriteLatch       bool
 	HighBitShift     uint16
 	LowBitShift      uint16
+	ShiftAttributes  [2]Word
 }
 
 type Ppu struct {
@@ -79,6 +84,15 @@ type Ppu struct {
 	FrameCount  int
 	FrameCycles int
 
+	// Total cycles run, and the cycle the last address
+	// put on the bus would have been fetched at
+	Cycles   int
+	BusCycle int
+
+	// Cycles already run ahead of the CPU loop, when the CPU
+	// needed the PPU caught up to one of its bus accesses
+	Ahead int
+
 	SuppressNmi        bool
 	SuppressVbl        bool
 	OverscanEnabled    bool
@@ -193,12 +207,38 @@ func (p *Ppu) raster() {
 		bufpx.Pindex = -1
 	}
 
+	if atomic.CompareAndSwapInt32(&screenshotRequested, 1, 0) || p.FrameCount == ScreenshotFrame {
+		p.saveScreenshot()
+	}
+
+	recordFrame(p.Framebuffer)
+
 	p.Output <- p.Framebuffer
 }
 
 func (p *Ppu) Step() {
+	if p.Ahead > 0 {
+		p.Ahead--
+		return
+	}
+
+	p.step()
+}
+
+// Runs the PPU up to the given number of CPU cycles into the
+// current instruction, ahead of the loop that steps it after
+// each instruction
+func (p *Ppu) CatchUp(cycles int) {
+	for ; p.Ahead < 3*cycles; p.Ahead++ {
+		p.step()
+	}
+}
+
+func (p *Ppu) step() {
+	p.Cycles++
+
 	switch {
-	case p.Scanline == 240:
+	case p.Scanline == 241:
 		switch p.Cycle {
 		case 1:
 			if !p.SuppressVbl {
@@ -218,11 +258,8 @@ func (p *Ppu) Step() {
 			}
 			p.raster()
 		}
-	case p.Scanline == 260: // End of vblank
+	case p.Scanline == 260:
 		switch p.Cycle {
-		case 1:
-			// Clear VBlank flag
-			p.clearStatus(StatusVblankStarted)
 		case 341:
 			p.Scanline = -1
 			p.Cycle = 1
@@ -231,38 +268,45 @@ func (p *Ppu) Step() {
 		}
 	case p.Scanline < 240 && p.Scanline > -1:
 		switch p.Cycle {
+		case 5:
+			// The background is still fetched when it's
+			// hidden. The first pattern fetch is made on
+			// time, as it can clock a mapper's counter.
+			if !p.ShowBackground && p.ShowSprites {
+				p.fetch(p.bgPatternTableAddress(0), 5, PpuFetchBackground)
+			}
 		case 254:
 			if p.ShowBackground {
-				// Swap in MMC5 bg RAM
-				if m, ok := rom.(*Mmc5); ok {
-					m.SwapBgVram()
-				}
 				p.renderTileRow()
 			}
 
 			if p.ShowSprites {
-				// Swap in MMC5 sprite RAM
-				if m, ok := rom.(*Mmc5); ok {
-					m.SwapSpriteVram()
-				}
 				p.evaluateScanlineSprites(p.Scanline)
+			} else if p.ShowBackground {
+				p.fetchEmptySprites(0)
 			}
 		case 256:
 			if p.ShowBackground {
 				p.updateEndScanlineRegisters()
 			}
-		case 260:
-			if p.SpritePatternAddress == 0x1 && p.BackgroundPatternAddress == 0x0 {
-				if v, ok := rom.(*Mmc3); ok {
-					v.Hook()
-				}
-			}
 		}
 	case p.Scanline == -1:
 		switch p.Cycle {
 		case 1:
+			// End of vblank
+			p.clearStatus(StatusVblankStarted)
 			p.clearStatus(StatusSprite0Hit)
 			p.clearStatus(StatusSpriteOverflow)
+		case 5:
+			// Nothing is drawn, but the pre-render line
+			// makes the same fetches as any other
+			if p.ShowBackground || p.ShowSprites {
+				p.fetch(p.bgPatternTableAddress(0), 5, PpuFetchBackground)
+			}
+		case 254:
+			if p.ShowBackground || p.ShowSprites {
+				p.fetchEmptySprites(0)
+			}
 		case 304:
 			// Copy scroll latch into VRAMADDR register
 			if p.ShowBackground || p.ShowSprites {
@@ -271,18 +315,47 @@ func (p *Ppu) Step() {
 		}
 	}
 
+	// The nametable byte for the next line is fetched twice
+	// at the end of each line and again at the start of the next
+	if p.fetchingTiles() {
+		switch {
+		case p.Cycle == 321 && p.Scanline < 239 && p.ShowBackground:
+			p.prefetchTiles()
+		case p.Cycle == 337, p.Cycle == 339, p.Cycle == 1 && p.Scanline > -1:
+			p.fetch(0x2000|(p.VramAddress&0xFFF), p.Cycle, PpuFetchNametable)
+		}
+	}
+
 	if p.Cycle == 341 {
 		p.Cycle = 0
 		p.Scanline++
-
-		if m, ok := rom.(*Mmc5); ok {
-			m.NotifyScanline()
-		}
 	}
 
 	p.Cycle++
 }
 
+// Whether the bus is busy with rendering, rather than
+// showing the VRAM address
+func (p *Ppu) fetchingTiles() bool {
+	return (p.ShowBackground || p.ShowSprites) && p.Scanline < 240
+}
+
+// Tells the mapper about a fetch made at the given cycle of
+// the current line. Lines are rendered in one go, so this can
+// be a little ahead of or behind the PPU.
+func (p *Ppu) fetch(a int, cycle int, fetch int) {
+	p.BusCycle = p.Cycles - p.Cycle + cycle
+	observePpuBus(a, fetch)
+}
+
+// Outside of rendering the VRAM address drives the bus
+func (p *Ppu) updateBus(a int) {
+	if !p.fetchingTiles() {
+		p.BusCycle = p.Cycles
+		observePpuBus(a&0x3FFF, PpuFetchData)
+	}
+}
+
 func (p *Ppu) renderingEnabled() bool {
 	return p.ShowBackground && p.ShowSprites
 }
@@ -424,7 +497,7 @@ func (p *Ppu) ReadStatus() (s Word, e error) {
 	p.WriteLatch = true
 	s = Ram[0x2002]
 
-	if p.Cycle == 1 && p.Scanline == 240 {
+	if p.Cycle == 1 && p.Scanline == 241 {
 		s &= 0x7F
 		p.SuppressNmi = true
 		p.SuppressVbl = true
@@ -511,6 +584,7 @@ func (p *Ppu) WriteAddress(v Word) {
 		p.VramLatch = p.VramLatch & 0x7F00
 		p.VramLatch = p.VramLatch | int(v)
 		p.VramAddress = p.VramLatch
+		p.updateBus(p.VramAddress)
 	}
 
 	p.WriteLatch = !p.WriteLatch
@@ -524,12 +598,8 @@ func (p *Ppu) WriteData(v Word) {
 		// Nametable mirroring
 		p.Nametables.writeNametableData(p.VramAddress, v)
 	} else if p.VramAddress < 0x2000 {
+		p.updateBus(p.VramAddress)
 		rom.WriteVram(v, p.VramAddress&0x3FFF)
-		// MMC2 latch trigger
-		if v, ok := rom.(*Mmc2); ok {
-			t := p.bgPatternTableAddress(p.Nametables.readNametableData(p.VramAddress))
-			v.LatchTrigger(t)
-		}
 	} else {
 		p.Vram[p.VramAddress&0x3FFF] = v
 	}
@@ -548,12 +618,8 @@ func (p *Ppu) ReadData() (r Word, err error) {
 		r = p.VramDataBuffer
 
 		if p.VramAddress < 0x2000 {
+			p.updateBus(p.VramAddress)
 			p.VramDataBuffer = rom.ReadVram(p.VramAddress)
-			// MMC2 latch trigger
-			if v, ok := rom.(*Mmc2); ok {
-				t := p.bgPatternTableAddress(p.Nametables.readNametableData(p.VramAddress))
-				v.LatchTrigger(t)
-			}
 		} else {
 			p.VramDataBuffer = p.Vram[p.VramAddress]
 		}
@@ -572,14 +638,6 @@ func (p *Ppu) ReadData() (r Word, err error) {
 		}
 
 		r = p.PaletteRam[a&0x1F]
-
-		if p.VramAddress < 0x2000 {
-			// MMC2 latch trigger
-			if v, ok := rom.(*Mmc2); ok {
-				t := p.bgPatternTableAddress(p.Nametables.readNametableData(p.VramAddress))
-				v.LatchTrigger(t)
-			}
-		}
 	}
 
 	p.incrementVramAddress()
@@ -594,6 +652,8 @@ func (p *Ppu) incrementVramAddress() {
 	default:
 		p.VramAddress = p.VramAddress + 0x01
 	}
+
+	p.updateBus(p.VramAddress)
 }
 
 func (p *Ppu) sprPatternTableAddress(i int) int {
@@ -629,14 +689,19 @@ func (p *Ppu) bgPatternTableAddress(i Word) int {
 	return (int(i) << 4) | (p.VramAddress >> 12) | a
 }
 
-func (p *Ppu) fetchTileAttributes() (uint16, uint16, Word) {
-	attrAddr := 0x23C0 | (p.VramAddress & 0xC00) | int(p.AttributeLocation[p.VramAddress&0x3FF])
-	shift := p.AttributeShift[p.VramAddress&0x3FF]
-	attr := ((p.Nametables.readNametableData(attrAddr) >> shift) & 0x03) << 2
+// Fetches the tile starting at the given cycle
+func (p *Ppu) fetchTileAttributes(cycle int) (uint16, uint16, Word) {
+	v := p.VramAddress
 
+	p.fetch(0x2000|(p.VramAddress&0xFFF), cycle, PpuFetchNametable)
 	index := p.Nametables.readNametableData(p.VramAddress)
 	t := p.bgPatternTableAddress(index)
 
+	attrAddr := 0x23C0 | (p.VramAddress & 0xC00) | int(p.AttributeLocation[p.VramAddress&0x3FF])
+	shift := p.AttributeShift[p.VramAddress&0x3FF]
+	p.fetch(attrAddr, cycle+2, PpuFetchAttribute)
+	attr := ((p.Nametables.readNametableData(attrAddr) >> shift) & 0x03) << 2
+
 	// Flip bit 10 on wraparound
 	if p.VramAddress&0x1F == 0x1F {
 		// If rendering is enabled, at the end of a scanline
@@ -646,11 +711,36 @@ func (p *Ppu) fetchTileAttributes() (uint16, uint16, Word) {
 		p.VramAddress++
 	}
 
-	// MMC2 latch trigger
-	// TODO: Should be a generic hook, the branch here
-	// is too slow
+	p.fetch(t, cycle+4, PpuFetchBackground)
+	low := rom.ReadVram(t)
+	p.fetch(t+8, cycle+6, PpuFetchBackground)
+	high := rom.ReadVram(t + 8)
+
+	// The first two tiles of a line are fetched at the
+	// end of the line before
+	column, line := (cycle-1)/8+2, p.Scanline
+	if cycle > 320 {
+		column, line = (cycle-321)/8, p.Scanline+1
+	}
+
+	if l, h, palette, ok := fetchBackground(v, column, line); ok {
+		return uint16(l), uint16(h), palette << 2
+	}
+
+	return uint16(low), uint16(high), attr
+}
+
+// Loads the first two tiles of the next line into the
+// shift registers
+func (p *Ppu) prefetchTiles() {
+	low, high, attr := p.fetchTileAttributes(321)
+	p.LowBitShift, p.HighBitShift = low, high
+	p.ShiftAttributes[0] = attr
 
-	return uint16(rom.ReadVram(t)), uint16(rom.ReadVram(t + 8)), attr
+	low, high, attr = p.fetchTileAttributes(329)
+	p.LowBitShift = (p.LowBitShift << 8) | low
+	p.HighBitShift = (p.HighBitShift << 8) | high
+	p.ShiftAttributes[1] = attr
 }
 
 func (p *Ppu) renderTileRow() {
@@ -660,16 +750,9 @@ func (p *Ppu) renderTileRow() {
 	// Load first two tiles into shift registers at start, then load
 	// one per loop and shift the other back out
 
-	// Move first tile into shift registers
-	low, high, attr := p.fetchTileAttributes()
-	p.LowBitShift, p.HighBitShift = low, high
-
-	low, high, attrBuf := p.fetchTileAttributes()
-	// Get second tile, move the pixels into the right side of
-	// shift registers
-	// Current tile to render is attrBuf
-	p.LowBitShift = (p.LowBitShift << 8) | low
-	p.HighBitShift = (p.HighBitShift << 8) | high
+	// The first two tiles were fetched at the end of the
+	// previous line. Current tile to render is attrBuf
+	attr, attrBuf := p.ShiftAttributes[0], p.ShiftAttributes[1]
 
 	for x := 0; x < 32; x++ {
 		var palette int
@@ -707,7 +790,8 @@ func (p *Ppu) renderTileRow() {
 		attr = attrBuf
 
 		// Shift the first tile out, bring the new tile in
-		low, high, attrBuf = p.fetchTileAttributes()
+		low, high, next := p.fetchTileAttributes(x*8 + 1)
+		attrBuf = next
 
 		p.LowBitShift = (p.LowBitShift << 8) | low
 		p.HighBitShift = (p.HighBitShift << 8) | high
@@ -743,6 +827,10 @@ func (p *Ppu) evaluateScanlineSprites(line int) {
 				s := p.sprPatternTableAddress(int(t))
 				var tile []Word
 
+				if spriteCount < 8 {
+					p.fetchSpritePattern(s, spriteCount)
+				}
+
 				top := rom.ReadTile(s)
 				bottom := rom.ReadTile(s + 16)
 
@@ -768,6 +856,11 @@ func (p *Ppu) evaluateScanlineSprites(line int) {
 			} else {
 				// 8x8 Sprite
 				s := p.sprPatternTableAddress(int(t))
+
+				if spriteCount < 8 {
+					p.fetchSpritePattern(s, spriteCount)
+				}
+
 				tile := rom.ReadTile(s)
 
 				p.decodePatternTile([]Word{tile[c], tile[c+8]},
@@ -787,6 +880,27 @@ func (p *Ppu) evaluateScanlineSprites(line int) {
 			}
 		}
 	}
+
+	p.fetchEmptySprites(spriteCount)
+}
+
+// Sprite patterns are fetched as a low and high plane,
+// after two garbage nametable fetches
+func (p *Ppu) fetchSpritePattern(a int, slot int) {
+	cycle := 257 + slot*8
+
+	p.fetch(0x2000|(p.VramAddress&0xFFF), cycle, PpuFetchNametable)
+	p.fetch(0x2000|(p.VramAddress&0xFFF), cycle+2, PpuFetchNametable)
+	p.fetch(a, cycle+4, PpuFetchSprite)
+	p.fetch(a+8, cycle+6, PpuFetchSprite)
+}
+
+// Eight sprites are fetched on every line, with tile $FF
+// standing in for the empty slots
+func (p *Ppu) fetchEmptySprites(n int) {
+	for ; n < 8; n++ {
+		p.fetchSpritePattern(p.sprPatternTableAddress(0xFF), n)
+	}
 }
 
 func (p *Ppu) decodePatternTile(t []Word, x, y int, palIndex uint, attr *Word, spZero bool, index int) {
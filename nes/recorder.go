@@ -0,0 +1,247 @@
+package nes
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	AudioSampleRate = 44100
+)
+
+var (
+	// Each stem is a single channel's part of the mix,
+	// filtered the same way, so together they add up to it.
+	// The DMC isn't mixed in, so it has no stem.
+	AudioStems = []string{
+		"square1", "square2", "triangle", "noise", "expansion",
+	}
+
+	recorderLock sync.Mutex
+)
+
+// Writes 16-bit mono samples to either a WAV file, or raw
+// little-endian PCM if the filename ends in .pcm or .raw
+type WavWriter struct {
+	Raw     bool
+	Rate    int
+	Samples int
+
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func NewWavWriter(filename string, rate int) (*WavWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WavWriter{
+		Rate:   rate,
+		file:   f,
+		writer: bufio.NewWriter(f),
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".pcm", ".raw":
+		w.Raw = true
+	default:
+		// The sizes are filled in when the file is closed
+		w.writeHeader()
+	}
+
+	return w, nil
+}
+
+func (w *WavWriter) writeHeader() {
+	dataSize := uint32(w.Samples * 2)
+
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], 36+dataSize)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	// PCM, mono
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], 1)
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.Rate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(w.Rate*2))
+	binary.LittleEndian.PutUint16(header[32:], 2)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], dataSize)
+
+	w.writer.Write(header)
+}
+
+func (w *WavWriter) WriteSample(s int16) error {
+	w.Samples++
+
+	if err := w.writer.WriteByte(byte(s)); err != nil {
+		return err
+	}
+
+	return w.writer.WriteByte(byte(uint16(s) >> 8))
+}
+
+func (w *WavWriter) Close() error {
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	if !w.Raw {
+		if _, err := w.file.Seek(0, 0); err != nil {
+			w.file.Close()
+			return err
+		}
+
+		w.writeHeader()
+
+		if err := w.writer.Flush(); err != nil {
+			w.file.Close()
+			return err
+		}
+	}
+
+	return w.file.Close()
+}
+
+// Records the final mixed output of the APU, and optionally
+// each of the channels to its own file
+type AudioRecorder struct {
+	Mix   *WavWriter
+	Stems []*WavWriter
+
+	// High-pass filter state for each stem
+	HipassStrong []int64
+	HipassWeak   []int64
+}
+
+// Filename for a stem, e.g. music.wav -> music.square1.wav
+func AudioStemFilename(filename, stem string) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(filename, ext), stem, ext)
+}
+
+func NewAudioRecorder(filename string, stems bool) (*AudioRecorder, error) {
+	mix, err := NewWavWriter(filename, AudioSampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &AudioRecorder{
+		Mix: mix,
+	}
+
+	if stems {
+		for _, s := range AudioStems {
+			w, err := NewWavWriter(AudioStemFilename(filename, s), AudioSampleRate)
+			if err != nil {
+				r.Close()
+				return nil, err
+			}
+
+			r.Stems = append(r.Stems, w)
+		}
+	}
+
+	return r, nil
+}
+
+func (r *AudioRecorder) Record(a *Apu) {
+	r.Mix.WriteSample(a.Sample)
+
+	if r.Stems == nil {
+		return
+	}
+
+	// The mix's filters carry on from before the recording,
+	// so their state is shared out between the stems for
+	// them to add up to it from the first sample
+	if r.HipassStrong == nil {
+		for range r.Stems {
+			r.HipassStrong = append(r.HipassStrong, a.HipassStrong/int64(len(r.Stems)))
+			r.HipassWeak = append(r.HipassWeak, a.HipassWeak/int64(len(r.Stems)))
+		}
+	}
+
+	for i, s := range a.ChannelOutputs() {
+		v := hipass(&r.HipassStrong[i], int16(s*40000), HiPassStrong)
+		v = hipass(&r.HipassWeak[i], v, HiPassWeak)
+
+		r.Stems[i].WriteSample(v)
+	}
+}
+
+func (r *AudioRecorder) Close() error {
+	err := r.Mix.Close()
+
+	for _, s := range r.Stems {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+func AudioRecording() bool {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	return apu.Recorder != nil
+}
+
+// Starts recording audio to a WAV file. With stems enabled each
+// channel is also written to its own file next to it.
+func StartAudioRecording(filename string, stems bool) error {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	if apu.Recorder != nil {
+		return errors.New("Audio is already being recorded")
+	}
+
+	r, err := NewAudioRecorder(filename, stems)
+	if err != nil {
+		return err
+	}
+
+	apu.Recorder = r
+	fmt.Println("Recording audio to", filename)
+
+	return nil
+}
+
+func StopAudioRecording() error {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	if apu.Recorder == nil {
+		return nil
+	}
+
+	err := apu.Recorder.Close()
+	apu.Recorder = nil
+
+	fmt.Println("Audio recording stopped")
+
+	return err
+}
+
+func recordSample(a *Apu) {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	if a.Recorder != nil {
+		a.Recorder.Record(a)
+	}
+}
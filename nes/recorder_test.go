@@ -0,0 +1,161 @@
+package nes
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWavRecording(test *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	apu.Init(func(int16) {})
+	filename := filepath.Join(dir, "out.wav")
+
+	if err := StartAudioRecording(filename, true); err != nil {
+		test.Fatal(err)
+	}
+
+	// Muted audio is still recorded
+	AudioEnabled = false
+	defer func() { AudioEnabled = true }()
+
+	apu.Square1.Sample = 15
+	for i := 0; i < 100; i++ {
+		apu.PushSample()
+	}
+
+	if err := StopAudioRecording(); err != nil {
+		test.Fatal(err)
+	}
+
+	wav, err := ioutil.ReadFile(filename)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(wav) != 44+200 {
+		test.Fatalf("WAV was %d bytes, expected %d", len(wav), 44+200)
+	}
+
+	if string(wav[0:4]) != "RIFF" || string(wav[8:12]) != "WAVE" {
+		test.Errorf("Missing RIFF/WAVE header")
+	}
+
+	if size := binary.LittleEndian.Uint32(wav[40:]); size != 200 {
+		test.Errorf("Data size was %d, expected 200", size)
+	}
+
+	if rate := binary.LittleEndian.Uint32(wav[24:]); rate != AudioSampleRate {
+		test.Errorf("Sample rate was %d, expected %d", rate, AudioSampleRate)
+	}
+
+	square, err := ioutil.ReadFile(AudioStemFilename(filename, "square1"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	expected := int16(apu.PulseOut[15] * 40000)
+	if s := int16(binary.LittleEndian.Uint16(square[44:])); s != expected {
+		test.Errorf("Square 1 stem sample was %d, expected %d", s, expected)
+	}
+
+	triangle, err := ioutil.ReadFile(AudioStemFilename(filename, "triangle"))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if s := int16(binary.LittleEndian.Uint16(triangle[44:])); s != 0 {
+		test.Errorf("Triangle stem sample was %d, expected 0", s)
+	}
+}
+
+func TestRawPcmRecording(test *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	apu.Init(func(int16) {})
+	filename := filepath.Join(dir, "out.pcm")
+
+	if err := StartAudioRecording(filename, false); err != nil {
+		test.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		apu.PushSample()
+	}
+
+	StopAudioRecording()
+
+	if pcm, _ := ioutil.ReadFile(filename); len(pcm) != 20 {
+		test.Errorf("PCM was %d bytes, expected 20", len(pcm))
+	}
+}
+
+func TestAudioStemsMatchMix(test *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	apu.Init(func(int16) {})
+	filename := filepath.Join(dir, "out.pcm")
+
+	// As if a song was already playing
+	apu.HipassStrong = 5000 << 32
+	apu.HipassWeak = -3000 << 32
+
+	if err := StartAudioRecording(filename, true); err != nil {
+		test.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		apu.Square1.Sample = int16(i % 16)
+		apu.Square2.Sample = int16((i / 3) % 16)
+		apu.Triangle.Sample = int16((i / 5) % 16)
+		apu.Noise.Sample = int16((i / 7) % 16)
+		apu.PushSample()
+	}
+
+	if err := StopAudioRecording(); err != nil {
+		test.Fatal(err)
+	}
+
+	mix, err := ioutil.ReadFile(filename)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var stems [][]byte
+	for _, s := range AudioStems {
+		data, err := ioutil.ReadFile(AudioStemFilename(filename, s))
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		stems = append(stems, data)
+	}
+
+	// Allowing for each stem being rounded separately
+	for i := 0; i < len(mix); i += 2 {
+		sum := 0
+		for _, s := range stems {
+			sum += int(int16(binary.LittleEndian.Uint16(s[i:])))
+		}
+
+		m := int(int16(binary.LittleEndian.Uint16(mix[i:])))
+		if d := sum - m; d > 2*len(stems) || d < -2*len(stems) {
+			test.Fatalf("Stems added up to %d at sample %d, the mix was %d", sum, i/2, m)
+		}
+	}
+}
@@ -5,59 +5,117 @@ import (
 	"fmt"
 )
 
-type Mapper interface {
-	Write(v Word, a int)
-	Read(a int) Word
-	WriteVram(v Word, a int)
-	ReadVram(a int) Word
-	ReadTile(a int) []Word
-	BatteryBacked() bool
-}
+// Header of the currently loaded ROM
+var Header *RomHeader
 
 func LoadRom(rom []byte) (m Mapper, e error) {
-	r := new(Nrom)
+	if IsUnif(rom) {
+		h, data, err := ParseUnif(rom)
+		if err != nil {
+			return m, err
+		}
+
+		return loadCartridge(h, data)
+	}
 
-	if string(rom[0:3]) != "NES" {
-		return m, errors.New("Invalid ROM file")
+	h, err := ParseRomHeader(rom)
+	if err != nil {
+		return m, err
+	}
+
+	// The trainer sits between the header and PRG-ROM, and
+	// gets loaded into $7000-$71FF
+	if h.Trainer {
+		if len(rom) < RomHeaderSize+TrainerSize {
+			return m, errors.New(fmt.Sprintf("ROM file is truncated: %d bytes is too short for the 512 byte trainer", len(rom)))
+		}
 
-		if rom[3] != 0x1a {
-			return m, errors.New("Invalid ROM file")
+		for i, v := range rom[RomHeaderSize : RomHeaderSize+TrainerSize] {
+			Ram[0x7000+i] = Word(v)
 		}
+
+		return loadCartridge(h, rom[RomHeaderSize+TrainerSize:])
 	}
 
-	r.PrgBankCount = int(rom[4])
-	r.ChrRomCount = int(rom[5])
+	return loadCartridge(h, rom[RomHeaderSize:])
+}
+
+// Sets up the mapper for PRG-ROM followed by CHR-ROM,
+// as described by the header
+func loadCartridge(h *RomHeader, data []byte) (m Mapper, e error) {
+	Header = h
+
+	r := new(Nrom)
+	r.Header = h
+	r.Data = data
 
 	fmt.Printf("-----------------\nROM:\n  ")
 
+	if h.PrgRomSize == 0 {
+		return m, errors.New("Invalid ROM file: the header declares no PRG-ROM")
+	}
+
+	if len(r.Data) < h.PrgRomSize+h.ChrRomSize {
+		return m, errors.New(fmt.Sprintf("ROM file is truncated: the header declares %d bytes of PRG-ROM and %d bytes of CHR-ROM, but only %d bytes follow it",
+			h.PrgRomSize, h.ChrRomSize, len(r.Data)))
+	}
+
+	// Anything past the CHR-ROM, like a title some dumps have
+	// tacked on the end, is left out of the checksums
+	h.Crc32, h.Sha1 = RomChecksums(r.Data[:h.PrgRomSize+h.ChrRomSize])
+	fmt.Printf("CRC32: %08X SHA-1: %s\n  ", h.Crc32, h.Sha1)
+
+	if RomDatabaseEnabled {
+		if e := LookupRom(h.Crc32, h.Sha1); e != nil {
+			h.ApplyDatabase(e)
+		}
+	}
+
+	// Sizes that aren't a multiple of the bank size get rounded up
+	r.PrgBankCount = (h.PrgRomSize + 0x3FFF) / 0x4000
+	r.ChrRomCount = (h.ChrRomSize + 0x1FFF) / 0x2000
+
+	if h.PrgRomSize%0x4000 != 0 || h.ChrRomSize%0x2000 != 0 {
+		data := make([]byte, (r.PrgBankCount*0x4000)+(r.ChrRomCount*0x2000))
+		copy(data, r.Data[:h.PrgRomSize])
+		copy(data[r.PrgBankCount*0x4000:], r.Data[h.PrgRomSize:h.PrgRomSize+h.ChrRomSize])
+
+		r.Data = data
+	}
+
+	chrRom := r.Data[r.PrgBankCount*0x4000 : r.PrgBankCount*0x4000+r.ChrRomCount*0x2000]
+	r.Chr = NewChrMemory(chrRom, h.ChrRamSize+h.ChrNvramSize)
+
+	fmt.Printf("Format: %s\n  ", h)
 	fmt.Printf("PRG-ROM banks: %d (%d real)\n  ", r.PrgBankCount, r.PrgBankCount)
 	fmt.Printf("CHR-ROM banks: %d (%d real)\n  ", 2*r.ChrRomCount, r.ChrRomCount)
+	fmt.Printf("PRG-RAM: %dk (%dk battery)\n  ", h.PrgRamSize/1024, h.PrgNvramSize/1024)
+	fmt.Printf("CHR-RAM: %dk (%dk battery)\n  ", h.ChrRamSize/1024, h.ChrNvramSize/1024)
+
+	if h.IgnoredMapperMsb {
+		fmt.Printf("Ignoring bytes 7-15 of a polluted header\n  ")
+	}
 
 	fmt.Printf("Mirroring: ")
-	switch rom[6] & 0x1 {
-	case 0x0:
+	switch {
+	case h.FourScreen:
+		fmt.Printf("Four-screen\n  ")
+	case h.Mirroring == MirroringHorizontal:
 		fmt.Printf("Horizontal\n  ")
-		ppu.Nametables.SetMirroring(MirroringHorizontal)
-	case 0x1:
+	case h.Mirroring == MirroringVertical:
 		fmt.Printf("Vertical\n  ")
-		ppu.Nametables.SetMirroring(MirroringVertical)
 	}
 
-	if (rom[6]>>0x1)&0x1 == 0x1 {
-		r.Battery = true
-	}
+	ppu.Nametables.FourScreen = h.FourScreen
+	ppu.Nametables.SetMirroring(h.Mirroring)
 
-	r.Data = rom[16:]
+	r.Battery = h.Battery
 
 	// Check mapper, get the proper type
-	mapper := (Word(rom[6])>>4 | (Word(rom[7]) & 0xF0))
+	mapper := h.Mapper
 	fmt.Printf("Mapper: 0x%X -> ", mapper)
 	switch mapper {
 	case 0x00:
-		fallthrough
-	case 0x40:
-		fallthrough
-	case 0x41:
 		// NROM
 		fmt.Printf("NROM\n")
 		r.Load()
@@ -67,8 +125,6 @@ func LoadRom(rom []byte) (m Mapper, e error) {
 		fmt.Printf("MMC1\n")
 		r.Load()
 		m = NewMmc1(r)
-	case 0x42:
-		fallthrough
 	case 0x02:
 		// Unrom
 		fmt.Printf("UNROM\n")
@@ -80,9 +136,9 @@ func LoadRom(rom []byte) (m Mapper, e error) {
 			ChrRomCount:  r.ChrRomCount,
 			Battery:      r.Battery,
 			Data:         r.Data,
+			Chr:          r.Chr,
+			BusConflicts: h.Submapper == SubmapperBusConflicts,
 		}
-	case 0x43:
-		fallthrough
 	case 0x03:
 		// Cnrom
 		fmt.Printf("CNROM\n")
@@ -94,6 +150,8 @@ func LoadRom(rom []byte) (m Mapper, e error) {
 			ChrRomCount:  r.ChrRomCount,
 			Battery:      r.Battery,
 			Data:         r.Data,
+			Chr:          r.Chr,
+			BusConflicts: h.Submapper == SubmapperBusConflicts,
 		}
 	case 0x07:
 		// Anrom
@@ -106,14 +164,65 @@ func LoadRom(rom []byte) (m Mapper, e error) {
 			ChrRomCount:  r.ChrRomCount,
 			Battery:      r.Battery,
 			Data:         r.Data,
+			Chr:          r.Chr,
+			BusConflicts: h.Submapper == SubmapperBusConflicts,
 			PrgUpperBank: len(r.RomBanks) - 1,
 		}
-	case 0x44:
-		fallthrough
+	case 0x0A:
+		// MMC4
+		fmt.Printf("MMC4\n")
+		m = NewMmc4(r)
+	case 0x0B:
+		// Color Dreams
+		fmt.Printf("Color Dreams\n")
+		r.Load()
+		m = NewColorDreams(r)
+	case 0x15, 0x16, 0x17, 0x19:
+		// Konami VRC2/VRC4
+		fmt.Printf("VRC2/VRC4\n")
+		m = NewVrc4(r)
+	case 0x10, 0x99, 0x9D, 0x9F:
+		// Bandai FCG/LZ93D50
+		fmt.Printf("Bandai FCG\n")
+		r.Load()
+		m = NewBandai(r)
+	case 0x22:
+		// BNROM or NINA-001
+		fmt.Printf("BNROM/NINA-001\n")
+		r.Load()
+		m = NewBnrom(r)
+	case 0x42:
+		// GxROM
+		fmt.Printf("GxROM\n")
+		r.Load()
+		m = NewGxrom(r)
+	case 0x47:
+		// Camerica/Codemasters
+		fmt.Printf("Camerica\n")
+		r.Load()
+		m = NewCamerica(r)
+	case 0x4F:
+		// AVE NINA-03/06
+		fmt.Printf("AVE NINA\n")
+		r.Load()
+		m = NewAveNina(r)
+	case 0x8C:
+		// Jaleco JF-11/14
+		fmt.Printf("Jaleco JF-11\n")
+		r.Load()
+		m = NewJalecoJf11(r)
 	case 0x04:
 		// MMC3
 		fmt.Printf("MMC3\n")
 		m = NewMmc3(r)
+	case 0x76:
+		// TxSROM
+		fmt.Printf("TxSROM\n")
+		m = NewMmc3(r)
+	case 0x77:
+		// TQROM
+		fmt.Printf("TQROM\n")
+		m = NewMmc3(r)
 	case 0x05:
 		// MMC5
 		fmt.Printf("MMC5\n")
@@ -122,6 +231,18 @@ func LoadRom(rom []byte) (m Mapper, e error) {
 		// MMC2
 		fmt.Printf("MMC2\n")
 		m = NewMmc2(r)
+	case 0x13:
+		// Namco 129/163
+		fmt.Printf("Namco 163\n")
+		m = NewNamco163(r)
+	case 0x45:
+		// Sunsoft FME-7
+		fmt.Printf("FME-7\n")
+		m = NewFme7(r)
+	case 0x55:
+		// Konami VRC7
+		fmt.Printf("VRC7\n")
+		m = NewVrc7(r)
 	default:
 		// Unsupported
 		fmt.Printf("Unsupported\n")
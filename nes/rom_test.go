@@ -0,0 +1,181 @@
+package nes
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func testRom(prg, chr int, flags6 byte) []byte {
+	rom := make([]byte, RomHeaderSize, RomHeaderSize+(prg*0x4000)+(chr*0x2000))
+	copy(rom, "NES\x1a")
+	rom[4] = byte(prg)
+	rom[5] = byte(chr)
+	rom[6] = flags6
+
+	return append(rom, make([]byte, (prg*0x4000)+(chr*0x2000))...)
+}
+
+// An NES 2.0 image for the mapper, where each 16k PRG bank
+// starts with its number and is otherwise $FF, and each 4k
+// CHR bank starts with its number
+func testMapperRom(mapper, submapper, prg, chr int) []byte {
+	rom := testRom(prg, chr, byte(mapper&0xF)<<4)
+	rom[7] = byte(mapper&0xF0) | 0x08
+	rom[8] = byte(submapper<<4 | mapper>>8)
+
+	for i := 0; i < prg*0x4000; i++ {
+		if i%0x4000 == 0 {
+			rom[RomHeaderSize+i] = byte(i / 0x4000)
+		} else {
+			rom[RomHeaderSize+i] = 0xFF
+		}
+	}
+
+	for i := 0; i < chr*2; i++ {
+		rom[RomHeaderSize+prg*0x4000+i*0x1000] = byte(i)
+	}
+
+	return rom
+}
+
+func loadMapperRom(test *testing.T, mapper, submapper, prg, chr int) Mapper {
+	initRomTest()
+
+	m, err := LoadRom(testMapperRom(mapper, submapper, prg, chr))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rom = m
+
+	return m
+}
+
+// Checks the 16k PRG bank at a, which has to be the
+// start of the bank
+func verifyPrgBank(a uint16, bank Word, test *testing.T) {
+	if v, _ := Ram.Read(a); v != bank {
+		test.Errorf("PRG bank at 0x%X was %d, expected %d", a, v, bank)
+	}
+}
+
+// Checks the 4k CHR bank at a
+func verifyChrBank(a int, bank Word, test *testing.T) {
+	if v := rom.ReadVram(a); v != bank {
+		test.Errorf("CHR bank at 0x%X was %d, expected %d", a, v, bank)
+	}
+}
+
+func initRomTest() {
+	Ram = NewMemory()
+	ppu.Init()
+	apu.Init(func(int16) {})
+}
+
+func TestTruncatedRom(test *testing.T) {
+	initRomTest()
+
+	rom := testRom(2, 1, 0)
+
+	_, err := LoadRom(rom[:len(rom)-1])
+	if err == nil || !strings.Contains(err.Error(), "truncated") {
+		test.Errorf("Truncated ROM returned %v", err)
+	}
+
+	if _, err := LoadRom(rom[:RomHeaderSize-1]); err == nil {
+		test.Errorf("Truncated header should fail")
+	}
+
+	bad := testRom(1, 0, 0)
+	bad[3] = 0
+	if _, err := LoadRom(bad); err == nil {
+		test.Errorf("Missing $1A should fail")
+	}
+
+	if _, err := LoadRom(testRom(0, 1, 0)); err == nil {
+		test.Errorf("ROM without PRG-ROM should fail")
+	}
+}
+
+func TestTrainer(test *testing.T) {
+	initRomTest()
+
+	rom := testRom(1, 1, 0x4)
+
+	// Trainer, then the first byte of PRG-ROM
+	trainer := make([]byte, TrainerSize)
+	trainer[0] = 0xAA
+	trainer[TrainerSize-1] = 0xBB
+	rom = append(rom[:RomHeaderSize], append(trainer, rom[RomHeaderSize:]...)...)
+	rom[RomHeaderSize+TrainerSize] = 0xCC
+
+	m, err := LoadRom(rom)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if Ram[0x7000] != 0xAA || Ram[0x71FF] != 0xBB {
+		test.Errorf("Trainer was not loaded at $7000")
+	}
+
+	if v := m.Read(0x8000); v != 0xCC {
+		test.Errorf("0x8000 was 0x%X, expected 0xCC", v)
+	}
+
+	if _, err := LoadRom(rom[:RomHeaderSize+0x100]); err == nil {
+		test.Errorf("Truncated trainer should fail")
+	}
+}
+
+func TestFourScreen(test *testing.T) {
+	initRomTest()
+
+	// MMC3, as on Rad Racer II
+	m, err := LoadRom(testRom(2, 2, 0x48))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	rom = m
+
+	// The mirroring register is ignored
+	Ram.Write(0xA000, 0x01)
+
+	n := &ppu.Nametables
+	for i := 0; i < 4; i++ {
+		n.writeNametableData(0x2000+i*0x400, Word(i+1))
+	}
+
+	for i := 0; i < 4; i++ {
+		if v := n.readNametableData(0x2000 + i*0x400); v != Word(i+1) {
+			test.Errorf("Nametable %d was %d, expected %d", i, v, i+1)
+		}
+	}
+
+	if n.CartridgeRam1[0] != 4 {
+		test.Error("Fourth nametable wasn't in cartridge RAM")
+	}
+}
+
+func FuzzLoadRom(f *testing.F) {
+	for _, name := range []string{"nestest.nes", "scrolltest_scroll.nes", mmc3AltRom[len("../test_roms/"):]} {
+		rom, err := ioutil.ReadFile("../test_roms/" + name)
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(rom)
+	}
+
+	f.Add(testRom(1, 0, 0x4))
+	f.Add(testRom(2, 0, 0x10))
+	f.Add(testUnif("NES-CNROM", unifChunk("PRG0", make([]byte, 0x4000)), unifChunk("CHR0", make([]byte, 0x2000))))
+
+	f.Fuzz(func(test *testing.T, rom []byte) {
+		initRomTest()
+
+		// Anything is allowed except panicking
+		LoadRom(rom)
+	})
+}
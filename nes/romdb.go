@@ -0,0 +1,292 @@
+package nes
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Set to false to trust the header over the database
+	RomDatabaseEnabled = true
+
+	romDatabaseIndex map[uint32]*RomDatabaseEntry
+)
+
+// Known good header values for a ROM, keyed by the CRC32 of
+// its PRG and CHR data. If Sha1 is set it has to match too.
+type RomDatabaseEntry struct {
+	Crc32 uint32
+	Sha1  string
+	Name  string
+
+	Mapper       int
+	Submapper    int
+	Mirroring    int
+	FourScreen   bool
+	Battery      bool
+	Timing       int
+	PrgRamSize   int
+	PrgNvramSize int
+	ChrRamSize   int
+}
+
+// Built in entries for the test ROMs. Games are added from a
+// NES 2.0 XML database with LoadRomDatabase.
+var RomDatabase = []RomDatabaseEntry{
+	{
+		Crc32: 0x158B0388, Sha1: "4131307f0f69f2a5c54b7d438328c5b2a5ed0820",
+		Name:   "nestest",
+		Mapper: 0, Mirroring: MirroringHorizontal, PrgRamSize: 0x2000,
+	},
+	{
+		Crc32: 0xCD4B36B9, Sha1: "63638bed70c8ef575d27904cdcd2bdc887461c3f",
+		Name:   "NEStress",
+		Mapper: 0, Mirroring: MirroringVertical, PrgRamSize: 0x2000,
+	},
+	{
+		Crc32: 0x73A181CE, Sha1: "605928f598fd8ab344bb0d649b8c3768f3a9738e",
+		Name:   "Scroll test",
+		Mapper: 1, Mirroring: MirroringHorizontal, PrgRamSize: 0x2000, ChrRamSize: 0x2000,
+	},
+	{
+		Crc32: 0xC64EC880, Sha1: "60edb5c4ab3ae8449720c5fe3778fd2858215bfb",
+		Name:   "blargg's CPU tests: all instructions",
+		Mapper: 1, Mirroring: MirroringHorizontal, PrgRamSize: 0x2000, ChrRamSize: 0x2000,
+	},
+	{
+		Crc32: 0xA7013B44, Sha1: "fcfe51d891f895392872266ef34cd263a6eba761",
+		Name:   "blargg's APU tests",
+		Mapper: 1, Mirroring: MirroringVertical, PrgRamSize: 0x2000, ChrRamSize: 0x2000,
+	},
+	{
+		Crc32: 0xEEA20263, Sha1: "78fddae9006193617f1054fd007d0185e4e22544",
+		Name:   "blargg's PPU VBL/NMI tests",
+		Mapper: 1, Mirroring: MirroringVertical, PrgRamSize: 0x2000, ChrRamSize: 0x2000,
+	},
+	{
+		Crc32: 0x8031DAAD, Sha1: "5a942a78ae04e93a22861b48e1c81dc568a03fea",
+		Name:   "MMC3 test: clocking",
+		Mapper: 4, Mirroring: MirroringVertical, PrgRamSize: 0x2000,
+	},
+	{
+		Crc32: 0xBCEFE65B, Sha1: "f86c9c54d361074b4bc7bb1ec778f4056c02d943",
+		Name:   "MMC3 test: details",
+		Mapper: 4, Mirroring: MirroringVertical, PrgRamSize: 0x2000,
+	},
+	{
+		Crc32: 0x57ECF527, Sha1: "400109b056c76314739d0ae8cc047163ef85047d",
+		Name:   "MMC3 test: A12 clocking",
+		Mapper: 4, Mirroring: MirroringVertical, PrgRamSize: 0x2000,
+	},
+	{
+		Crc32: 0x8AD8A602, Sha1: "1632ebace972e2d462e45f50dfc57019a4e14463",
+		Name:   "MMC3 test: scanline timing",
+		Mapper: 4, Mirroring: MirroringVertical, PrgRamSize: 0x2000,
+	},
+	{
+		Crc32: 0x7EF527B5, Sha1: "b4869de4fdac0f0f86b6936d47692bda81d59205",
+		Name:   "MMC3 test: MMC3",
+		Mapper: 4, Mirroring: MirroringVertical, PrgRamSize: 0x2000,
+	},
+	{
+		// Tests the IRQ behaviour of the older MMC3A and NEC chips
+		Crc32: 0x633AFE6F, Sha1: "2f29f3dc724027fad926bc9d4470a481884e42a5",
+		Name:   "MMC3 test: MMC3 alt",
+		Mapper: 4, Submapper: 4, Mirroring: MirroringVertical, PrgRamSize: 0x2000,
+	},
+	{
+		// NROM-256 without work RAM, which iNES headers can't say
+		Crc32:  0x3337EC46,
+		Name:   "Super Mario Bros.",
+		Mapper: 0, Mirroring: MirroringVertical,
+	},
+}
+
+func RomChecksums(data []byte) (uint32, string) {
+	sum := sha1.New()
+	sum.Write(data)
+
+	return crc32.ChecksumIEEE(data), hex.EncodeToString(sum.Sum(nil))
+}
+
+// A game in the NES 2.0 XML database, nes20db.xml. The rom
+// element has the checksums of the PRG and CHR-ROM together.
+type nes20dbGame struct {
+	Rom struct {
+		Crc32 string `xml:"crc32,attr"`
+		Sha1  string `xml:"sha1,attr"`
+	} `xml:"rom"`
+	Pcb struct {
+		Mapper    int    `xml:"mapper,attr"`
+		Submapper int    `xml:"submapper,attr"`
+		Mirroring string `xml:"mirroring,attr"`
+		Battery   int    `xml:"battery,attr"`
+	} `xml:"pcb"`
+	// Uses the same values as NES 2.0 timing
+	Console struct {
+		Region int `xml:"region,attr"`
+	} `xml:"console"`
+
+	PrgRam   nes20dbRam `xml:"prgram"`
+	PrgNvram nes20dbRam `xml:"prgnvram"`
+	ChrRam   nes20dbRam `xml:"chrram"`
+	ChrNvram nes20dbRam `xml:"chrnvram"`
+}
+
+type nes20dbRam struct {
+	Size int `xml:"size,attr"`
+}
+
+func (g *nes20dbGame) entry(name string) (e RomDatabaseEntry, err error) {
+	crc, err := strconv.ParseUint(g.Rom.Crc32, 16, 32)
+	if err != nil {
+		return e, errors.New(fmt.Sprintf("Invalid CRC32 %q for %s", g.Rom.Crc32, name))
+	}
+
+	e = RomDatabaseEntry{
+		Crc32:        uint32(crc),
+		Sha1:         strings.ToLower(g.Rom.Sha1),
+		Name:         name,
+		Mapper:       g.Pcb.Mapper,
+		Submapper:    g.Pcb.Submapper,
+		Mirroring:    MirroringHorizontal,
+		Battery:      g.Pcb.Battery != 0,
+		Timing:       g.Console.Region,
+		PrgRamSize:   g.PrgRam.Size,
+		PrgNvramSize: g.PrgNvram.Size,
+		// Battery backed CHR-RAM is rare enough to be
+		// treated as plain CHR-RAM
+		ChrRamSize: g.ChrRam.Size + g.ChrNvram.Size,
+	}
+
+	switch g.Pcb.Mirroring {
+	case "V":
+		e.Mirroring = MirroringVertical
+	case "4":
+		e.FourScreen = true
+	}
+
+	if e.Timing < TimingNtsc || e.Timing > TimingDendy {
+		return e, errors.New(fmt.Sprintf("Invalid region %d for %s", e.Timing, name))
+	}
+
+	return e, nil
+}
+
+// Adds the games in a NES 2.0 XML database to RomDatabase,
+// taking precedence over the built in entries. Each game is
+// named after the file in the comment before it.
+func LoadRomDatabase(r io.Reader) error {
+	d := xml.NewDecoder(r)
+	name := ""
+
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch t := t.(type) {
+		case xml.Comment:
+			name = RomName(strings.Replace(strings.TrimSpace(string(t)), "\\", "/", -1))
+		case xml.StartElement:
+			if t.Name.Local != "game" {
+				continue
+			}
+
+			var g nes20dbGame
+			if err := d.DecodeElement(&g, &t); err != nil {
+				return err
+			}
+
+			e, err := g.entry(name)
+			if err != nil {
+				return err
+			}
+
+			RomDatabase = append(RomDatabase, e)
+		}
+	}
+
+	// Rebuilt on the next lookup
+	romDatabaseIndex = nil
+
+	return nil
+}
+
+func LoadRomDatabaseFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Printf("Loading game database %s\n", filename)
+
+	return LoadRomDatabase(f)
+}
+
+func LookupRom(crc uint32, sha string) *RomDatabaseEntry {
+	if romDatabaseIndex == nil {
+		romDatabaseIndex = map[uint32]*RomDatabaseEntry{}
+
+		for i := range RomDatabase {
+			romDatabaseIndex[RomDatabase[i].Crc32] = &RomDatabase[i]
+		}
+	}
+
+	e, ok := romDatabaseIndex[crc]
+	if !ok || (e.Sha1 != "" && e.Sha1 != sha) {
+		return nil
+	}
+
+	return e
+}
+
+// Replaces anything in the header that the database disagrees
+// with, logging each change
+func (h *RomHeader) ApplyDatabase(e *RomDatabaseEntry) {
+	fmt.Printf("Database: %s\n  ", e.Name)
+
+	override := func(field string, from, to interface{}) {
+		if from != to {
+			fmt.Printf("Database: %s %v -> %v\n  ", field, from, to)
+		}
+	}
+
+	override("mapper", h.Mapper, e.Mapper)
+	override("submapper", h.Submapper, e.Submapper)
+	override("mirroring", h.Mirroring, e.Mirroring)
+	override("four-screen", h.FourScreen, e.FourScreen)
+	override("battery", h.Battery, e.Battery)
+	override("timing", TimingNames[h.Timing], TimingNames[e.Timing])
+	override("PRG-RAM", h.PrgRamSize, e.PrgRamSize)
+	override("PRG-NVRAM", h.PrgNvramSize, e.PrgNvramSize)
+
+	h.Mapper = e.Mapper
+	h.Submapper = e.Submapper
+	h.Mirroring = e.Mirroring
+	h.FourScreen = e.FourScreen
+	h.Battery = e.Battery
+	h.Timing = e.Timing
+	h.PrgRamSize = e.PrgRamSize
+	h.PrgNvramSize = e.PrgNvramSize
+
+	// Only meaningful for boards without CHR-ROM
+	if h.ChrRomSize == 0 {
+		override("CHR-RAM", h.ChrRamSize, e.ChrRamSize)
+		h.ChrRamSize = e.ChrRamSize
+	}
+
+	h.IgnoredMapperMsb = false
+}
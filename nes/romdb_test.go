@@ -0,0 +1,133 @@
+package nes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const mmc3AltRom = "../test_roms/mmc3_test_2/rom_singles/6-MMC3_alt.nes"
+
+func TestRomDatabaseOverride(test *testing.T) {
+	contents, err := ioutil.ReadFile(mmc3AltRom)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := LoadRom(contents); err != nil {
+		test.Fatal(err)
+	}
+
+	if Header.Crc32 != 0x633AFE6F {
+		test.Errorf("CRC32 was %08X, expected 633AFE6F", Header.Crc32)
+	}
+
+	// The iNES header can't say which MMC3 revision it is
+	if Header.Mapper != 4 || Header.Submapper != 4 {
+		test.Errorf("Mapper was %d.%d, expected 4.4", Header.Mapper, Header.Submapper)
+	}
+
+	RomDatabaseEnabled = false
+	defer func() { RomDatabaseEnabled = true }()
+
+	if _, err := LoadRom(contents); err != nil {
+		test.Fatal(err)
+	}
+
+	if Header.Submapper != 0 {
+		test.Errorf("Submapper was %d with the database disabled, expected 0", Header.Submapper)
+	}
+}
+
+func TestRomDatabaseSha1Mismatch(test *testing.T) {
+	crc, sha := RomChecksums([]byte("not a ROM"))
+
+	if LookupRom(crc, sha) != nil {
+		test.Errorf("Unknown ROM was found in the database")
+	}
+
+	if LookupRom(0x633AFE6F, sha) != nil {
+		test.Errorf("ROM with a matching CRC32 but different SHA-1 was found")
+	}
+
+	if e := LookupRom(0x633AFE6F, "2f29f3dc724027fad926bc9d4470a481884e42a5"); e == nil || e.Submapper != 4 {
+		test.Errorf("MMC3 alt test was not found")
+	}
+}
+
+func TestRomDatabaseTrailingData(test *testing.T) {
+	contents, err := ioutil.ReadFile(mmc3AltRom)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// Junk past the CHR-ROM isn't part of the checksum
+	contents = append(contents, []byte("trailing junk")...)
+
+	if _, err := LoadRom(contents); err != nil {
+		test.Fatal(err)
+	}
+
+	if Header.Crc32 != 0x633AFE6F {
+		test.Errorf("CRC32 was %08X with trailing data, expected 633AFE6F", Header.Crc32)
+	}
+
+	if Header.Submapper != 4 {
+		test.Errorf("Submapper was %d with trailing data, expected 4", Header.Submapper)
+	}
+}
+
+func TestRomDatabaseXml(test *testing.T) {
+	defer func(db []RomDatabaseEntry) {
+		RomDatabase = db
+		romDatabaseIndex = nil
+	}(RomDatabase)
+
+	// An MMC1 board with a bad iNES header
+	contents := testMapperRom(0, 0, 2, 1)
+	contents[7] = 0x00
+	crc, sha := RomChecksums(contents[RomHeaderSize:])
+
+	db := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<nes20db>
+<!-- \NES\Licensed\Test Game (USA).nes -->
+<game>
+	<prgrom size="32768" crc32="00000000"/>
+	<chrrom size="8192" crc32="00000000"/>
+	<rom size="40960" crc32="%08X" sha1="%s"/>
+	<prgnvram size="8192"/>
+	<pcb mapper="1" submapper="5" mirroring="V" battery="1"/>
+	<console type="0" region="1"/>
+</game>
+</nes20db>`, crc, strings.ToUpper(sha))
+
+	if err := LoadRomDatabase(strings.NewReader(db)); err != nil {
+		test.Fatal(err)
+	}
+
+	initRomTest()
+	if _, err := LoadRom(contents); err != nil {
+		test.Fatal(err)
+	}
+
+	if Header.Mapper != 1 || Header.Submapper != 5 {
+		test.Errorf("Mapper was %d.%d, expected 1.5", Header.Mapper, Header.Submapper)
+	}
+
+	if Header.Mirroring != MirroringVertical || !Header.Battery || Header.Timing != TimingPal {
+		test.Error("Mirroring, battery or timing weren't taken from the database")
+	}
+
+	if Header.PrgRamSize != 0 || Header.PrgNvramSize != 0x2000 {
+		test.Errorf("PRG-RAM was %d and %d battery backed, expected 0 and 8192", Header.PrgRamSize, Header.PrgNvramSize)
+	}
+
+	if e := LookupRom(crc, sha); e == nil || e.Name != "Test Game (USA)" {
+		test.Error("Game wasn't named after the file in its comment")
+	}
+
+	if err := LoadRomDatabase(strings.NewReader(`<game><rom crc32="XYZ"/></game>`)); err == nil {
+		test.Error("Invalid CRC32 should fail to load")
+	}
+}
@@ -0,0 +1,84 @@
+package nes
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"sync/atomic"
+)
+
+var (
+	// Each pixel is scaled up to a square of this size
+	ScreenshotScale = 1
+
+	// Takes a screenshot when this frame is reached, if set
+	ScreenshotFrame = -1
+
+	// Set by the UI and cleared by the PPU once it's taken
+	screenshotRequested int32
+)
+
+// The screenshot is taken once the current frame is complete
+func TakeScreenshot() {
+	atomic.StoreInt32(&screenshotRequested, 1)
+}
+
+func ToggleOverscan() {
+	ppu.OverscanEnabled = !ppu.OverscanEnabled
+}
+
+func ScreenshotFilename() string {
+	return fmt.Sprintf("%s-%d.png", GameName, ppu.FrameCount)
+}
+
+// Uses the cropped 240x224 output with overscan enabled,
+// and the full 256x240 picture without it
+func (p *Ppu) Screenshot() *image.RGBA {
+	if p.OverscanEnabled {
+		return scaleImage(frameImage(p.Framebuffer, VideoWidth, VideoHeight), ScreenshotScale)
+	}
+
+	frame := make([]uint32, len(p.Palettebuffer))
+	for i, px := range p.Palettebuffer {
+		frame[i] = px.Color << 8
+	}
+
+	return scaleImage(frameImage(frame, 256, 240), ScreenshotScale)
+}
+
+func scaleImage(img *image.RGBA, scale int) *image.RGBA {
+	if scale <= 1 {
+		return img
+	}
+
+	b := img.Bounds()
+	scaled := image.NewRGBA(image.Rect(0, 0, b.Dx()*scale, b.Dy()*scale))
+
+	for y := 0; y < b.Dy()*scale; y++ {
+		for x := 0; x < b.Dx()*scale; x++ {
+			src := img.PixOffset(x/scale, y/scale)
+			copy(scaled.Pix[scaled.PixOffset(x, y):], img.Pix[src:src+4])
+		}
+	}
+
+	return scaled
+}
+
+func (p *Ppu) saveScreenshot() {
+	filename := ScreenshotFilename()
+
+	f, err := os.Create(filename)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, p.Screenshot()); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	fmt.Println("Screenshot saved to", filename)
+}
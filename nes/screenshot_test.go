@@ -0,0 +1,38 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestScreenshot(test *testing.T) {
+	ppu.Init()
+	copy(ppu.Framebuffer, testFrame())
+	ppu.Palettebuffer[0].Color = PaletteRgb[0x30]
+
+	ScreenshotScale = 2
+	defer func() { ScreenshotScale = 1 }()
+
+	img := ppu.Screenshot()
+	if b := img.Bounds(); b.Dx() != 480 || b.Dy() != 448 {
+		test.Errorf("Screenshot was %dx%d, expected 480x448", b.Dx(), b.Dy())
+	}
+
+	// Pixel 1 is scaled up to (2, 0)-(3, 1)
+	r, g, b, _ := img.At(3, 1).RGBA()
+	if c := uint32(r>>8)<<16 | uint32(g>>8)<<8 | uint32(b>>8); c != PaletteRgb[1] {
+		test.Errorf("Pixel (3, 1) was 0x%06X, expected 0x%06X", c, PaletteRgb[1])
+	}
+
+	ToggleOverscan()
+	defer ToggleOverscan()
+
+	img = ppu.Screenshot()
+	if b := img.Bounds(); b.Dx() != 512 || b.Dy() != 480 {
+		test.Errorf("Screenshot was %dx%d, expected 512x480", b.Dx(), b.Dy())
+	}
+
+	r, g, b, _ = img.At(1, 1).RGBA()
+	if c := uint32(r>>8)<<16 | uint32(g>>8)<<8 | uint32(b>>8); c != PaletteRgb[0x30] {
+		test.Errorf("Pixel (1, 1) was 0x%06X, expected 0x%06X", c, PaletteRgb[0x30])
+	}
+}
@@ -0,0 +1,270 @@
+package nes
+
+import (
+	"math"
+)
+
+const (
+	Sunsoft5bVolume = 0.15
+)
+
+var (
+	// The 5B uses a logarithmic DAC in 1.5dB steps. Channel volumes
+	// are 4 bits and use every other step, the envelope uses all 32
+	Sunsoft5bVolumeTable [32]float64
+)
+
+func init() {
+	for i := 1; i < len(Sunsoft5bVolumeTable); i++ {
+		db := float64(31-i) * -1.5
+		Sunsoft5bVolumeTable[i] = math.Pow(10, db/20)
+	}
+}
+
+type Sunsoft5bTone struct {
+	Period       int
+	Counter      int
+	Output       bool
+	Volume       Word
+	UseEnvelope  bool
+	ToneDisabled bool
+	NoiseDisable bool
+}
+
+type Sunsoft5bEnvelope struct {
+	Period    int
+	Counter   int
+	Step      int
+	Continue  bool
+	Attack    bool
+	Alternate bool
+	Hold      bool
+	Holding   bool
+	HoldLevel int
+}
+
+type Sunsoft5bNoise struct {
+	Period  int
+	Counter int
+	Shift   int
+	Divider bool
+}
+
+type Sunsoft5b struct {
+	Channels [3]Sunsoft5bTone
+	Envelope Sunsoft5bEnvelope
+	Noise    Sunsoft5bNoise
+
+	Register Word
+	Cycles   int
+
+	// Accumulated output since the last sample was pulled
+	OutputSum    float64
+	OutputCycles int
+}
+
+func NewSunsoft5b() *Sunsoft5b {
+	s := &Sunsoft5b{}
+	s.Noise.Shift = 1
+
+	return s
+}
+
+// $C000
+func (s *Sunsoft5b) SelectRegister(v Word) {
+	s.Register = v & 0xF
+}
+
+// $E000
+func (s *Sunsoft5b) WriteRegister(v Word) {
+	logAy8910Write(s.Register, v)
+
+	switch s.Register {
+	case 0x0, 0x2, 0x4:
+		// Channel period low
+		c := &s.Channels[s.Register>>1]
+		c.Period = (c.Period & 0xF00) | int(v)
+	case 0x1, 0x3, 0x5:
+		// Channel period high
+		c := &s.Channels[s.Register>>1]
+		c.Period = (c.Period & 0xFF) | (int(v&0xF) << 8)
+	case 0x6:
+		s.Noise.Period = int(v & 0x1F)
+	case 0x7:
+		// 76543210
+		//   ||||||
+		//   |||+++- Tone disable for A, B and C
+		//   +++---- Noise disable for A, B and C
+		for i := range s.Channels {
+			s.Channels[i].ToneDisabled = (v>>uint(i))&0x1 == 0x1
+			s.Channels[i].NoiseDisable = (v>>uint(i+3))&0x1 == 0x1
+		}
+	case 0x8, 0x9, 0xA:
+		c := &s.Channels[s.Register-0x8]
+		c.Volume = v & 0xF
+		c.UseEnvelope = v&0x10 == 0x10
+	case 0xB:
+		s.Envelope.Period = (s.Envelope.Period & 0xFF00) | int(v)
+	case 0xC:
+		s.Envelope.Period = (s.Envelope.Period & 0xFF) | (int(v) << 8)
+	case 0xD:
+		s.Envelope.WriteShape(v)
+	}
+}
+
+func (e *Sunsoft5bEnvelope) WriteShape(v Word) {
+	// ---- CAAH
+	//      ||||
+	//      |||+- Hold
+	//      ||+-- Alternate
+	//      |+--- Attack
+	//      +---- Continue
+	e.Continue = v&0x8 == 0x8
+	e.Attack = v&0x4 == 0x4
+	e.Alternate = v&0x2 == 0x2
+	e.Hold = v&0x1 == 0x1
+
+	e.Counter = 0
+	e.Step = 0
+	e.Holding = false
+}
+
+func (e *Sunsoft5bEnvelope) Clock() {
+	e.Counter++
+
+	period := e.Period
+	if period == 0 {
+		period = 1
+	}
+
+	if e.Counter < period {
+		return
+	}
+
+	e.Counter = 0
+
+	if e.Holding {
+		return
+	}
+
+	e.Step++
+	if e.Step < 32 {
+		return
+	}
+
+	// End of a ramp
+	e.Step = 0
+
+	switch {
+	case !e.Continue:
+		e.Holding = true
+		e.HoldLevel = 0
+	case e.Hold:
+		if e.Alternate {
+			e.Attack = !e.Attack
+		}
+
+		e.Holding = true
+		if e.Attack {
+			e.HoldLevel = 31
+		} else {
+			e.HoldLevel = 0
+		}
+	case e.Alternate:
+		e.Attack = !e.Attack
+	}
+}
+
+func (e *Sunsoft5bEnvelope) Level() int {
+	switch {
+	case e.Holding:
+		return e.HoldLevel
+	case e.Attack:
+		return e.Step
+	}
+
+	return 31 - e.Step
+}
+
+func (c *Sunsoft5bTone) Clock() {
+	c.Counter++
+
+	if c.Counter >= c.Period {
+		c.Counter = 0
+		c.Output = !c.Output
+	}
+}
+
+func (n *Sunsoft5bNoise) Clock() {
+	// Noise runs at half the rate of the tone channels
+	n.Divider = !n.Divider
+	if !n.Divider {
+		return
+	}
+
+	n.Counter++
+
+	if n.Counter >= n.Period {
+		n.Counter = 0
+
+		// 17-bit LFSR
+		feedback := (n.Shift ^ (n.Shift >> 3)) & 0x1
+		n.Shift = (n.Shift >> 1) | (feedback << 16)
+	}
+}
+
+// Called once per CPU cycle
+func (s *Sunsoft5b) Clock() {
+	// The internal dividers run at 1/16th of the CPU clock
+	s.Cycles++
+	if s.Cycles == 16 {
+		s.Cycles = 0
+
+		for i := range s.Channels {
+			s.Channels[i].Clock()
+		}
+
+		s.Noise.Clock()
+		s.Envelope.Clock()
+	}
+
+	s.OutputSum += s.mix()
+	s.OutputCycles++
+}
+
+func (s *Sunsoft5b) mix() float64 {
+	var out float64
+
+	noise := s.Noise.Shift&0x1 == 0x1
+
+	for _, c := range s.Channels {
+		if !(c.Output || c.ToneDisabled) || !(noise || c.NoiseDisable) {
+			continue
+		}
+
+		level := s.Envelope.Level()
+		if !c.UseEnvelope {
+			level = int(c.Volume) * 2
+			if level > 0 {
+				level++
+			}
+		}
+
+		out += Sunsoft5bVolumeTable[level]
+	}
+
+	return out
+}
+
+func (s *Sunsoft5b) Output() float64 {
+	if s.OutputCycles == 0 {
+		return 0
+	}
+
+	out := s.OutputSum / float64(s.OutputCycles)
+
+	s.OutputSum = 0
+	s.OutputCycles = 0
+
+	return out * Sunsoft5bVolume
+}
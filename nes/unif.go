@@ -0,0 +1,224 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+const (
+	UnifHeaderSize = 32
+)
+
+type UnifBoard struct {
+	Mapper    int
+	Submapper int
+}
+
+// Board names without their NES-/HVC-/UNL- style prefix,
+// and the mappers that implement them
+var UnifBoards = map[string]UnifBoard{
+	"NROM":     {0, 0},
+	"NROM-128": {0, 0},
+	"NROM-256": {0, 0},
+	"RROM":     {0, 0},
+
+	"SAROM":  {1, 0},
+	"SBROM":  {1, 0},
+	"SCROM":  {1, 0},
+	"SEROM":  {1, 0},
+	"SFROM":  {1, 0},
+	"SGROM":  {1, 0},
+	"SHROM":  {1, 0},
+	"SJROM":  {1, 0},
+	"SKROM":  {1, 0},
+	"SLROM":  {1, 0},
+	"SL1ROM": {1, 0},
+	"SNROM":  {1, 0},
+	"SOROM":  {1, 0},
+	"SUROM":  {1, 0},
+	"SXROM":  {1, 0},
+
+	"UNROM": {2, 0},
+	"UOROM": {2, 0},
+
+	"CNROM": {3, 0},
+
+	"TBROM":  {4, 0},
+	"TEROM":  {4, 0},
+	"TFROM":  {4, 0},
+	"TGROM":  {4, 0},
+	"TKROM":  {4, 0},
+	"TLROM":  {4, 0},
+	"TL1ROM": {4, 0},
+	"TR1ROM": {4, 0},
+	"TSROM":  {4, 0},
+	"TVROM":  {4, 0},
+
+	"HKROM": {4, 1},
+
+	"EKROM": {5, 0},
+	"ELROM": {5, 0},
+	"ETROM": {5, 0},
+	"EWROM": {5, 0},
+
+	"AMROM":  {7, 0},
+	"ANROM":  {7, 0},
+	"AN1ROM": {7, 0},
+	"AOROM":  {7, 0},
+
+	"PEEOROM": {9, 0},
+	"PNROM":   {9, 0},
+
+	"FJROM": {10, 0},
+	"FKROM": {10, 0},
+
+	"BNROM":    {34, 2},
+	"NINA-001": {34, 1},
+
+	"GNROM": {66, 0},
+	"MHROM": {66, 0},
+
+	"NINA-03": {79, 0},
+	"NINA-06": {79, 0},
+
+	"TKSROM": {118, 0},
+	"TLSROM": {118, 0},
+
+	"TQROM": {119, 0},
+
+	"JLROM": {69, 0},
+	"JSROM": {69, 0},
+	"BTR":   {69, 0},
+}
+
+func IsUnif(data []byte) bool {
+	return len(data) >= 4 && string(data[0:4]) == "UNIF"
+}
+
+func unifBoard(name string) (UnifBoard, bool) {
+	name = strings.ToUpper(name)
+
+	for _, prefix := range []string{"NES-", "HVC-", "UNL-", "BTL-", "BMC-", "IREM-", "KONAMI-", "SUNSOFT-", "AVE-"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+
+	b, ok := UnifBoards[name]
+	return b, ok
+}
+
+// UNIF files are a list of chunks after a 32 byte header. The PRG
+// and CHR chunks are joined up into the same layout as an iNES file.
+func ParseUnif(data []byte) (*RomHeader, []byte, error) {
+	if !IsUnif(data) || len(data) < UnifHeaderSize {
+		return nil, nil, errors.New("Invalid UNIF file")
+	}
+
+	h := &RomHeader{
+		Mirroring: MirroringHorizontal,
+	}
+
+	var prg, chr [16][]byte
+	var crcs [32]uint32
+	var hasCrc [32]bool
+
+	for p := UnifHeaderSize; p < len(data); {
+		if p+8 > len(data) {
+			return nil, nil, errors.New("UNIF file is truncated")
+		}
+
+		id := string(data[p : p+4])
+		size := int(binary.LittleEndian.Uint32(data[p+4:]))
+		p += 8
+
+		if size < 0 || size > len(data)-p {
+			return nil, nil, errors.New(fmt.Sprintf("UNIF file is truncated: %s chunk needs %d bytes", id, size))
+		}
+
+		chunk := data[p : p+size]
+		p += size
+
+		// PRG0-PRGF, CHR0-CHRF and their checksums PCK0-PCKF, CCK0-CCKF
+		bank := strings.Index("0123456789ABCDEF", id[3:])
+
+		switch {
+		case id == "MAPR":
+			if i := bytes.IndexByte(chunk, 0); i >= 0 {
+				chunk = chunk[:i]
+			}
+
+			h.Board = string(chunk)
+		case id == "MIRR" && size > 0:
+			switch chunk[0] {
+			case 0:
+				h.Mirroring = MirroringHorizontal
+			case 1:
+				h.Mirroring = MirroringVertical
+			case 2:
+				h.Mirroring = MirroringSingleLower
+			case 3:
+				h.Mirroring = MirroringSingleUpper
+			case 4:
+				h.FourScreen = true
+			}
+		case id == "BATR":
+			h.Battery = true
+		case id == "TVCI" && size > 0:
+			switch chunk[0] {
+			case 1:
+				h.Timing = TimingPal
+			case 2:
+				h.Timing = TimingMultiRegion
+			}
+		case id[:3] == "PRG" && bank >= 0:
+			prg[bank] = chunk
+		case id[:3] == "CHR" && bank >= 0:
+			chr[bank] = chunk
+		case id[:3] == "PCK" && bank >= 0 && size >= 4:
+			crcs[bank] = binary.LittleEndian.Uint32(chunk)
+			hasCrc[bank] = true
+		case id[:3] == "CCK" && bank >= 0 && size >= 4:
+			crcs[16+bank] = binary.LittleEndian.Uint32(chunk)
+			hasCrc[16+bank] = true
+		}
+	}
+
+	b, ok := unifBoard(h.Board)
+	if !ok {
+		return nil, nil, errors.New(fmt.Sprintf("Unsupported UNIF board: %s", h.Board))
+	}
+
+	h.Mapper = b.Mapper
+	h.Submapper = b.Submapper
+
+	var rom []byte
+	for i, chunk := range append(prg[:], chr[:]...) {
+		if hasCrc[i] && crc32.ChecksumIEEE(chunk) != crcs[i] {
+			fmt.Printf("UNIF: %s%X has CRC32 %08X, expected %08X\n",
+				[]string{"PRG", "CHR"}[i/16], i%16, crc32.ChecksumIEEE(chunk), crcs[i])
+		}
+
+		if i < 16 {
+			h.PrgRomSize += len(chunk)
+		} else {
+			h.ChrRomSize += len(chunk)
+		}
+
+		rom = append(rom, chunk...)
+	}
+
+	h.PrgRamSize = 0x2000
+	if h.Battery {
+		h.PrgNvramSize = h.PrgRamSize
+		h.PrgRamSize = 0
+	}
+
+	if h.ChrRomSize == 0 {
+		h.ChrRamSize = 0x2000
+	}
+
+	return h, rom, nil
+}
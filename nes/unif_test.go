@@ -0,0 +1,84 @@
+package nes
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func unifChunk(id string, data []byte) []byte {
+	chunk := make([]byte, 8)
+	copy(chunk, id)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+
+	return append(chunk, data...)
+}
+
+func testUnif(board string, chunks ...[]byte) []byte {
+	unif := make([]byte, UnifHeaderSize)
+	copy(unif, "UNIF")
+	unif[4] = 7
+
+	unif = append(unif, unifChunk("MAPR", []byte(board+"\x00"))...)
+	for _, c := range chunks {
+		unif = append(unif, c...)
+	}
+
+	return unif
+}
+
+func TestUnif(test *testing.T) {
+	initRomTest()
+
+	prg := make([]byte, 0x8000)
+	prg[0] = 0xAA
+	chr := make([]byte, 0x2000)
+
+	m, err := LoadRom(testUnif("NES-UNROM",
+		unifChunk("PRG0", prg[:0x4000]),
+		unifChunk("PRG1", prg[0x4000:]),
+		unifChunk("MIRR", []byte{1}),
+		unifChunk("BATR", []byte{1}),
+	))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, ok := m.(*Unrom); !ok {
+		test.Errorf("NES-UNROM loaded as %T, expected *Unrom", m)
+	}
+
+	if Header.PrgRomSize != 0x8000 || Header.ChrRamSize != 0x2000 {
+		test.Errorf("PRG-ROM was %d bytes and CHR-RAM %d, expected 32k and 8k", Header.PrgRomSize, Header.ChrRamSize)
+	}
+
+	if Header.Mirroring != MirroringVertical || !Header.Battery {
+		test.Errorf("MIRR and BATR chunks weren't applied")
+	}
+
+	if v := m.Read(0x8000); v != 0xAA {
+		test.Errorf("0x8000 was 0x%X, expected 0xAA", v)
+	}
+
+	m, err = LoadRom(testUnif("HVC-SLROM",
+		unifChunk("PRG0", prg),
+		unifChunk("CHR0", chr),
+	))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, ok := m.(*Mmc1); !ok {
+		test.Errorf("HVC-SLROM loaded as %T, expected *Mmc1", m)
+	}
+
+	_, err = LoadRom(testUnif("UNL-NOTABOARD", unifChunk("PRG0", prg)))
+	if err == nil || !strings.Contains(err.Error(), "NOTABOARD") {
+		test.Errorf("Unknown board returned %v", err)
+	}
+
+	truncated := testUnif("NES-NROM", unifChunk("PRG0", prg))
+	if _, err := LoadRom(truncated[:len(truncated)-1]); err == nil {
+		test.Errorf("Truncated UNIF file should fail")
+	}
+}
@@ -8,11 +8,18 @@ type Unrom struct {
 	ChrRomCount  int
 	Battery      bool
 	Data         []byte
+	Chr          *ChrMemory
+
+	BusConflicts bool
 
 	ActiveBank int
 }
 
 func (m *Unrom) Write(v Word, a int) {
+	if m.BusConflicts {
+		v = busConflict(m, v, a)
+	}
+
 	m.ActiveBank = int(v & 0x7)
 }
 
@@ -26,11 +33,11 @@ func (m *Unrom) Read(a int) Word {
 
 func (m *Unrom) WriteVram(v Word, a int) {
 	if a >= 0x1000 {
-		m.VromBanks[len(m.VromBanks)-1][a&0xFFF] = v
+		m.Chr.WriteBank(v, len(m.VromBanks)-1, 0x1000, a&0xFFF)
 		return
 	}
 
-	m.VromBanks[0][a&0xFFF] = v
+	m.Chr.WriteBank(v, 0, 0x1000, a&0xFFF)
 }
 
 func (m *Unrom) ReadVram(a int) Word {
@@ -54,3 +61,9 @@ func (m *Unrom) ReadTile(a int) []Word {
 func (m *Unrom) BatteryBacked() bool {
 	return m.Battery
 }
+
+func (m *Unrom) SerializeState(s *State) {
+	s.Int(&m.ActiveBank)
+
+	m.Chr.SerializeState(s)
+}
@@ -0,0 +1,28 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestUnromBusConflicts(test *testing.T) {
+	loadMapperRom(test, 2, SubmapperBusConflicts, 8, 0)
+
+	// The ROM has 0 at $8000, which wins over the write
+	Ram.Write(0x8000, 0x05)
+	verifyPrgBank(0x8000, 0, test)
+
+	// $8001 is $FF, so the write goes through
+	Ram.Write(0x8001, 0x05)
+	verifyPrgBank(0x8000, 5, test)
+
+	// And $C000 has the last bank, 7
+	Ram.Write(0xC000, 0x0E)
+	verifyPrgBank(0x8000, 6, test)
+}
+
+func TestUnromWithoutBusConflicts(test *testing.T) {
+	loadMapperRom(test, 2, SubmapperNoBusConflicts, 8, 0)
+
+	Ram.Write(0x8000, 0x05)
+	verifyPrgBank(0x8000, 5, test)
+}
@@ -0,0 +1,289 @@
+package nes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	VgmVersion    = 0x161
+	VgmHeaderSize = 0xC0
+	VgmSampleRate = 44100
+
+	VgmCommandYm2413   = 0x51
+	VgmCommandWait     = 0x61
+	VgmCommandEnd      = 0x66
+	VgmCommandBlock    = 0x67
+	VgmCommandAy8910   = 0xA0
+	VgmCommandNesApu   = 0xB4
+	VgmBlockNesApuRam  = 0xC2
+	VgmAyTypeYm2149    = 0x10
+	VgmFdsFlag         = 0x80000000
+	VgmYm2413ClockRate = 3579545
+)
+
+var (
+	vgmLog *VgmLogger
+)
+
+// Logs register writes to the APU, and to the expansion chips
+// that VGM has an equivalent for (FDS, VRC7 as a YM2413 and the
+// 5B as a YM2149). VRC6, MMC5 and Namco 163 writes are dropped.
+type VgmLogger struct {
+	Samples    int
+	Fds        bool
+	Ym2413     bool
+	Ay8910     bool
+	StartCycle int
+
+	// DMC sample data that has already been written,
+	// by start address
+	DmcBlocks map[int][]byte
+
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func NewVgmLogger(filename string) (*VgmLogger, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &VgmLogger{
+		StartCycle: totalCpuCycles,
+		DmcBlocks:  map[int][]byte{},
+		file:       f,
+		writer:     bufio.NewWriter(f),
+	}
+
+	// The header is filled in when the file is closed
+	l.writer.Write(make([]byte, VgmHeaderSize))
+
+	return l, nil
+}
+
+// Emits wait commands up to the current CPU cycle
+func (l *VgmLogger) sync() {
+	now := int(int64(totalCpuCycles-l.StartCycle) * VgmSampleRate / int64(cpuClockSpeed))
+
+	for wait := now - l.Samples; wait > 0; wait = now - l.Samples {
+		if wait > 0xFFFF {
+			wait = 0xFFFF
+		}
+
+		if wait <= 16 {
+			l.writer.WriteByte(byte(0x70 + wait - 1))
+		} else {
+			l.writer.Write([]byte{VgmCommandWait, byte(wait), byte(wait >> 8)})
+		}
+
+		l.Samples += wait
+	}
+}
+
+// Writes to $4000-$4017 and the FDS registers at $4040-$409E
+func (l *VgmLogger) WriteApu(a int, v Word) {
+	var r int
+
+	switch {
+	case a >= 0x4000 && a <= 0x401F:
+		r = a - 0x4000
+	case a >= 0x4040 && a <= 0x407F:
+		r = a - 0x4000
+		l.Fds = true
+	case a >= 0x4080 && a <= 0x409E:
+		r = a - 0x4060
+		l.Fds = true
+	case a == 0x4023:
+		r = 0x3F
+		l.Fds = true
+	default:
+		return
+	}
+
+	l.sync()
+
+	// Enabling the DMC needs the sample it's about to
+	// play to be in the player's memory
+	if a == 0x4015 && v&0x10 == 0x10 {
+		l.writeDmcBlock(0xC000+apu.Dmc.SampleAddress, apu.Dmc.SampleLength)
+	}
+
+	l.writer.Write([]byte{VgmCommandNesApu, byte(r), byte(v)})
+}
+
+func (l *VgmLogger) WriteYm2413(r, v uint8) {
+	l.Ym2413 = true
+	l.sync()
+	l.writer.Write([]byte{VgmCommandYm2413, r, v})
+}
+
+func (l *VgmLogger) WriteAy8910(r, v Word) {
+	l.Ay8910 = true
+	l.sync()
+	l.writer.Write([]byte{VgmCommandAy8910, byte(r), byte(v)})
+}
+
+func (l *VgmLogger) writeDmcBlock(start, length int) {
+	data := make([]byte, length)
+	for i := range data {
+		// Sample addresses wrap around to $8000
+		a := start + i
+		if a > 0xFFFF {
+			a -= 0x8000
+		}
+
+		v, _ := Ram.Read(uint16(a))
+		data[i] = byte(v)
+	}
+
+	if prev, ok := l.DmcBlocks[start]; ok && bytes.Equal(prev, data) {
+		return
+	}
+
+	l.DmcBlocks[start] = data
+
+	// The block size includes the two byte load address
+	header := make([]byte, 9)
+	header[0] = VgmCommandBlock
+	header[1] = VgmCommandEnd
+	header[2] = VgmBlockNesApuRam
+	binary.LittleEndian.PutUint32(header[3:], uint32(len(data)+2))
+	binary.LittleEndian.PutUint16(header[7:], uint16(start))
+
+	l.writer.Write(header)
+	l.writer.Write(data)
+}
+
+func (l *VgmLogger) writeHeader(size int) {
+	header := make([]byte, VgmHeaderSize)
+	copy(header, "Vgm ")
+	// Offsets are relative to their own position
+	binary.LittleEndian.PutUint32(header[0x04:], uint32(size-0x04))
+	binary.LittleEndian.PutUint32(header[0x08:], VgmVersion)
+	binary.LittleEndian.PutUint32(header[0x18:], uint32(l.Samples))
+	binary.LittleEndian.PutUint32(header[0x24:], 60)
+	binary.LittleEndian.PutUint32(header[0x34:], VgmHeaderSize-0x34)
+
+	if l.Ym2413 {
+		binary.LittleEndian.PutUint32(header[0x10:], VgmYm2413ClockRate)
+	}
+
+	if l.Ay8910 {
+		binary.LittleEndian.PutUint32(header[0x74:], uint32(cpuClockSpeed))
+		header[0x78] = VgmAyTypeYm2149
+	}
+
+	clock := uint32(cpuClockSpeed)
+	if l.Fds {
+		clock |= VgmFdsFlag
+	}
+
+	binary.LittleEndian.PutUint32(header[0x84:], clock)
+
+	l.writer.Write(header)
+}
+
+func (l *VgmLogger) Close() error {
+	l.sync()
+	l.writer.WriteByte(VgmCommandEnd)
+
+	if err := l.writer.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+
+	size, err := l.file.Seek(0, 1)
+	if err != nil {
+		l.file.Close()
+		return err
+	}
+
+	if _, err := l.file.Seek(0, 0); err != nil {
+		l.file.Close()
+		return err
+	}
+
+	l.writeHeader(int(size))
+
+	if err := l.writer.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+
+	return l.file.Close()
+}
+
+func VgmLogging() bool {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	return vgmLog != nil
+}
+
+func StartVgmLogging(filename string) error {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	if vgmLog != nil {
+		return errors.New("A VGM log is already being written")
+	}
+
+	l, err := NewVgmLogger(filename)
+	if err != nil {
+		return err
+	}
+
+	vgmLog = l
+	fmt.Println("Logging audio registers to", filename)
+
+	return nil
+}
+
+func StopVgmLogging() error {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	if vgmLog == nil {
+		return nil
+	}
+
+	err := vgmLog.Close()
+	vgmLog = nil
+
+	fmt.Println("VGM log stopped")
+
+	return err
+}
+
+func logApuWrite(a int, v Word) {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	if vgmLog != nil {
+		vgmLog.WriteApu(a, v)
+	}
+}
+
+func logYm2413Write(r, v uint8) {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	if vgmLog != nil {
+		vgmLog.WriteYm2413(r, v)
+	}
+}
+
+func logAy8910Write(r, v Word) {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	if vgmLog != nil {
+		vgmLog.WriteAy8910(r, v)
+	}
+}
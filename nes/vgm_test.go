@@ -0,0 +1,79 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVgmLog(test *testing.T) {
+	dir, err := ioutil.TempDir("", "vgm")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// DMC samples are read from the NSF's ROM
+	n := initNsfTest(newTestNsf(), test)
+	n.PlaySong(0)
+	filename := filepath.Join(dir, "out.vgm")
+
+	if err := StartVgmLogging(filename); err != nil {
+		test.Fatal(err)
+	}
+
+	apu.RegWrite(0xBF, 0x4000)
+
+	// 100 samples later
+	totalCpuCycles += cpuClockSpeed * 100 / VgmSampleRate
+	apu.RegWrite(0x00, 0x4012)
+	apu.RegWrite(0x00, 0x4013)
+	apu.RegWrite(0x10, 0x4015)
+
+	// Restarting the same sample doesn't write it again
+	apu.RegWrite(0x10, 0x4015)
+
+	if err := StopVgmLogging(); err != nil {
+		test.Fatal(err)
+	}
+
+	vgm, err := ioutil.ReadFile(filename)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if string(vgm[0:4]) != "Vgm " {
+		test.Fatalf("Missing VGM header")
+	}
+
+	if eof := binary.LittleEndian.Uint32(vgm[0x04:]); int(eof) != len(vgm)-4 {
+		test.Errorf("EOF offset was 0x%X, expected 0x%X", eof, len(vgm)-4)
+	}
+
+	if clock := binary.LittleEndian.Uint32(vgm[0x84:]); int(clock) != cpuClockSpeed {
+		test.Errorf("NES APU clock was %d, expected %d", clock, cpuClockSpeed)
+	}
+
+	if samples := binary.LittleEndian.Uint32(vgm[0x18:]); samples != 99 && samples != 100 {
+		test.Errorf("Total samples was %d, expected 100", samples)
+	}
+
+	expected := []byte{
+		VgmCommandNesApu, 0x00, 0xBF,
+		VgmCommandWait, byte(binary.LittleEndian.Uint32(vgm[0x18:])), 0x00,
+		VgmCommandNesApu, 0x12, 0x00,
+		VgmCommandNesApu, 0x13, 0x00,
+		// One byte sample at $C000, past the end of the NSF code
+		VgmCommandBlock, VgmCommandEnd, VgmBlockNesApuRam, 0x03, 0x00, 0x00, 0x00, 0x00, 0xC0, 0x00,
+		VgmCommandNesApu, 0x15, 0x10,
+		VgmCommandNesApu, 0x15, 0x10,
+		VgmCommandEnd,
+	}
+
+	if !bytes.Equal(vgm[VgmHeaderSize:], expected) {
+		test.Errorf("VGM data was % X, expected % X", vgm[VgmHeaderSize:], expected)
+	}
+}
@@ -0,0 +1,418 @@
+package nes
+
+import (
+	"bufio"
+	"compress/lzw"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	VideoWidth  = 240
+	VideoHeight = 224
+
+	// The exact NTSC frame rate (60.0988 fps) as a fraction
+	VideoRateNumerator   = 39375000
+	VideoRateDenominator = 655171
+
+	// GIF delays are in hundredths of a second and most decoders
+	// treat anything under two as a much longer delay, so only
+	// every other frame is stored
+	GifFrameSkip = 2
+)
+
+var (
+	videoRecorder *VideoRecorder
+)
+
+// Receives every frame as it's produced, in the same
+// 0xRRGGBB00 format as the PPU's output
+type FrameWriter interface {
+	WriteFrame(frame []uint32) error
+	Close() error
+}
+
+func frameColor(c uint32) (r, g, b uint8) {
+	return uint8(c >> 24), uint8(c >> 16), uint8(c >> 8)
+}
+
+// Uncompressed YUV4MPEG2 stream, with full resolution chroma
+type Y4mWriter struct {
+	Width  int
+	Height int
+
+	file   *os.File
+	writer *bufio.Writer
+	planes []byte
+}
+
+func NewY4mWriter(filename string, width, height int) (*Y4mWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Y4mWriter{
+		Width:  width,
+		Height: height,
+		file:   f,
+		writer: bufio.NewWriter(f),
+		planes: make([]byte, width*height*3),
+	}
+
+	fmt.Fprintf(w.writer, "YUV4MPEG2 W%d H%d F%d:%d Ip A1:1 C444\n",
+		width, height, VideoRateNumerator, VideoRateDenominator)
+
+	return w, nil
+}
+
+func (w *Y4mWriter) WriteFrame(frame []uint32) error {
+	size := w.Width * w.Height
+
+	for i, c := range frame[:size] {
+		r, g, b := frameColor(c)
+
+		// BT.601, studio swing
+		y := (66*int(r) + 129*int(g) + 25*int(b) + 128) >> 8
+		u := (-38*int(r) - 74*int(g) + 112*int(b) + 128) >> 8
+		v := (112*int(r) - 94*int(g) - 18*int(b) + 128) >> 8
+
+		w.planes[i] = byte(y + 16)
+		w.planes[size+i] = byte(u + 128)
+		w.planes[(2*size)+i] = byte(v + 128)
+	}
+
+	w.writer.WriteString("FRAME\n")
+	_, err := w.writer.Write(w.planes)
+
+	return err
+}
+
+func (w *Y4mWriter) Close() error {
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
+
+// Numbered PNG files, e.g. shot.png -> shot-000000.png, shot-000001.png
+type PngSequenceWriter struct {
+	Width  int
+	Height int
+	Frame  int
+	Prefix string
+}
+
+func NewPngSequenceWriter(filename string, width, height int) *PngSequenceWriter {
+	return &PngSequenceWriter{
+		Width:  width,
+		Height: height,
+		Prefix: strings.TrimSuffix(filename, filepath.Ext(filename)),
+	}
+}
+
+func frameImage(frame []uint32, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for i, c := range frame[:width*height] {
+		r, g, b := frameColor(c)
+
+		img.Pix[(i*4)+0] = r
+		img.Pix[(i*4)+1] = g
+		img.Pix[(i*4)+2] = b
+		img.Pix[(i*4)+3] = 0xFF
+	}
+
+	return img
+}
+
+func (w *PngSequenceWriter) WriteFrame(frame []uint32) error {
+	f, err := os.Create(fmt.Sprintf("%s-%06d.png", w.Prefix, w.Frame))
+	if err != nil {
+		return err
+	}
+
+	w.Frame++
+
+	if err := png.Encode(f, frameImage(frame, w.Width, w.Height)); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (w *PngSequenceWriter) Close() error {
+	return nil
+}
+
+// Animated GIF using the NES palette as the global color table.
+// Frames are encoded as they arrive rather than buffered.
+type GifWriter struct {
+	Width   int
+	Height  int
+	Frames  int
+	Elapsed int
+
+	palette color.Palette
+	indexes map[uint32]uint8
+	pixels  []byte
+	file    *os.File
+	writer  *bufio.Writer
+}
+
+func NewGifWriter(filename string, width, height int) (*GifWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &GifWriter{
+		Width:   width,
+		Height:  height,
+		indexes: map[uint32]uint8{},
+		pixels:  make([]byte, width*height),
+		file:    f,
+		writer:  bufio.NewWriter(f),
+	}
+
+	table := make([]byte, len(PaletteRgb)*3)
+	for i, c := range PaletteRgb {
+		r, g, b := frameColor(c << 8)
+
+		w.palette = append(w.palette, color.RGBA{r, g, b, 0xFF})
+		table[(i*3)+0] = r
+		table[(i*3)+1] = g
+		table[(i*3)+2] = b
+
+		if _, ok := w.indexes[c<<8]; !ok {
+			w.indexes[c<<8] = uint8(i)
+		}
+	}
+
+	header := make([]byte, 13)
+	copy(header, "GIF89a")
+	binary.LittleEndian.PutUint16(header[6:], uint16(width))
+	binary.LittleEndian.PutUint16(header[8:], uint16(height))
+	// Global color table of 64 entries
+	header[10] = 0xF5
+
+	w.writer.Write(header)
+	w.writer.Write(table)
+
+	// Loop forever
+	w.writer.Write([]byte{0x21, 0xFF, 0x0B})
+	w.writer.WriteString("NETSCAPE2.0")
+	w.writer.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+
+	return w, nil
+}
+
+func (w *GifWriter) index(c uint32) uint8 {
+	if i, ok := w.indexes[c]; ok {
+		return i
+	}
+
+	r, g, b := frameColor(c)
+	i := uint8(w.palette.Index(color.RGBA{r, g, b, 0xFF}))
+	w.indexes[c] = i
+
+	return i
+}
+
+func (w *GifWriter) WriteFrame(frame []uint32) error {
+	w.Frames++
+	if (w.Frames-1)%GifFrameSkip != 0 {
+		return nil
+	}
+
+	for i, c := range frame[:w.Width*w.Height] {
+		w.pixels[i] = w.index(c)
+	}
+
+	// Delays are rounded so that they add up to the
+	// exact frame rate over the whole recording
+	total := int(int64(w.Frames-1+GifFrameSkip) * 100 * VideoRateDenominator / VideoRateNumerator)
+	delay := total - w.Elapsed
+	w.Elapsed = total
+
+	w.writer.Write([]byte{0x21, 0xF9, 0x04, 0x00, byte(delay), byte(delay >> 8), 0x00, 0x00})
+
+	descriptor := make([]byte, 10)
+	descriptor[0] = 0x2C
+	binary.LittleEndian.PutUint16(descriptor[5:], uint16(w.Width))
+	binary.LittleEndian.PutUint16(descriptor[7:], uint16(w.Height))
+	w.writer.Write(descriptor)
+
+	// Minimum code size for a 64 color palette
+	w.writer.WriteByte(6)
+
+	blocks := &gifBlockWriter{writer: w.writer}
+	compressor := lzw.NewWriter(blocks, lzw.LSB, 6)
+
+	if _, err := compressor.Write(w.pixels); err != nil {
+		return err
+	}
+
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+
+	return blocks.Close()
+}
+
+func (w *GifWriter) Close() error {
+	w.writer.WriteByte(0x3B)
+
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
+
+// Splits image data into length prefixed sub-blocks
+type gifBlockWriter struct {
+	writer *bufio.Writer
+	block  []byte
+}
+
+func (b *gifBlockWriter) Write(p []byte) (int, error) {
+	for _, v := range p {
+		b.block = append(b.block, v)
+
+		if len(b.block) == 0xFF {
+			if err := b.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+func (b *gifBlockWriter) flush() error {
+	if len(b.block) == 0 {
+		return nil
+	}
+
+	b.writer.WriteByte(byte(len(b.block)))
+	_, err := b.writer.Write(b.block)
+	b.block = b.block[:0]
+
+	return err
+}
+
+func (b *gifBlockWriter) Close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+
+	return b.writer.WriteByte(0x00)
+}
+
+// Picks the format from the file extension: .y4m, .gif, or
+// .png for a numbered sequence
+func NewFrameWriter(filename string, width, height int) (FrameWriter, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".y4m":
+		return NewY4mWriter(filename, width, height)
+	case ".gif":
+		return NewGifWriter(filename, width, height)
+	case ".png":
+		return NewPngSequenceWriter(filename, width, height), nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("Unsupported video format: %s", filename))
+}
+
+type VideoRecorder struct {
+	Writer FrameWriter
+	Audio  bool
+}
+
+func VideoRecording() bool {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	return videoRecorder != nil
+}
+
+// Starts recording every frame to a Y4M stream, GIF or PNG sequence.
+// With audio enabled a WAV file is recorded alongside it.
+func StartVideoRecording(filename string, audio bool) error {
+	recorderLock.Lock()
+
+	if videoRecorder != nil {
+		recorderLock.Unlock()
+		return errors.New("Video is already being recorded")
+	}
+
+	w, err := NewFrameWriter(filename, VideoWidth, VideoHeight)
+	if err != nil {
+		recorderLock.Unlock()
+		return err
+	}
+
+	videoRecorder = &VideoRecorder{
+		Writer: w,
+		Audio:  audio,
+	}
+
+	recorderLock.Unlock()
+
+	fmt.Println("Recording video to", filename)
+
+	if audio {
+		ext := filepath.Ext(filename)
+		return StartAudioRecording(strings.TrimSuffix(filename, ext)+".wav", false)
+	}
+
+	return nil
+}
+
+func StopVideoRecording() error {
+	recorderLock.Lock()
+
+	if videoRecorder == nil {
+		recorderLock.Unlock()
+		return nil
+	}
+
+	r := videoRecorder
+	videoRecorder = nil
+
+	err := r.Writer.Close()
+	recorderLock.Unlock()
+
+	fmt.Println("Video recording stopped")
+
+	if r.Audio {
+		if e := StopAudioRecording(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+func recordFrame(frame []uint32) {
+	recorderLock.Lock()
+	defer recorderLock.Unlock()
+
+	if videoRecorder != nil {
+		if err := videoRecorder.Writer.WriteFrame(frame); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package nes
+
+import (
+	"bytes"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testFrame() []uint32 {
+	frame := make([]uint32, 0xEFE0)
+	for i := range frame {
+		frame[i] = PaletteRgb[i%len(PaletteRgb)] << 8
+	}
+
+	return frame
+}
+
+func recordTestVideo(filename string, frames int, test *testing.T) {
+	if err := StartVideoRecording(filename, false); err != nil {
+		test.Fatal(err)
+	}
+
+	frame := testFrame()
+	for i := 0; i < frames; i++ {
+		recordFrame(frame)
+	}
+
+	if err := StopVideoRecording(); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func TestY4mRecording(test *testing.T) {
+	dir, err := ioutil.TempDir("", "video")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "out.y4m")
+	recordTestVideo(filename, 3, test)
+
+	y4m, err := ioutil.ReadFile(filename)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	header := "YUV4MPEG2 W240 H224 F39375000:655171 Ip A1:1 C444\n"
+	if !bytes.HasPrefix(y4m, []byte(header)) {
+		test.Fatalf("Header was %q", y4m[:len(header)])
+	}
+
+	frameSize := len("FRAME\n") + (VideoWidth * VideoHeight * 3)
+	if len(y4m) != len(header)+(3*frameSize) {
+		test.Errorf("Stream was %d bytes, expected %d", len(y4m), len(header)+(3*frameSize))
+	}
+
+	// Black is 16 in studio swing
+	black := len(header) + len("FRAME\n") + 13
+	if y4m[black] != 16 {
+		test.Errorf("Black was %d, expected 16", y4m[black])
+	}
+}
+
+func TestGifRecording(test *testing.T) {
+	dir, err := ioutil.TempDir("", "video")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "out.gif")
+	recordTestVideo(filename, 120, test)
+
+	f, err := os.Open(filename)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer f.Close()
+
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if len(g.Image) != 120/GifFrameSkip {
+		test.Errorf("GIF had %d frames, expected %d", len(g.Image), 120/GifFrameSkip)
+	}
+
+	// 120 frames is just under two seconds
+	var total int
+	for _, d := range g.Delay {
+		if d < 3 || d > 4 {
+			test.Errorf("Frame delay was %d", d)
+		}
+
+		total += d
+	}
+
+	if total != 199 {
+		test.Errorf("Total delay was %d, expected 199", total)
+	}
+
+	if c := g.Image[0].At(1, 0); c != g.Image[0].Palette[1] {
+		test.Errorf("Pixel (1, 0) was %v, expected %v", c, g.Image[0].Palette[1])
+	}
+}
+
+func TestPngSequenceRecording(test *testing.T) {
+	dir, err := ioutil.TempDir("", "video")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recordTestVideo(filepath.Join(dir, "out.png"), 2, test)
+
+	for _, name := range []string{"out-000000.png", "out-000001.png"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		img, err := png.Decode(f)
+		f.Close()
+
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if b := img.Bounds(); b.Dx() != VideoWidth || b.Dy() != VideoHeight {
+			test.Errorf("%s was %dx%d", name, b.Dx(), b.Dy())
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package nes
+
+import (
+	"fmt"
+)
+
+// Konami VRC2 and VRC4, mappers 21, 22, 23 and 25. The boards
+// only differ in which CPU address lines select the register
+// within each $1000 range, and the VRC2 lacks the IRQ counter
+// and PRG swap mode.
+type Vrc4 struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	Vrc2 bool
+
+	// Address lines for bits 0 and 1 of the register select.
+	// Boards with an unknown submapper use both candidates.
+	Select0 int
+	Select1 int
+
+	// The VRC2a only has 7 CHR bank lines, wired to the
+	// upper bits
+	ChrShift uint
+
+	// 8k banks for $8000 and $A000. $C000 and $E000 have
+	// the second to last and last banks, and swap mode
+	// exchanges $8000 and $C000
+	PrgBanks [2]int
+	SwapMode bool
+	ChrBanks [8]int
+
+	// The VRC2 has a one bit latch at $6000-$6FFF when
+	// there's no PRG-RAM
+	MicrowireLatch bool
+	Microwire      Word
+
+	Irq VrcIrq
+}
+
+func NewVrc4(r *Nrom) *Vrc4 {
+	m := &Vrc4{
+		PrgBankCount: r.PrgBankCount,
+		ChrRomCount:  r.ChrRomCount,
+		Battery:      r.Battery,
+		Data:         r.Data,
+		Chr:          r.Chr,
+	}
+
+	h := r.Header
+
+	switch h.Mapper {
+	case 21:
+		switch h.Submapper {
+		case 1:
+			// VRC4a
+			m.Select0, m.Select1 = 0x02, 0x04
+		case 2:
+			// VRC4c
+			m.Select0, m.Select1 = 0x40, 0x80
+		default:
+			m.Select0, m.Select1 = 0x42, 0x84
+		}
+	case 22:
+		// VRC2a
+		m.Vrc2 = true
+		m.Select0, m.Select1 = 0x02, 0x01
+		m.ChrShift = 1
+	case 23:
+		switch h.Submapper {
+		case 1:
+			// VRC4f
+			m.Select0, m.Select1 = 0x01, 0x02
+		case 2:
+			// VRC4e
+			m.Select0, m.Select1 = 0x04, 0x08
+		case 3:
+			// VRC2b
+			m.Vrc2 = true
+			m.Select0, m.Select1 = 0x01, 0x02
+		default:
+			m.Select0, m.Select1 = 0x05, 0x0A
+		}
+	case 25:
+		switch h.Submapper {
+		case 1:
+			// VRC4b
+			m.Select0, m.Select1 = 0x02, 0x01
+		case 2:
+			// VRC4d
+			m.Select0, m.Select1 = 0x08, 0x04
+		case 3:
+			// VRC2c
+			m.Vrc2 = true
+			m.Select0, m.Select1 = 0x02, 0x01
+		default:
+			m.Select0, m.Select1 = 0x0A, 0x05
+		}
+	}
+
+	m.MicrowireLatch = m.Vrc2 && h.PrgRamSize == 0 && h.PrgNvramSize == 0
+
+	m.Load()
+
+	return m
+}
+
+func (m *Vrc4) Load() {
+	// 2x the banks since we're storing 8k per bank
+	// instead of 16k
+	fmt.Printf("  Emulated PRG banks: %d\n", 2*m.PrgBankCount)
+	m.RomBanks = make([][]Word, 2*m.PrgBankCount)
+	for i := 0; i < 2*m.PrgBankCount; i++ {
+		// Move 8kb chunk to 8kb bank
+		bank := make([]Word, 0x2000)
+		for x := 0; x < 0x2000; x++ {
+			bank[x] = Word(m.Data[(0x2000*i)+x])
+		}
+
+		m.RomBanks[i] = bank
+	}
+
+	// CHR is stored in 1k banks
+	m.VromBanks = m.Chr.Banks(0x400)
+
+	m.PrgBanks[0] = 0
+	m.PrgBanks[1] = 1 % len(m.RomBanks)
+}
+
+func (m *Vrc4) BatteryBacked() bool {
+	return m.Battery
+}
+
+func (m *Vrc4) MapsCpuAddress(a int) bool {
+	return m.MicrowireLatch && a >= 0x6000 && a < 0x7000
+}
+
+func (m *Vrc4) Write(v Word, a int) {
+	if a < 0x8000 {
+		m.Microwire = v & 0x1
+		return
+	}
+
+	reg := 0
+	if a&m.Select0 != 0 {
+		reg |= 0x1
+	}
+
+	if a&m.Select1 != 0 {
+		reg |= 0x2
+	}
+
+	switch a & 0xF000 {
+	case 0x8000:
+		m.PrgBanks[0] = int(v&0x1F) % len(m.RomBanks)
+	case 0x9000:
+		if m.Vrc2 {
+			m.WriteMirroring(v & 0x1)
+		} else if reg < 2 {
+			m.WriteMirroring(v & 0x3)
+		} else {
+			// Bit 0 controls PRG-RAM, which is always on
+			m.SwapMode = v&0x2 == 0x2
+		}
+	case 0xA000:
+		m.PrgBanks[1] = int(v&0x1F) % len(m.RomBanks)
+	case 0xB000, 0xC000, 0xD000, 0xE000:
+		// 1k CHR banks, written a nibble at a time
+		slot := (((a&0xF000)-0xB000)>>11 | reg>>1)
+		bank := m.ChrBanks[slot]
+
+		if reg&0x1 == 0 {
+			bank = (bank & 0x1F0) | int(v&0xF)
+		} else {
+			bank = (bank & 0xF) | int(v&0x1F)<<4
+		}
+
+		m.ChrBanks[slot] = bank
+	case 0xF000:
+		if m.Vrc2 {
+			return
+		}
+
+		switch reg {
+		case 0:
+			m.Irq.WriteLatchLow(v)
+		case 1:
+			m.Irq.WriteLatchHigh(v)
+		case 2:
+			m.Irq.WriteControl(v)
+		case 3:
+			m.Irq.Acknowledge()
+		}
+	}
+}
+
+// $9000
+func (m *Vrc4) WriteMirroring(v Word) {
+	switch v {
+	case 0x0:
+		ppu.Nametables.SetMirroring(MirroringVertical)
+	case 0x1:
+		ppu.Nametables.SetMirroring(MirroringHorizontal)
+	case 0x2:
+		ppu.Nametables.SetMirroring(MirroringSingleUpper)
+	case 0x3:
+		ppu.Nametables.SetMirroring(MirroringSingleLower)
+	}
+}
+
+func (m *Vrc4) Read(a int) Word {
+	switch {
+	case a < 0x8000:
+		// The other bits are open bus
+		return Word(a>>8)&0xFE | m.Microwire
+	case a >= 0xE000:
+		return m.RomBanks[len(m.RomBanks)-1][a&0x1FFF]
+	case a >= 0xC000 && !m.SwapMode, a < 0xA000 && m.SwapMode:
+		return m.RomBanks[len(m.RomBanks)-2][a&0x1FFF]
+	case a >= 0xC000:
+		return m.RomBanks[m.PrgBanks[0]][a&0x1FFF]
+	}
+
+	return m.RomBanks[m.PrgBanks[(a-0x8000)>>13]][a&0x1FFF]
+}
+
+func (m *Vrc4) chrBank(a int) int {
+	return (m.ChrBanks[a>>10] >> m.ChrShift) % len(m.VromBanks)
+}
+
+func (m *Vrc4) WriteVram(v Word, a int) {
+	m.Chr.WriteBank(v, m.chrBank(a), 0x400, a&0x3FF)
+}
+
+func (m *Vrc4) ReadVram(a int) Word {
+	return m.VromBanks[m.chrBank(a)][a&0x3FF]
+}
+
+func (m *Vrc4) ReadTile(a int) []Word {
+	return m.VromBanks[m.chrBank(a)][a&0x3FF : a&0x3FF+16]
+}
+
+func (m *Vrc4) Clock(cycles int) {
+	for i := 0; i < cycles; i++ {
+		m.Irq.Clock()
+	}
+}
+
+func (m *Vrc4) IrqAsserted() bool {
+	return m.Irq.Requested
+}
+
+func (m *Vrc4) SerializeState(s *State) {
+	s.Ints(m.PrgBanks[:])
+	s.Bool(&m.SwapMode)
+	s.Ints(m.ChrBanks[:])
+	s.Word(&m.Microwire)
+
+	m.Irq.SerializeState(s)
+
+	m.Chr.SerializeState(s)
+}
@@ -0,0 +1,114 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestVrc4Banking(test *testing.T) {
+	// VRC4c, which selects registers with A6 and A7
+	loadMapperRom(test, 21, 2, 8, 8)
+
+	// 8k banks 4 and 6, which start 16k banks 2 and 3
+	Ram.Write(0x8000, 4)
+	Ram.Write(0xA000, 6)
+
+	verifyPrgBank(0x8000, 2, test)
+	verifyPrgBank(0xA000, 3, test)
+	verifyPrgBank(0xC000, 7, test)
+
+	// Swap mode puts the second to last bank at $8000
+	Ram.Write(0x9080, 0x02)
+
+	verifyPrgBank(0x8000, 7, test)
+	verifyPrgBank(0xC000, 2, test)
+
+	// 1k bank $14 from two nibbles, which is 4k bank 5,
+	// and bank 8 in the next slot
+	Ram.Write(0xB000, 0x04)
+	Ram.Write(0xB040, 0x01)
+	Ram.Write(0xB080, 0x08)
+
+	verifyChrBank(0x0000, 5, test)
+	verifyChrBank(0x0400, 2, test)
+
+	Ram.Write(0x9000, 0x01)
+	if ppu.Nametables.Mirroring != MirroringHorizontal {
+		test.Error("Mirroring wasn't horizontal")
+	}
+}
+
+func TestVrc4UnknownSubmapper(test *testing.T) {
+	// Without a submapper, mapper 25 responds to the lines
+	// of both the VRC4b and VRC4d
+	loadMapperRom(test, 25, 0, 8, 8)
+
+	// VRC4b's high nibble register
+	Ram.Write(0xB000, 0x00)
+	Ram.Write(0xB002, 0x01)
+	verifyChrBank(0x0000, 4, test)
+
+	// And VRC4d's
+	Ram.Write(0xB008, 0x02)
+	verifyChrBank(0x0000, 8, test)
+}
+
+func TestVrc4Irq(test *testing.T) {
+	m := loadMapperRom(test, 21, 2, 8, 8).(*Vrc4)
+
+	// Latch of $FE, then enable in CPU cycle mode
+	Ram.Write(0xF000, 0x0E)
+	Ram.Write(0xF040, 0x0F)
+	Ram.Write(0xF080, 0x06)
+
+	m.Clock(1)
+	if m.IrqAsserted() {
+		test.Error("IRQ fired early")
+	}
+
+	m.Clock(1)
+	if !m.IrqAsserted() {
+		test.Fatal("IRQ didn't fire when the counter overflowed")
+	}
+
+	Ram.Write(0xF0C0, 0x00)
+	if m.IrqAsserted() {
+		test.Error("Writing $F003 didn't acknowledge the IRQ")
+	}
+}
+
+func TestVrc2(test *testing.T) {
+	// VRC2b, with no PRG-RAM
+	m := loadMapperRom(test, 23, 3, 8, 8).(*Vrc4)
+
+	Ram.Write(0x6000, 0xFF)
+	if v, _ := Ram.Read(0x6000); v&0x1 != 0x1 {
+		test.Error("Microwire latch wasn't set")
+	}
+
+	Ram.Write(0x6000, 0x00)
+	if v, _ := Ram.Read(0x6000); v&0x1 != 0x0 {
+		test.Error("Microwire latch wasn't cleared")
+	}
+
+	// No IRQ counter or swap mode
+	Ram.Write(0xF002, 0x06)
+	if m.Irq.Enabled {
+		test.Error("VRC2 has no IRQ")
+	}
+
+	Ram.Write(0x8000, 4)
+	Ram.Write(0x9002, 0x03)
+	verifyPrgBank(0x8000, 2, test)
+
+	if ppu.Nametables.Mirroring != MirroringHorizontal {
+		test.Error("Mirroring wasn't horizontal")
+	}
+}
+
+func TestVrc2a(test *testing.T) {
+	// The VRC2a drops the low bit of CHR banks
+	loadMapperRom(test, 22, 0, 8, 8)
+
+	Ram.Write(0xB000, 0x08)
+	verifyChrBank(0x0000, 1, test)
+}
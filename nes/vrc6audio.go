@@ -0,0 +1,171 @@
+package nes
+
+const (
+	Vrc6Volume = 0.0098
+)
+
+type Vrc6Pulse struct {
+	Enabled    bool
+	Mode       bool
+	DutyCycle  Word
+	Volume     Word
+	Timer      int
+	TimerCount int
+	Step       Word
+}
+
+type Vrc6Saw struct {
+	Enabled     bool
+	Rate        Word
+	Timer       int
+	TimerCount  int
+	Step        int
+	Accumulator Word
+}
+
+// Two pulse channels and a sawtooth, found on the VRC6
+// (Castlevania III (J), Madara, Esper Dream 2)
+type Vrc6Audio struct {
+	Pulse1 Vrc6Pulse
+	Pulse2 Vrc6Pulse
+	Saw    Vrc6Saw
+	Halt   bool
+
+	// Accumulated output since the last sample was pulled
+	OutputSum    int
+	OutputCycles int
+}
+
+// Register writes, with the address already decoded
+// to $9000-$B003
+func (v *Vrc6Audio) Write(val Word, a int) {
+	switch a {
+	case 0x9000:
+		v.Pulse1.WriteControl(val)
+	case 0x9001:
+		v.Pulse1.WriteLow(val)
+	case 0x9002:
+		v.Pulse1.WriteHigh(val)
+	case 0x9003:
+		v.Halt = val&0x1 == 0x1
+	case 0xA000:
+		v.Pulse2.WriteControl(val)
+	case 0xA001:
+		v.Pulse2.WriteLow(val)
+	case 0xA002:
+		v.Pulse2.WriteHigh(val)
+	case 0xB000:
+		v.Saw.Rate = val & 0x3F
+	case 0xB001:
+		v.Saw.Timer = (v.Saw.Timer & 0xF00) | int(val)
+	case 0xB002:
+		v.Saw.Timer = (v.Saw.Timer & 0xFF) | (int(val&0xF) << 8)
+		v.Saw.Enabled = val&0x80 == 0x80
+
+		if !v.Saw.Enabled {
+			v.Saw.Accumulator = 0
+			v.Saw.Step = 0
+		}
+	}
+}
+
+func (p *Vrc6Pulse) WriteControl(v Word) {
+	// MDDD VVVV
+	// |||| ||||
+	// |||| ++++- Volume
+	// |+++------ Duty cycle
+	// +--------- Mode (1: ignore duty, constant volume)
+	p.Mode = v&0x80 == 0x80
+	p.DutyCycle = (v >> 4) & 0x7
+	p.Volume = v & 0xF
+}
+
+func (p *Vrc6Pulse) WriteLow(v Word) {
+	p.Timer = (p.Timer & 0xF00) | int(v)
+}
+
+func (p *Vrc6Pulse) WriteHigh(v Word) {
+	p.Timer = (p.Timer & 0xFF) | (int(v&0xF) << 8)
+	p.Enabled = v&0x80 == 0x80
+
+	if !p.Enabled {
+		p.Step = 15
+	}
+}
+
+func (p *Vrc6Pulse) Clock() {
+	if !p.Enabled {
+		return
+	}
+
+	if p.TimerCount == 0 {
+		p.TimerCount = p.Timer
+		p.Step = (p.Step - 1) & 0xF
+	} else {
+		p.TimerCount--
+	}
+}
+
+func (p *Vrc6Pulse) Output() int {
+	if !p.Enabled {
+		return 0
+	}
+
+	if p.Mode || p.Step <= p.DutyCycle {
+		return int(p.Volume)
+	}
+
+	return 0
+}
+
+func (s *Vrc6Saw) Clock() {
+	if !s.Enabled {
+		return
+	}
+
+	if s.TimerCount > 0 {
+		s.TimerCount--
+		return
+	}
+
+	s.TimerCount = s.Timer
+
+	// The accumulator is only added to on every
+	// other step, and resets after 7 additions
+	s.Step++
+	if s.Step == 14 {
+		s.Step = 0
+		s.Accumulator = 0
+	} else if s.Step&0x1 == 0x0 {
+		s.Accumulator += s.Rate
+	}
+}
+
+func (s *Vrc6Saw) Output() int {
+	return int(s.Accumulator >> 3)
+}
+
+// Called once per CPU cycle
+func (v *Vrc6Audio) Clock() {
+	if !v.Halt {
+		v.Pulse1.Clock()
+		v.Pulse2.Clock()
+		v.Saw.Clock()
+	}
+
+	v.OutputSum += v.Pulse1.Output() + v.Pulse2.Output() + v.Saw.Output()
+	v.OutputCycles++
+}
+
+func (v *Vrc6Audio) Output() float64 {
+	if v.OutputCycles == 0 {
+		return 0
+	}
+
+	out := float64(v.OutputSum) / float64(v.OutputCycles)
+
+	v.OutputSum = 0
+	v.OutputCycles = 0
+
+	return out * Vrc6Volume
+}
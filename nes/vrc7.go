@@ -0,0 +1,229 @@
+package nes
+
+import (
+	"fmt"
+
+	"github.com/scottferg/Fergulator/nes/opll"
+)
+
+const (
+	// The FM chip produces a sample every 36 CPU cycles
+	Vrc7SampleCycles = 36
+	Vrc7Volume       = 0.000012
+)
+
+type Vrc7 struct {
+	RomBanks  [][]Word
+	VromBanks [][]Word
+
+	PrgBankCount int
+	ChrRomCount  int
+	Battery      bool
+	Data         []byte
+	Chr          *ChrMemory
+
+	// 8k banks for $8000, $A000 and $C000. $E000 is
+	// fixed to the last bank
+	PrgBanks [3]int
+	ChrBanks [8]int
+
+	PrgRamEnabled bool
+	SoundReset    bool
+
+	Irq VrcIrq
+
+	Fm           *opll.Opll
+	SampleCycles int
+
+	// Accumulated output since the last sample was pulled
+	OutputSum   int
+	OutputCount int
+}
+
+func NewVrc7(r *Nrom) *Vrc7 {
+	m := &Vrc7{
+		PrgBankCount: r.PrgBankCount,
+		ChrRomCount:  r.ChrRomCount,
+		Battery:      r.Battery,
+		Data:         r.Data,
+		Chr:          r.Chr,
+		Fm:           opll.New(),
+	}
+
+	m.Load()
+
+	apu.Expansion = append(apu.Expansion, m)
+
+	return m
+}
+
+func (m *Vrc7) Load() {
+	// 2x the banks since we're storing 8k per bank
+	// instead of 16k
+	fmt.Printf("  Emulated PRG banks: %d\n", 2*m.PrgBankCount)
+	m.RomBanks = make([][]Word, 2*m.PrgBankCount)
+	for i := 0; i < 2*m.PrgBankCount; i++ {
+		// Move 8kb chunk to 8kb bank
+		bank := make([]Word, 0x2000)
+		for x := 0; x < 0x2000; x++ {
+			bank[x] = Word(m.Data[(0x2000*i)+x])
+		}
+
+		m.RomBanks[i] = bank
+	}
+
+	// CHR is stored in 1k banks
+	m.VromBanks = m.Chr.Banks(0x400)
+
+	for i := range m.ChrBanks {
+		m.ChrBanks[i] = i % len(m.VromBanks)
+	}
+
+	m.PrgBanks[0] = 0
+	m.PrgBanks[1] = 1 % len(m.RomBanks)
+	m.PrgBanks[2] = (len(m.RomBanks) - 2) % len(m.RomBanks)
+}
+
+func (m *Vrc7) BatteryBacked() bool {
+	return m.Battery
+}
+
+func (m *Vrc7) Write(v Word, a int) {
+	// VRC7a (Lagrange Point) uses A4 as the register select,
+	// VRC7b (Tiny Toon Adventures 2) uses A3
+	high := a&0x18 != 0
+
+	switch a & 0xF000 {
+	case 0x8000:
+		if high {
+			m.PrgBanks[1] = int(v&0x3F) % len(m.RomBanks)
+		} else {
+			m.PrgBanks[0] = int(v&0x3F) % len(m.RomBanks)
+		}
+	case 0x9000:
+		switch {
+		case a&0x30 == 0x10:
+			m.Fm.WriteAddress(uint8(v))
+		case a&0x30 == 0x30:
+			logYm2413Write(m.Fm.Address, uint8(v))
+			m.Fm.WriteData(uint8(v))
+		default:
+			m.PrgBanks[2] = int(v&0x3F) % len(m.RomBanks)
+		}
+	case 0xA000, 0xB000, 0xC000, 0xD000:
+		// 1k CHR banks, two per register range
+		slot := ((a - 0xA000) >> 11) & 0x6
+		if high {
+			slot++
+		}
+
+		m.ChrBanks[slot] = int(v) % len(m.VromBanks)
+	case 0xE000:
+		if high {
+			m.Irq.WriteLatch(v)
+		} else {
+			m.WriteControl(v)
+		}
+	case 0xF000:
+		if high {
+			m.Irq.Acknowledge()
+		} else {
+			m.Irq.WriteControl(v)
+		}
+	}
+}
+
+// $E000
+func (m *Vrc7) WriteControl(v Word) {
+	// RS-- --MM
+	// ||     ||
+	// ||     ++- Mirroring
+	// |+-------- PRG-RAM enable
+	// +--------- Sound reset
+	switch v & 0x3 {
+	case 0x0:
+		ppu.Nametables.SetMirroring(MirroringVertical)
+	case 0x1:
+		ppu.Nametables.SetMirroring(MirroringHorizontal)
+	case 0x2:
+		ppu.Nametables.SetMirroring(MirroringSingleUpper)
+	case 0x3:
+		ppu.Nametables.SetMirroring(MirroringSingleLower)
+	}
+
+	m.PrgRamEnabled = v&0x40 == 0x40
+
+	reset := v&0x80 == 0x80
+	if reset && !m.SoundReset {
+		m.Fm.Reset()
+	}
+
+	m.SoundReset = reset
+}
+
+func (m *Vrc7) Read(a int) Word {
+	if a >= 0xE000 {
+		return m.RomBanks[len(m.RomBanks)-1][a&0x1FFF]
+	}
+
+	return m.RomBanks[m.PrgBanks[(a-0x8000)>>13]][a&0x1FFF]
+}
+
+func (m *Vrc7) WriteVram(v Word, a int) {
+	m.Chr.WriteBank(v, m.ChrBanks[a>>10], 0x400, a&0x3FF)
+}
+
+func (m *Vrc7) ReadVram(a int) Word {
+	return m.VromBanks[m.ChrBanks[a>>10]][a&0x3FF]
+}
+
+func (m *Vrc7) ReadTile(a int) []Word {
+	return m.VromBanks[m.ChrBanks[a>>10]][a&0x3FF : a&0x3FF+16]
+}
+
+// Called once per CPU instruction with the number of
+// cycles it took
+func (m *Vrc7) Clock(cycles int) {
+	for i := 0; i < cycles; i++ {
+		m.Irq.Clock()
+
+		m.SampleCycles++
+		if m.SampleCycles == Vrc7SampleCycles {
+			m.SampleCycles = 0
+
+			if !m.SoundReset {
+				m.Fm.Clock()
+				m.OutputSum += m.Fm.Sample
+				m.OutputCount++
+			}
+		}
+	}
+}
+
+func (m *Vrc7) IrqAsserted() bool {
+	return m.Irq.Requested
+}
+
+func (m *Vrc7) Output() float64 {
+	if m.OutputCount == 0 {
+		return 0
+	}
+
+	out := float64(m.OutputSum) / float64(m.OutputCount)
+
+	m.OutputSum = 0
+	m.OutputCount = 0
+
+	return out * Vrc7Volume
+}
+
+func (m *Vrc7) SerializeState(s *State) {
+	s.Ints(m.PrgBanks[:])
+	s.Ints(m.ChrBanks[:])
+	s.Bool(&m.PrgRamEnabled)
+	s.Bool(&m.SoundReset)
+
+	m.Irq.SerializeState(s)
+
+	m.Chr.SerializeState(s)
+}
@@ -0,0 +1,101 @@
+package nes
+
+import (
+	"testing"
+)
+
+func TestVrc7Banking(test *testing.T) {
+	loadMapperRom(test, 85, 0, 8, 8)
+
+	// 8k banks 4, 6 and 8, which start 16k banks 2, 3 and 4.
+	// The second register is at $8010 on the VRC7a and $8008
+	// on the VRC7b.
+	Ram.Write(0x8000, 4)
+	Ram.Write(0x8010, 6)
+	Ram.Write(0x9000, 8)
+
+	verifyPrgBank(0x8000, 2, test)
+	verifyPrgBank(0xA000, 3, test)
+	verifyPrgBank(0xC000, 4, test)
+
+	Ram.Write(0x8008, 10)
+	verifyPrgBank(0xA000, 5, test)
+
+	// 1k bank $14, which is 4k bank 5, and bank 8 in the
+	// next slot
+	Ram.Write(0xA000, 0x14)
+	Ram.Write(0xA010, 0x08)
+
+	verifyChrBank(0x0000, 5, test)
+	verifyChrBank(0x0400, 2, test)
+
+	Ram.Write(0xD008, 0x0C)
+	verifyChrBank(0x1C00, 3, test)
+}
+
+func TestVrc7Control(test *testing.T) {
+	m := loadMapperRom(test, 85, 0, 8, 8).(*Vrc7)
+
+	mirroring := []int{
+		MirroringVertical, MirroringHorizontal, MirroringSingleUpper, MirroringSingleLower,
+	}
+
+	for v, expected := range mirroring {
+		Ram.Write(0xE000, Word(v))
+		if ppu.Nametables.Mirroring != expected {
+			test.Errorf("Mirroring was %d after writing %d, expected %d", ppu.Nametables.Mirroring, v, expected)
+		}
+	}
+
+	// The FM chip is silent while held in reset
+	Ram.Write(0xE000, 0x80)
+	m.Clock(Vrc7SampleCycles)
+
+	if !m.SoundReset || m.OutputCount != 0 {
+		test.Error("FM chip was clocked while in reset")
+	}
+
+	Ram.Write(0xE000, 0x00)
+	m.Clock(Vrc7SampleCycles)
+
+	if m.SoundReset || m.OutputCount != 1 {
+		test.Error("FM chip wasn't clocked after the reset was released")
+	}
+}
+
+func TestVrc7Irq(test *testing.T) {
+	m := loadMapperRom(test, 85, 0, 8, 8).(*Vrc7)
+
+	// Latch of $FE, then enable in CPU cycle mode
+	Ram.Write(0xE010, 0xFE)
+	Ram.Write(0xF000, 0x06)
+
+	m.Clock(1)
+	if m.IrqAsserted() {
+		test.Error("IRQ fired early")
+	}
+
+	m.Clock(1)
+	if !m.IrqAsserted() {
+		test.Fatal("IRQ didn't fire when the counter overflowed")
+	}
+
+	Ram.Write(0xF010, 0x00)
+	if m.IrqAsserted() {
+		test.Error("Writing $F010 didn't acknowledge the IRQ")
+	}
+
+	// In scanline mode the counter is clocked every 341
+	// PPU cycles, which is every 113 2/3 CPU cycles
+	Ram.Write(0xF000, 0x02)
+
+	m.Clock(227)
+	if m.IrqAsserted() {
+		test.Error("Scanline IRQ fired early")
+	}
+
+	m.Clock(1)
+	if !m.IrqAsserted() {
+		test.Error("Scanline IRQ didn't fire after two scanlines")
+	}
+}
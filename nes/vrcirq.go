@@ -0,0 +1,90 @@
+package nes
+
+// IRQ counter shared by the Konami VRC4, VRC6 and VRC7. It
+// counts either CPU cycles, or scanlines by way of a prescaler
+// that approximates 113.667 CPU cycles per scanline.
+type VrcIrq struct {
+	Latch     Word
+	Counter   Word
+	Prescaler int
+	Enabled   bool
+	EnableAck bool
+	CycleMode bool
+	Requested bool
+}
+
+// Latch write, either as a whole byte or as
+// two nibbles on the VRC4
+func (i *VrcIrq) WriteLatch(v Word) {
+	i.Latch = v
+}
+
+func (i *VrcIrq) WriteLatchLow(v Word) {
+	i.Latch = (i.Latch & 0xF0) | (v & 0xF)
+}
+
+func (i *VrcIrq) WriteLatchHigh(v Word) {
+	i.Latch = (i.Latch & 0x0F) | ((v & 0xF) << 4)
+}
+
+func (i *VrcIrq) WriteControl(v Word) {
+	// ---- -MEA
+	//       |||
+	//       ||+- IRQ enable after acknowledgement
+	//       |+-- IRQ enable
+	//       +--- Mode (0: scanline; 1: CPU cycle)
+	i.EnableAck = v&0x1 == 0x1
+	i.Enabled = v&0x2 == 0x2
+	i.CycleMode = v&0x4 == 0x4
+
+	if i.Enabled {
+		i.Counter = i.Latch
+		i.Prescaler = 341
+	}
+
+	i.Requested = false
+}
+
+func (i *VrcIrq) Acknowledge() {
+	i.Enabled = i.EnableAck
+	i.Requested = false
+}
+
+// Called once per CPU cycle
+func (i *VrcIrq) Clock() {
+	if !i.Enabled {
+		return
+	}
+
+	if i.CycleMode {
+		i.clockCounter()
+		return
+	}
+
+	// The prescaler is decremented by 3 every CPU cycle
+	// and clocks the counter every 341 PPU cycles
+	i.Prescaler -= 3
+	if i.Prescaler <= 0 {
+		i.Prescaler += 341
+		i.clockCounter()
+	}
+}
+
+func (i *VrcIrq) clockCounter() {
+	if i.Counter == 0xFF {
+		i.Counter = i.Latch
+		i.Requested = true
+	} else {
+		i.Counter++
+	}
+}
+
+func (i *VrcIrq) SerializeState(s *State) {
+	s.Word(&i.Latch)
+	s.Word(&i.Counter)
+	s.Int(&i.Prescaler)
+	s.Bool(&i.Enabled)
+	s.Bool(&i.EnableAck)
+	s.Bool(&i.CycleMode)
+	s.Bool(&i.Requested)
+}
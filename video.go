@@ -192,7 +192,7 @@ func (v *Video) Render() {
 				case sdl.K_r:
 					// Trigger reset interrupt
 					if e.Type == sdl.KEYDOWN {
-						// cpu.RequestInterrupt(InterruptReset)
+						nes.Reset()
 					}
 				case sdl.K_l:
 					if e.Type == sdl.KEYDOWN {
@@ -239,6 +239,42 @@ func (v *Video) Render() {
 					if e.Type == sdl.KEYDOWN {
 						v.ResizeEvent(1024, 960)
 					}
+				case sdl.K_w:
+					if e.Type == sdl.KEYDOWN {
+						toggleAudioRecording()
+					}
+				case sdl.K_v:
+					if e.Type == sdl.KEYDOWN {
+						toggleVgmLogging()
+					}
+				case sdl.K_c:
+					if e.Type == sdl.KEYDOWN {
+						toggleVideoRecording()
+					}
+				case sdl.K_F12:
+					if e.Type == sdl.KEYDOWN {
+						nes.TakeScreenshot()
+					}
+				case sdl.K_o:
+					if e.Type == sdl.KEYDOWN {
+						nes.ToggleOverscan()
+					}
+				case sdl.K_RIGHTBRACKET:
+					if e.Type == sdl.KEYDOWN {
+						nes.NextTrack()
+					}
+				case sdl.K_LEFTBRACKET:
+					if e.Type == sdl.KEYDOWN {
+						nes.PreviousTrack()
+					}
+				case sdl.K_e:
+					if e.Type == sdl.KEYDOWN {
+						nes.ToggleDisk()
+					}
+				case sdl.K_f:
+					if e.Type == sdl.KEYDOWN {
+						nes.SwitchDiskSide()
+					}
 				}
 
 				switch e.Type {